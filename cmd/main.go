@@ -33,8 +33,9 @@ func main() {
 	//}
 	//var mdb = client.Database(dbName)
 	//// setup collections
-	//mdb.CreateCollection(context.Background(), mongostore.PostCollection)
-	//mdb.CreateCollection(context.Background(), mongostore.CommentCollection)
+	//try(mongostore.Migrate(context.Background(), mdb))
+	//_, err = mongostore.EnsureSchema(context.Background(), mdb)
+	//try(err)
 	//// setup default sequence
 	//sequence.SetupDefaultSequence(mdb, 30*time.Second)
 	//postRepo = repositories.NewMongoPostRepository(mdb)
@@ -46,8 +47,7 @@ func main() {
 	if err != nil {
 		panic(err)
 	}
-	//sqlstore.DropTables(sdb)
-	sqlstore.CreateTables(sdb)
+	try(sqlstore.Migrate(context.Background(), sdb))
 	postRepo = repositories.NewSqlPostRepository(sdb)
 	commentRepo = repositories.NewSqlCommentRepository(sdb)
 	// end use postgres
@@ -80,8 +80,9 @@ func main() {
 		return err
 	}))
 
-	// rollback
-	try(postRepo.InTransaction(context.Background(), func(ctx context.Context) error {
+	// rollback, InTransaction returns the error that caused it
+	errRollback := errors.New("rollback")
+	err = postRepo.InTransaction(context.Background(), func(ctx context.Context) error {
 		p = &models.Post{
 			Title: "this should not persisted",
 		}
@@ -104,6 +105,9 @@ func main() {
 			return err
 		}
 
-		return errors.New("rollback")
-	}))
+		return errRollback
+	})
+	if !errors.Is(err, errRollback) {
+		try(err)
+	}
 }
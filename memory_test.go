@@ -0,0 +1,1151 @@
+package repository_pattern
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/hendratommy/repository-pattern/memstore"
+	"github.com/hendratommy/repository-pattern/metrics"
+	"github.com/hendratommy/repository-pattern/models"
+	"github.com/hendratommy/repository-pattern/repositories"
+	"github.com/hendratommy/repository-pattern/tracing"
+	. "github.com/smartystreets/goconvey/convey"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestMemoryRepository(t *testing.T) {
+	Convey("Test memory repository", t, func() {
+		db := memstore.New()
+
+		postRepo := repositories.NewMemoryPostRepository(db)
+		commentRepo := repositories.NewMemoryCommentRepository(db)
+
+		Convey("Test transaction commit", func() {
+			var p *models.Post
+			err := postRepo.InTransaction(context.Background(), func(ctx context.Context) error {
+				p = &models.Post{
+					Title: "implement repository pattern in go",
+				}
+				if err := postRepo.Save(ctx, p); err != nil {
+					return err
+				}
+
+				c1 := &models.Comment{
+					PostID: p.ID,
+					Review: "yayy",
+				}
+				c2 := &models.Comment{
+					PostID: p.ID,
+					Review: "nayy",
+				}
+				if err := commentRepo.Save(ctx, c1); err != nil {
+					return err
+				}
+				return commentRepo.Save(ctx, c2)
+			})
+
+			Convey("Should commit successfully", func() {
+				So(err, ShouldBeNil)
+
+				posts, err := postRepo.FindAll(context.Background())
+				So(err, ShouldBeNil)
+				So(len(posts), ShouldEqual, 1)
+				So(posts[0].ID, ShouldEqual, p.ID)
+
+				comments, err := commentRepo.FindByPostID(context.Background(), p.ID)
+				So(err, ShouldBeNil)
+				So(len(comments), ShouldEqual, 2)
+				So(comments[0].Review, ShouldEqual, "yayy")
+				So(comments[1].Review, ShouldEqual, "nayy")
+			})
+		})
+
+		Convey("Test transaction rollback", func() {
+			err := postRepo.InTransaction(context.Background(), func(ctx context.Context) error {
+				p := &models.Post{
+					Title: "this should not persisted",
+				}
+				if err := postRepo.Save(ctx, p); err != nil {
+					return err
+				}
+
+				c1 := &models.Comment{
+					PostID: p.ID,
+					Review: "yayy",
+				}
+				if err := commentRepo.Save(ctx, c1); err != nil {
+					return err
+				}
+
+				return errors.New("should rollback")
+			})
+
+			Convey("Should rollback successfully", func() {
+				var txErr *models.TxError
+				So(errors.As(err, &txErr), ShouldBeTrue)
+				So(txErr.Err.Error(), ShouldEqual, "should rollback")
+				So(txErr.RollbackErr, ShouldBeNil)
+
+				posts, err := postRepo.FindAll(context.Background())
+				So(err, ShouldBeNil)
+				So(len(posts), ShouldEqual, 0)
+
+				comments, err := commentRepo.FindAll(context.Background())
+				So(err, ShouldBeNil)
+				So(len(comments), ShouldEqual, 0)
+			})
+		})
+
+		Convey("Test transaction panic", func() {
+			So(func() {
+				postRepo.InTransaction(context.Background(), func(ctx context.Context) error {
+					if err := postRepo.Save(ctx, &models.Post{Title: "this should not persisted"}); err != nil {
+						return err
+					}
+					panic("should rollback")
+				})
+			}, ShouldPanicWith, "should rollback")
+
+			Convey("Should rollback before propagating the panic", func() {
+				posts, err := postRepo.FindAll(context.Background())
+				So(err, ShouldBeNil)
+				So(len(posts), ShouldEqual, 0)
+			})
+		})
+
+		Convey("Test delete", func() {
+			p := &models.Post{Title: "implement repository pattern in go"}
+			try(postRepo.Save(context.Background(), p))
+			c := &models.Comment{PostID: p.ID, Review: "yayy"}
+			try(commentRepo.Save(context.Background(), c))
+
+			Convey("Should refuse to delete a post with comments", func() {
+				err := postRepo.Delete(context.Background(), p.ID)
+				So(errors.Is(err, models.ErrInvalidReference), ShouldBeTrue)
+			})
+
+			Convey("Should return not found when nothing is deleted", func() {
+				err := commentRepo.Delete(context.Background(), c.ID+1)
+				So(errors.Is(err, models.ErrNotFound), ShouldBeTrue)
+			})
+
+			Convey("Should join the transaction in ctx", func() {
+				err := postRepo.InTransaction(context.Background(), func(ctx context.Context) error {
+					if err := commentRepo.Delete(ctx, c.ID); err != nil {
+						return err
+					}
+					if err := postRepo.Delete(ctx, p.ID); err != nil {
+						return err
+					}
+					return errors.New("should rollback")
+				})
+				So(err.Error(), ShouldEqual, "should rollback")
+
+				_, err = commentRepo.FindByID(context.Background(), c.ID)
+				So(err, ShouldBeNil)
+
+				try(commentRepo.Delete(context.Background(), c.ID))
+				try(postRepo.Delete(context.Background(), p.ID))
+
+				_, err = postRepo.FindByID(context.Background(), p.ID)
+				So(errors.Is(err, models.ErrNotFound), ShouldBeTrue)
+			})
+		})
+
+		Convey("Test delete cascade", func() {
+			p := &models.Post{Title: "implement repository pattern in go"}
+			try(postRepo.Save(context.Background(), p))
+			try(commentRepo.Save(context.Background(), &models.Comment{PostID: p.ID, Review: "yayy"}))
+			try(commentRepo.Save(context.Background(), &models.Comment{PostID: p.ID, Review: "nayy"}))
+
+			Convey("Should delete the post and its comments", func() {
+				n, err := postRepo.DeleteCascade(context.Background(), p.ID)
+				So(err, ShouldBeNil)
+				So(n, ShouldEqual, 2)
+
+				_, err = postRepo.FindByID(context.Background(), p.ID)
+				So(errors.Is(err, models.ErrNotFound), ShouldBeTrue)
+				comments, err := commentRepo.FindByPostID(context.Background(), p.ID)
+				So(err, ShouldBeNil)
+				So(len(comments), ShouldEqual, 0)
+			})
+
+			Convey("Should return not found for unknown post", func() {
+				_, err := postRepo.DeleteCascade(context.Background(), p.ID+1)
+				So(errors.Is(err, models.ErrNotFound), ShouldBeTrue)
+			})
+
+			Convey("Should keep everything when the transaction rolls back", func() {
+				err := postRepo.InTransaction(context.Background(), func(ctx context.Context) error {
+					if _, err := postRepo.DeleteCascade(ctx, p.ID); err != nil {
+						return err
+					}
+					return errors.New("should rollback")
+				})
+				So(err.Error(), ShouldEqual, "should rollback")
+
+				comments, err := commentRepo.FindByPostID(context.Background(), p.ID)
+				So(err, ShouldBeNil)
+				So(len(comments), ShouldEqual, 2)
+			})
+		})
+
+		Convey("Test save existing id", func() {
+			p := &models.Post{Title: "implement repository pattern in go"}
+			try(postRepo.Save(context.Background(), p))
+			id := p.ID
+
+			p.Title = "implement repository pattern in go, revised"
+			try(postRepo.Save(context.Background(), p))
+
+			Convey("Should update instead of inserting", func() {
+				So(p.ID, ShouldEqual, id)
+
+				posts, err := postRepo.FindAll(context.Background())
+				So(err, ShouldBeNil)
+				So(len(posts), ShouldEqual, 1)
+				So(posts[0].Title, ShouldEqual, "implement repository pattern in go, revised")
+			})
+
+			Convey("Should insert with the given id and keep generating after it", func() {
+				explicit := &models.Post{ID: id + 10, Title: "explicit id"}
+				try(postRepo.Save(context.Background(), explicit))
+				So(explicit.ID, ShouldEqual, id+10)
+
+				generated := &models.Post{Title: "generated id"}
+				try(postRepo.Save(context.Background(), generated))
+				So(generated.ID, ShouldBeGreaterThan, id+10)
+			})
+
+			Convey("Should fail to insert a taken id", func() {
+				err := postRepo.Insert(context.Background(), &models.Post{ID: id, Title: "duplicate"})
+				So(errors.Is(err, models.ErrConflict), ShouldBeTrue)
+			})
+
+			Convey("Should fail to update a missing id", func() {
+				err := postRepo.Update(context.Background(), &models.Post{ID: id + 1, Title: "missing"})
+				So(errors.Is(err, models.ErrNotFound), ShouldBeTrue)
+
+				p.Title = "updated"
+				try(postRepo.Update(context.Background(), p))
+				found, err := postRepo.FindByID(context.Background(), id)
+				So(err, ShouldBeNil)
+				So(found.Title, ShouldEqual, "updated")
+			})
+		})
+
+		Convey("Test optimistic locking", func() {
+			p := &models.Post{Title: "implement repository pattern in go"}
+			try(postRepo.Save(context.Background(), p))
+			stale, err := postRepo.FindByID(context.Background(), p.ID)
+			try(err)
+
+			Convey("Should start at version 1 and increment on update", func() {
+				So(p.Version, ShouldEqual, 1)
+
+				p.Title = "implement repository pattern in go, revised"
+				try(postRepo.Update(context.Background(), p))
+				So(p.Version, ShouldEqual, 2)
+				try(postRepo.Save(context.Background(), p))
+				So(p.Version, ShouldEqual, 3)
+
+				found, err := postRepo.FindByID(context.Background(), p.ID)
+				So(err, ShouldBeNil)
+				So(found.Version, ShouldEqual, 3)
+			})
+
+			Convey("Should insert an explicit unknown id at version 1 whatever its version", func() {
+				explicit := &models.Post{ID: p.ID + 100, Title: "explicit id", Version: 7}
+				try(postRepo.Save(context.Background(), explicit))
+				So(explicit.Version, ShouldEqual, 1)
+
+				found, err := postRepo.FindByID(context.Background(), explicit.ID)
+				So(err, ShouldBeNil)
+				So(found.Version, ShouldEqual, 1)
+			})
+
+			Convey("Should report a conflict saving over a deleted entity", func() {
+				softPostRepo := repositories.NewMemoryPostRepository(db, repositories.WithSoftDelete())
+				try(softPostRepo.Delete(context.Background(), p.ID))
+				err := softPostRepo.Save(context.Background(), p)
+				So(errors.Is(err, models.ErrConflict), ShouldBeTrue)
+				So(errors.Is(err, models.ErrStaleVersion), ShouldBeFalse)
+			})
+
+			Convey("Should refuse to overwrite a newer version", func() {
+				p.Title = "first writer"
+				try(postRepo.Update(context.Background(), p))
+
+				stale.Title = "second writer"
+				err := postRepo.Update(context.Background(), stale)
+				So(errors.Is(err, models.ErrStaleVersion), ShouldBeTrue)
+				So(errors.Is(err, models.ErrConflict), ShouldBeTrue)
+				So(stale.Version, ShouldEqual, 1)
+
+				err = postRepo.Save(context.Background(), stale)
+				So(errors.Is(err, models.ErrStaleVersion), ShouldBeTrue)
+
+				found, err := postRepo.FindByID(context.Background(), p.ID)
+				So(err, ShouldBeNil)
+				So(found.Title, ShouldEqual, "first writer")
+			})
+
+			Convey("Should refuse the second of two transactions updating the same version", func() {
+				// both update version 1 before either commits
+				updated := make(chan struct{}, 2)
+				commit := make(chan struct{})
+				errs := make(chan error, 2)
+				for _, title := range []string{"first writer", "second writer"} {
+					go func(title string) {
+						errs <- postRepo.InTransaction(context.Background(), func(ctx context.Context) error {
+							found, err := postRepo.FindByID(ctx, p.ID)
+							if err != nil {
+								return err
+							}
+							found.Title = title
+							err = postRepo.Update(ctx, found)
+							updated <- struct{}{}
+							<-commit
+							return err
+						})
+					}(title)
+				}
+				<-updated
+				<-updated
+				close(commit)
+				err1, err2 := <-errs, <-errs
+				So(err1 == nil != (err2 == nil), ShouldBeTrue)
+				if err1 == nil {
+					err1 = err2
+				}
+				So(errors.Is(err1, models.ErrStaleVersion), ShouldBeTrue)
+
+				found, err := postRepo.FindByID(context.Background(), p.ID)
+				So(err, ShouldBeNil)
+				So(found.Version, ShouldEqual, 2)
+			})
+		})
+
+		Convey("Test pagination", func() {
+			p := &models.Post{Title: "implement repository pattern in go"}
+			try(postRepo.Save(context.Background(), p))
+			for i := 0; i < 5; i++ {
+				try(postRepo.Save(context.Background(), &models.Post{Title: "filler"}))
+			}
+			for i := 0; i < 5; i++ {
+				try(commentRepo.Save(context.Background(), &models.Comment{PostID: p.ID, Review: "yayy"}))
+			}
+
+			Convey("Should walk every page with the cursor", func() {
+				var ids []int
+				req := models.PageRequest{Limit: 2}
+				for {
+					page, err := commentRepo.FindPageByPostID(context.Background(), p.ID, req)
+					So(err, ShouldBeNil)
+					for _, c := range page.Items {
+						ids = append(ids, c.ID)
+					}
+					if !page.HasMore {
+						So(page.NextCursor, ShouldBeEmpty)
+						break
+					}
+					req.Cursor = page.NextCursor
+				}
+				So(len(ids), ShouldEqual, 5)
+				for i := 1; i < len(ids); i++ {
+					So(ids[i], ShouldBeGreaterThan, ids[i-1])
+				}
+			})
+
+			Convey("Should skip with offset", func() {
+				page, err := postRepo.FindPage(context.Background(), models.PageRequest{Limit: 4, Offset: 4})
+				So(err, ShouldBeNil)
+				So(len(page.Items), ShouldEqual, 2)
+				So(page.HasMore, ShouldBeFalse)
+
+				page, err = postRepo.FindPage(context.Background(), models.PageRequest{Limit: 4, Offset: 1})
+				So(err, ShouldBeNil)
+				So(len(page.Items), ShouldEqual, 4)
+				So(page.HasMore, ShouldBeTrue)
+				So(page.Items[0].ID, ShouldBeGreaterThan, p.ID)
+			})
+
+			Convey("Should reject an invalid cursor", func() {
+				_, err := postRepo.FindPage(context.Background(), models.PageRequest{Cursor: "not a cursor"})
+				So(errors.Is(err, models.ErrInvalidCursor), ShouldBeTrue)
+			})
+		})
+
+		Convey("Test find by spec", func() {
+			p1 := &models.Post{Title: "implement repository pattern in go"}
+			try(postRepo.Save(context.Background(), p1))
+			p2 := &models.Post{Title: "implement unit of work in go"}
+			try(postRepo.Save(context.Background(), p2))
+			p3 := &models.Post{Title: "hello world"}
+			try(postRepo.Save(context.Background(), p3))
+			try(commentRepo.Save(context.Background(), &models.Comment{PostID: p1.ID, Review: "yayy"}))
+			try(commentRepo.Save(context.Background(), &models.Comment{PostID: p2.ID, Review: "nayy"}))
+			try(commentRepo.Save(context.Background(), &models.Comment{PostID: p2.ID, Review: "yayy"}))
+
+			Convey("Should filter with every operator", func() {
+				posts, err := postRepo.FindBy(context.Background(), models.Where(models.Like("Title", "implement%")))
+				So(err, ShouldBeNil)
+				So(len(posts), ShouldEqual, 2)
+
+				posts, err = postRepo.FindBy(context.Background(), models.Where(models.In("ID", p1.ID, p3.ID)))
+				So(err, ShouldBeNil)
+				So(len(posts), ShouldEqual, 2)
+				So(posts[1].ID, ShouldEqual, p3.ID)
+
+				posts, err = postRepo.FindBy(context.Background(), models.Where(models.Range("ID", p2.ID, nil)))
+				So(err, ShouldBeNil)
+				So(len(posts), ShouldEqual, 2)
+
+				comments, err := commentRepo.FindBy(context.Background(), models.Where(models.And(
+					models.Eq("PostID", p2.ID),
+					models.Or(models.Eq("Review", "yayy"), models.Eq("Review", "meh")),
+				)))
+				So(err, ShouldBeNil)
+				So(len(comments), ShouldEqual, 1)
+				So(comments[0].PostID, ShouldEqual, p2.ID)
+			})
+
+			Convey("Should order by the given fields then id", func() {
+				comments, err := commentRepo.FindBy(context.Background(), models.All().OrderBy(models.Asc("Review"), models.Desc("PostID")))
+				So(err, ShouldBeNil)
+				So(len(comments), ShouldEqual, 3)
+				So(comments[0].Review, ShouldEqual, "nayy")
+				So(comments[1].PostID, ShouldEqual, p2.ID)
+				So(comments[2].PostID, ShouldEqual, p1.ID)
+			})
+
+			Convey("Should treat values as data", func() {
+				posts, err := postRepo.FindBy(context.Background(), models.Where(models.Eq("Title", "x' OR '1'='1")))
+				So(err, ShouldBeNil)
+				So(len(posts), ShouldEqual, 0)
+			})
+
+			Convey("Should reject unknown fields", func() {
+				_, err := postRepo.FindBy(context.Background(), models.Where(models.Eq("title; DROP TABLE posts", 1)))
+				So(errors.Is(err, models.ErrInvalidSpec), ShouldBeTrue)
+			})
+		})
+
+		Convey("Test count and exists", func() {
+			p := &models.Post{Title: "implement repository pattern in go"}
+			try(postRepo.Save(context.Background(), p))
+			try(commentRepo.Save(context.Background(), &models.Comment{PostID: p.ID, Review: "yayy"}))
+			try(commentRepo.Save(context.Background(), &models.Comment{PostID: p.ID, Review: "nayy"}))
+
+			Convey("Should count matching entities", func() {
+				n, err := commentRepo.Count(context.Background(), models.Where(models.Eq("PostID", p.ID)))
+				So(err, ShouldBeNil)
+				So(n, ShouldEqual, 2)
+
+				n, err = commentRepo.Count(context.Background(), models.Where(models.Eq("PostID", p.ID+1)))
+				So(err, ShouldBeNil)
+				So(n, ShouldEqual, 0)
+
+				n, err = postRepo.Count(context.Background(), models.All())
+				So(err, ShouldBeNil)
+				So(n, ShouldEqual, 1)
+			})
+
+			Convey("Should tell whether an id exists", func() {
+				ok, err := postRepo.Exists(context.Background(), p.ID)
+				So(err, ShouldBeNil)
+				So(ok, ShouldBeTrue)
+
+				ok, err = postRepo.Exists(context.Background(), p.ID+1)
+				So(err, ShouldBeNil)
+				So(ok, ShouldBeFalse)
+			})
+
+			Convey("Should see the writes of the transaction in ctx", func() {
+				err := postRepo.InTransaction(context.Background(), func(ctx context.Context) error {
+					try(commentRepo.Save(ctx, &models.Comment{PostID: p.ID, Review: "meh"}))
+					n, err := commentRepo.Count(ctx, models.Where(models.Eq("PostID", p.ID)))
+					So(err, ShouldBeNil)
+					So(n, ShouldEqual, 3)
+					return errors.New("should rollback")
+				})
+				So(err, ShouldNotBeNil)
+
+				n, err := commentRepo.Count(context.Background(), models.Where(models.Eq("PostID", p.ID)))
+				So(err, ShouldBeNil)
+				So(n, ShouldEqual, 2)
+			})
+		})
+
+		Convey("Test save all", func() {
+			p := &models.Post{Title: "implement repository pattern in go"}
+			try(postRepo.Save(context.Background(), p))
+
+			Convey("Should insert in batches and assign the ids", func() {
+				comments := make([]*models.Comment, 2500)
+				for i := range comments {
+					comments[i] = &models.Comment{PostID: p.ID, Review: fmt.Sprintf("review %d", i)}
+				}
+				try(commentRepo.SaveAll(context.Background(), comments))
+
+				ids := map[int]bool{}
+				for _, c := range comments {
+					So(c.Version, ShouldEqual, 1)
+					ids[c.ID] = true
+				}
+				So(len(ids), ShouldEqual, len(comments))
+
+				n, err := commentRepo.Count(context.Background(), models.Where(models.Eq("PostID", p.ID)))
+				So(err, ShouldBeNil)
+				So(n, ShouldEqual, len(comments))
+
+				found, err := commentRepo.FindByID(context.Background(), comments[1234].ID)
+				So(err, ShouldBeNil)
+				So(found.Review, ShouldEqual, "review 1234")
+			})
+
+			Convey("Should save nothing when one entity fails", func() {
+				stale := *p
+				p.Title = "first writer"
+				try(postRepo.Update(context.Background(), p))
+
+				fresh := &models.Post{ID: p.ID, Title: "second writer", Version: p.Version}
+				err := postRepo.SaveAll(context.Background(), []*models.Post{fresh, &stale, {Title: "new"}})
+				So(errors.Is(err, models.ErrStaleVersion), ShouldBeTrue)
+
+				posts, err := postRepo.FindAll(context.Background())
+				So(err, ShouldBeNil)
+				So(len(posts), ShouldEqual, 1)
+				So(posts[0].Title, ShouldEqual, "first writer")
+			})
+		})
+
+		Convey("Test soft delete", func() {
+			softPostRepo := repositories.NewMemoryPostRepository(db, repositories.WithSoftDelete())
+			softCommentRepo := repositories.NewMemoryCommentRepository(db, repositories.WithSoftDelete())
+
+			p := &models.Post{Title: "implement repository pattern in go"}
+			try(softPostRepo.Save(context.Background(), p))
+			c := &models.Comment{PostID: p.ID, Review: "yayy"}
+			try(softCommentRepo.Save(context.Background(), c))
+			try(softCommentRepo.Delete(context.Background(), c.ID))
+
+			Convey("Should hide deleted entities from the finders", func() {
+				_, err := softCommentRepo.FindByID(context.Background(), c.ID)
+				So(errors.Is(err, models.ErrNotFound), ShouldBeTrue)
+				comments, err := softCommentRepo.FindByPostID(context.Background(), p.ID)
+				So(err, ShouldBeNil)
+				So(len(comments), ShouldEqual, 0)
+				n, err := softCommentRepo.Count(context.Background(), models.All())
+				So(err, ShouldBeNil)
+				So(n, ShouldEqual, 0)
+				ok, err := softCommentRepo.Exists(context.Background(), c.ID)
+				So(err, ShouldBeNil)
+				So(ok, ShouldBeFalse)
+
+				err = softCommentRepo.Delete(context.Background(), c.ID)
+				So(errors.Is(err, models.ErrNotFound), ShouldBeTrue)
+				err = softCommentRepo.Update(context.Background(), c)
+				So(errors.Is(err, models.ErrNotFound), ShouldBeTrue)
+			})
+
+			Convey("Should still find deleted entities on request", func() {
+				comments, err := softCommentRepo.FindIncludingDeleted(context.Background(), models.Where(models.Eq("PostID", p.ID)))
+				So(err, ShouldBeNil)
+				So(len(comments), ShouldEqual, 1)
+				So(comments[0].DeletedAt, ShouldNotBeNil)
+
+				found, err := commentRepo.FindByID(context.Background(), c.ID)
+				So(err, ShouldBeNil)
+				So(found.DeletedAt, ShouldNotBeNil)
+			})
+
+			Convey("Should restore deleted entities", func() {
+				try(softCommentRepo.Restore(context.Background(), c.ID))
+				found, err := softCommentRepo.FindByID(context.Background(), c.ID)
+				So(err, ShouldBeNil)
+				So(found.DeletedAt, ShouldBeNil)
+
+				err = softCommentRepo.Restore(context.Background(), c.ID)
+				So(errors.Is(err, models.ErrNotFound), ShouldBeTrue)
+			})
+
+			Convey("Should only purge entities deleted long enough ago", func() {
+				n, err := softCommentRepo.Purge(context.Background(), time.Hour)
+				So(err, ShouldBeNil)
+				So(n, ShouldEqual, 0)
+
+				n, err = softCommentRepo.Purge(context.Background(), -time.Hour)
+				So(err, ShouldBeNil)
+				So(n, ShouldEqual, 1)
+				comments, err := softCommentRepo.FindIncludingDeleted(context.Background(), models.All())
+				So(err, ShouldBeNil)
+				So(len(comments), ShouldEqual, 0)
+			})
+
+			Convey("Should hide a post with its comments", func() {
+				try(softCommentRepo.Restore(context.Background(), c.ID))
+				try(softPostRepo.Delete(context.Background(), p.ID))
+				_, err := softPostRepo.FindByID(context.Background(), p.ID)
+				So(errors.Is(err, models.ErrNotFound), ShouldBeTrue)
+				try(softPostRepo.Restore(context.Background(), p.ID))
+
+				n, err := softPostRepo.DeleteCascade(context.Background(), p.ID)
+				So(err, ShouldBeNil)
+				So(n, ShouldEqual, 1)
+				comments, err := softCommentRepo.FindIncludingDeleted(context.Background(), models.Where(models.Eq("PostID", p.ID)))
+				So(err, ShouldBeNil)
+				So(len(comments), ShouldEqual, 1)
+				So(comments[0].DeletedAt, ShouldNotBeNil)
+			})
+		})
+
+		Convey("Test timestamps", func() {
+			start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+			now := start
+			clock := func() time.Time {
+				now = now.Add(time.Minute)
+				return now
+			}
+			tsPostRepo := repositories.NewMemoryPostRepository(db, repositories.WithClock(clock))
+
+			p := &models.Post{Title: "implement repository pattern in go"}
+			try(tsPostRepo.Save(context.Background(), p))
+
+			Convey("Should set CreatedAt and UpdatedAt on insert", func() {
+				So(p.CreatedAt.Equal(start.Add(time.Minute)), ShouldBeTrue)
+				So(p.UpdatedAt.Equal(p.CreatedAt), ShouldBeTrue)
+
+				found, err := tsPostRepo.FindByID(context.Background(), p.ID)
+				So(err, ShouldBeNil)
+				So(found.CreatedAt.Equal(p.CreatedAt), ShouldBeTrue)
+				So(found.UpdatedAt.Equal(p.UpdatedAt), ShouldBeTrue)
+			})
+
+			Convey("Should only move UpdatedAt on update", func() {
+				created := p.CreatedAt
+				p.Title = "implement repository pattern in go, again"
+				p.CreatedAt = time.Time{}
+				try(tsPostRepo.Update(context.Background(), p))
+				So(p.UpdatedAt.After(created), ShouldBeTrue)
+
+				found, err := tsPostRepo.FindByID(context.Background(), p.ID)
+				So(err, ShouldBeNil)
+				So(found.CreatedAt.Equal(created), ShouldBeTrue)
+				So(found.UpdatedAt.Equal(p.UpdatedAt), ShouldBeTrue)
+
+				found.CreatedAt = time.Time{}
+				try(tsPostRepo.Save(context.Background(), found))
+				found, err = tsPostRepo.FindByID(context.Background(), p.ID)
+				So(err, ShouldBeNil)
+				So(found.CreatedAt.Equal(created), ShouldBeTrue)
+				So(found.UpdatedAt.After(p.UpdatedAt), ShouldBeTrue)
+			})
+
+			Convey("Should stamp a cascaded soft delete with the clock", func() {
+				softPostRepo := repositories.NewMemoryPostRepository(db, repositories.WithSoftDelete(), repositories.WithClock(clock))
+				c := &models.Comment{PostID: p.ID, Review: "stamped by the clock"}
+				try(commentRepo.Save(context.Background(), c))
+				before := now
+
+				n, err := softPostRepo.DeleteCascade(context.Background(), p.ID)
+				So(err, ShouldBeNil)
+				So(n, ShouldEqual, 1)
+				found, err := commentRepo.FindByID(context.Background(), c.ID)
+				So(err, ShouldBeNil)
+				So(found.DeletedAt, ShouldNotBeNil)
+				So(found.DeletedAt.After(before) && !found.DeletedAt.After(now), ShouldBeTrue)
+				posts, err := softPostRepo.FindIncludingDeleted(context.Background(), models.Where(models.Eq("ID", p.ID)))
+				So(err, ShouldBeNil)
+				So(len(posts), ShouldEqual, 1)
+				So(posts[0].DeletedAt.After(before) && !posts[0].DeletedAt.After(now), ShouldBeTrue)
+			})
+
+			Convey("Should order by timestamps", func() {
+				p2 := &models.Post{Title: "second"}
+				p3 := &models.Post{Title: "third"}
+				try(tsPostRepo.Save(context.Background(), p2))
+				try(tsPostRepo.Save(context.Background(), p3))
+
+				posts, err := tsPostRepo.FindBy(context.Background(), models.All().OrderBy(models.Desc("CreatedAt")))
+				So(err, ShouldBeNil)
+				So(len(posts), ShouldEqual, 3)
+				So(posts[0].ID, ShouldEqual, p3.ID)
+				So(posts[2].ID, ShouldEqual, p.ID)
+
+				req := models.PageRequest{Limit: 2, OrderBy: models.Desc("CreatedAt")}
+				page, err := tsPostRepo.FindPage(context.Background(), req)
+				So(err, ShouldBeNil)
+				So(len(page.Items), ShouldEqual, 2)
+				So(page.Items[0].ID, ShouldEqual, p3.ID)
+				So(page.Items[1].ID, ShouldEqual, p2.ID)
+				So(page.HasMore, ShouldBeTrue)
+
+				req.Cursor = page.NextCursor
+				page, err = tsPostRepo.FindPage(context.Background(), req)
+				So(err, ShouldBeNil)
+				So(len(page.Items), ShouldEqual, 1)
+				So(page.Items[0].ID, ShouldEqual, p.ID)
+				So(page.HasMore, ShouldBeFalse)
+
+				_, err = tsPostRepo.FindPage(context.Background(), models.PageRequest{OrderBy: models.Asc("Missing")})
+				So(errors.Is(err, models.ErrInvalidSpec), ShouldBeTrue)
+			})
+		})
+
+		Convey("Test caching", func() {
+			now := time.Now()
+			clock := func() time.Time { return now }
+			counting := &countingPostRepository{PostRepository: postRepo}
+			cachedPostRepo := repositories.NewCachingPostRepository(counting, repositories.WithClock(clock),
+				repositories.WithCacheTTL(time.Minute), repositories.WithCacheSize(2))
+			cachedCommentRepo := repositories.NewCachingCommentRepository(commentRepo)
+
+			p := &models.Post{Title: "implement repository pattern in go"}
+			try(postRepo.Save(context.Background(), p))
+			_, err := cachedPostRepo.FindByID(context.Background(), p.ID)
+			try(err)
+			// written behind the back of the cache
+			p.Title = "implement repository pattern in go, again"
+			try(postRepo.Update(context.Background(), p))
+
+			Convey("Should serve reads from the cache until they expire", func() {
+				found, err := cachedPostRepo.FindByID(context.Background(), p.ID)
+				So(err, ShouldBeNil)
+				So(found.Title, ShouldEqual, "implement repository pattern in go")
+				So(counting.finds.Load(), ShouldEqual, 1)
+
+				found.Title = "changed by the caller"
+				found, err = cachedPostRepo.FindByID(context.Background(), p.ID)
+				So(err, ShouldBeNil)
+				So(found.Title, ShouldEqual, "implement repository pattern in go")
+
+				now = now.Add(time.Minute)
+				found, err = cachedPostRepo.FindByID(context.Background(), p.ID)
+				So(err, ShouldBeNil)
+				So(found.Title, ShouldEqual, p.Title)
+				So(counting.finds.Load(), ShouldEqual, 2)
+			})
+
+			Convey("Should evict the least recently used entries", func() {
+				for _, title := range []string{"second", "third"} {
+					other := &models.Post{Title: title}
+					try(postRepo.Save(context.Background(), other))
+					_, err := cachedPostRepo.FindByID(context.Background(), other.ID)
+					try(err)
+				}
+				found, err := cachedPostRepo.FindByID(context.Background(), p.ID)
+				So(err, ShouldBeNil)
+				So(found.Title, ShouldEqual, p.Title)
+			})
+
+			Convey("Should invalidate on writes", func() {
+				p.Title = "written through the cache"
+				try(cachedPostRepo.Save(context.Background(), p))
+				found, err := cachedPostRepo.FindByID(context.Background(), p.ID)
+				So(err, ShouldBeNil)
+				So(found.Title, ShouldEqual, p.Title)
+
+				try(cachedPostRepo.Delete(context.Background(), p.ID))
+				_, err = cachedPostRepo.FindByID(context.Background(), p.ID)
+				So(errors.Is(err, models.ErrNotFound), ShouldBeTrue)
+			})
+
+			Convey("Should invalidate once the transaction is over", func() {
+				err := cachedPostRepo.InTransaction(context.Background(), func(ctx context.Context) error {
+					p.Title = "written in a transaction"
+					if err := cachedPostRepo.Update(ctx, p); err != nil {
+						return err
+					}
+					found, err := cachedPostRepo.FindByID(ctx, p.ID)
+					if err != nil {
+						return err
+					}
+					So(found.Title, ShouldEqual, p.Title)
+					found, err = cachedPostRepo.FindByID(context.Background(), p.ID)
+					if err != nil {
+						return err
+					}
+					So(found.Title, ShouldEqual, "implement repository pattern in go")
+					return nil
+				})
+				So(err, ShouldBeNil)
+
+				found, err := cachedPostRepo.FindByID(context.Background(), p.ID)
+				So(err, ShouldBeNil)
+				So(found.Title, ShouldEqual, "written in a transaction")
+			})
+
+			Convey("Should share a single load between concurrent misses", func() {
+				now = now.Add(time.Minute)
+				counting.delay = 20 * time.Millisecond
+				var wg sync.WaitGroup
+				for i := 0; i < 10; i++ {
+					wg.Add(1)
+					go func() {
+						defer wg.Done()
+						cachedPostRepo.FindByID(context.Background(), p.ID)
+					}()
+				}
+				wg.Wait()
+				So(counting.finds.Load(), ShouldEqual, 2)
+			})
+
+			Convey("Should not fail the other misses when the first one gives up", func() {
+				now = now.Add(time.Minute)
+				counting.delay = 20 * time.Millisecond
+				ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+				defer cancel()
+				errc := make(chan error)
+				go func() {
+					_, err := cachedPostRepo.FindByID(ctx, p.ID)
+					errc <- err
+				}()
+				time.Sleep(5 * time.Millisecond)
+				found, err := cachedPostRepo.FindByID(context.Background(), p.ID)
+				So(err, ShouldBeNil)
+				So(found.Title, ShouldEqual, p.Title)
+				So(errors.Is(<-errc, context.DeadlineExceeded), ShouldBeTrue)
+				So(counting.finds.Load(), ShouldEqual, 2)
+			})
+
+			Convey("Should not cache reads of a transaction of the wrapped repository", func() {
+				now = now.Add(time.Minute)
+				committed := p.Title
+				err := postRepo.InTransaction(context.Background(), func(ctx context.Context) error {
+					p.Title = "never committed"
+					if err := postRepo.Update(ctx, p); err != nil {
+						return err
+					}
+					found, err := cachedPostRepo.FindByID(ctx, p.ID)
+					if err != nil {
+						return err
+					}
+					So(found.Title, ShouldEqual, "never committed")
+					return errors.New("rollback")
+				})
+				So(err, ShouldNotBeNil)
+
+				found, err := cachedPostRepo.FindByID(context.Background(), p.ID)
+				So(err, ShouldBeNil)
+				So(found.Title, ShouldEqual, committed)
+			})
+
+			Convey("Should cache comments by post", func() {
+				c := &models.Comment{PostID: p.ID, Review: "yayy"}
+				try(commentRepo.Save(context.Background(), c))
+				comments, err := cachedCommentRepo.FindByPostID(context.Background(), p.ID)
+				So(err, ShouldBeNil)
+				So(len(comments), ShouldEqual, 1)
+
+				try(commentRepo.Save(context.Background(), &models.Comment{PostID: p.ID, Review: "nayy"}))
+				comments, err = cachedCommentRepo.FindByPostID(context.Background(), p.ID)
+				So(err, ShouldBeNil)
+				So(len(comments), ShouldEqual, 1)
+
+				try(cachedCommentRepo.Delete(context.Background(), c.ID))
+				comments, err = cachedCommentRepo.FindByPostID(context.Background(), p.ID)
+				So(err, ShouldBeNil)
+				So(len(comments), ShouldEqual, 1)
+				So(comments[0].Review, ShouldEqual, "nayy")
+			})
+
+			Convey("Should drop the comments deleted by a cascade from the linked caches", func() {
+				cachedPostRepo.CascadeTo(cachedCommentRepo)
+				c := &models.Comment{PostID: p.ID, Review: "yayy"}
+				try(commentRepo.Save(context.Background(), c))
+				_, err := cachedCommentRepo.FindByID(context.Background(), c.ID)
+				try(err)
+				comments, err := cachedCommentRepo.FindByPostID(context.Background(), p.ID)
+				try(err)
+				So(len(comments), ShouldEqual, 1)
+
+				err = cachedPostRepo.InTransaction(context.Background(), func(ctx context.Context) error {
+					_, err := cachedPostRepo.DeleteCascade(ctx, p.ID)
+					return err
+				})
+				So(err, ShouldBeNil)
+				_, err = cachedCommentRepo.FindByID(context.Background(), c.ID)
+				So(errors.Is(err, models.ErrNotFound), ShouldBeTrue)
+				comments, err = cachedCommentRepo.FindByPostID(context.Background(), p.ID)
+				So(err, ShouldBeNil)
+				So(len(comments), ShouldEqual, 0)
+			})
+		})
+
+		Convey("Test metrics", func() {
+			registry := metrics.NewRegistry()
+			instrumentedPostRepo := repositories.NewInstrumentedPostRepository(postRepo, registry)
+
+			p := &models.Post{Title: "implement repository pattern in go"}
+			try(instrumentedPostRepo.Save(context.Background(), p))
+			_, err := instrumentedPostRepo.FindByID(context.Background(), p.ID)
+			try(err)
+			_, err = instrumentedPostRepo.FindByID(context.Background(), p.ID+1)
+			So(errors.Is(err, models.ErrNotFound), ShouldBeTrue)
+			try(instrumentedPostRepo.InTransaction(context.Background(), func(ctx context.Context) error {
+				return instrumentedPostRepo.Update(ctx, p)
+			}))
+			err = instrumentedPostRepo.InTransaction(context.Background(), func(ctx context.Context) error {
+				return errors.New("rollback")
+			})
+			So(err, ShouldNotBeNil)
+
+			Convey("Should record the duration of every operation", func() {
+				count, _ := registry.Histogram(repositories.OperationDurationMetric, metrics.Labels{"repository": "posts", "operation": "FindByID"})
+				So(count, ShouldEqual, 2)
+				count, _ = registry.Histogram(repositories.OperationDurationMetric, metrics.Labels{"repository": "posts", "operation": "Save"})
+				So(count, ShouldEqual, 1)
+			})
+
+			Convey("Should count errors by class", func() {
+				labels := metrics.Labels{"repository": "posts", "operation": "FindByID", "class": "not_found"}
+				So(registry.Counter(repositories.OperationErrorsMetric, labels), ShouldEqual, 1)
+			})
+
+			Convey("Should count transactions by outcome", func() {
+				for _, outcome := range []string{repositories.OutcomeCommit, repositories.OutcomeRollback} {
+					labels := metrics.Labels{"repository": "posts", "outcome": outcome}
+					So(registry.Counter(repositories.TransactionsMetric, labels), ShouldEqual, 1)
+					count, _ := registry.Histogram(repositories.TransactionDurationMetric, labels)
+					So(count, ShouldEqual, 1)
+				}
+			})
+
+			Convey("Should export in the prometheus text format", func() {
+				var b strings.Builder
+				try(registry.WritePrometheus(&b))
+				So(b.String(), ShouldContainSubstring, "# TYPE repository_operation_errors_total counter\n")
+				So(b.String(), ShouldContainSubstring, `repository_operation_errors_total{class="not_found",operation="FindByID",repository="posts"} 1`)
+				So(b.String(), ShouldContainSubstring, `repository_operation_duration_seconds_bucket{operation="Save",repository="posts",le="+Inf"} 1`)
+				So(b.String(), ShouldContainSubstring, `repository_transactions_total{outcome="commit",repository="posts"} 1`)
+			})
+		})
+
+		Convey("Test tracing", func() {
+			exporter := &tracing.InMemoryExporter{}
+			tracedPostRepo := repositories.NewTracedPostRepository(postRepo, tracing.NewTracer(exporter))
+
+			p := &models.Post{Title: "implement repository pattern in go"}
+			try(tracedPostRepo.InTransaction(context.Background(), func(ctx context.Context) error {
+				if err := tracedPostRepo.Save(ctx, p); err != nil {
+					return err
+				}
+				_, err := tracedPostRepo.FindAll(ctx)
+				return err
+			}))
+			_, findErr := tracedPostRepo.FindByID(context.Background(), p.ID+1)
+			spans := exporter.Spans()
+
+			Convey("Should record a span per operation, children of the transaction span", func() {
+				So(spans, ShouldHaveLength, 4)
+				save, findAll, tx, findByID := spans[0], spans[1], spans[2], spans[3]
+				So(tx.Name, ShouldEqual, "posts.InTransaction")
+				So(tx.ParentID, ShouldBeEmpty)
+				So(save.Name, ShouldEqual, "posts.Save")
+				So(findAll.Name, ShouldEqual, "posts.FindAll")
+				for _, span := range []tracing.SpanData{save, findAll} {
+					So(span.TraceID, ShouldEqual, tx.TraceID)
+					So(span.ParentID, ShouldEqual, tx.SpanID)
+					So(span.Start, ShouldHappenOnOrAfter, tx.Start)
+					So(span.End, ShouldHappenOnOrBefore, tx.End)
+				}
+				So(findByID.ParentID, ShouldBeEmpty)
+				So(findByID.TraceID, ShouldNotEqual, tx.TraceID)
+			})
+
+			Convey("Should annotate the spans with the backend, the table and the rows", func() {
+				So(spans[1].Attributes, ShouldResemble, tracing.Attributes{"db.system": "memory", "db.table": "posts", "db.rows": int64(1)})
+			})
+
+			Convey("Should record the errors", func() {
+				So(errors.Is(findErr, models.ErrNotFound), ShouldBeTrue)
+				So(spans[3].Err, ShouldEqual, findErr)
+				So(spans[3].Attributes, ShouldNotContainKey, "db.rows")
+				So(spans[2].Err, ShouldBeNil)
+			})
+		})
+
+		Convey("Test transaction options", func() {
+			opts := models.TxOptions{Isolation: models.IsolationSerializable, Timeout: 20 * time.Millisecond}
+
+			Convey("Should commit within the timeout", func() {
+				p := &models.Post{Title: "implement repository pattern in go"}
+				try(postRepo.InTransactionWithOptions(context.Background(), opts, func(ctx context.Context) error {
+					return postRepo.Save(ctx, p)
+				}))
+				_, err := postRepo.FindByID(context.Background(), p.ID)
+				So(err, ShouldBeNil)
+			})
+
+			Convey("Should roll back once the timeout elapsed", func() {
+				p := &models.Post{Title: "implement repository pattern in go"}
+				err := postRepo.InTransactionWithOptions(context.Background(), opts, func(ctx context.Context) error {
+					if err := postRepo.Save(ctx, p); err != nil {
+						return err
+					}
+					<-ctx.Done()
+					return nil
+				})
+				So(errors.Is(err, context.DeadlineExceeded), ShouldBeTrue)
+				_, err = postRepo.FindByID(context.Background(), p.ID)
+				So(errors.Is(err, models.ErrNotFound), ShouldBeTrue)
+			})
+		})
+
+		Convey("Test transaction isolation", func() {
+			p := &models.Post{Title: "before"}
+			try(postRepo.Save(context.Background(), p))
+
+			err := postRepo.InTransaction(context.Background(), func(ctx context.Context) error {
+				p.Title = "after"
+				if err := postRepo.Save(ctx, p); err != nil {
+					return err
+				}
+
+				inside, err := postRepo.FindByID(ctx, p.ID)
+				So(err, ShouldBeNil)
+				So(inside.Title, ShouldEqual, "after")
+
+				outside, err := postRepo.FindByID(context.Background(), p.ID)
+				So(err, ShouldBeNil)
+				So(outside.Title, ShouldEqual, "before")
+
+				try(postRepo.Delete(ctx, p.ID))
+				_, err = postRepo.FindByID(ctx, p.ID)
+				So(errors.Is(err, models.ErrNotFound), ShouldBeTrue)
+				return errors.New("should rollback")
+			})
+
+			Convey("Should keep committed data untouched", func() {
+				So(err, ShouldNotBeNil)
+
+				found, err := postRepo.FindByID(context.Background(), p.ID)
+				So(err, ShouldBeNil)
+				So(found.Title, ShouldEqual, "before")
+			})
+		})
+
+		Convey("Test concurrent transactions", func() {
+			var wg sync.WaitGroup
+			for i := 0; i < 50; i++ {
+				wg.Add(1)
+				go func(i int) {
+					defer wg.Done()
+					postRepo.InTransaction(context.Background(), func(ctx context.Context) error {
+						if err := postRepo.Save(ctx, &models.Post{Title: "concurrent"}); err != nil {
+							return err
+						}
+						if i%2 == 0 {
+							return errors.New("should rollback")
+						}
+						return nil
+					})
+				}(i)
+			}
+			wg.Wait()
+
+			Convey("Should fail the second commit of the same explicit id", func() {
+				err := postRepo.InTransaction(context.Background(), func(ctx context.Context) error {
+					if err := postRepo.Insert(ctx, &models.Post{ID: 1000, Title: "first"}); err != nil {
+						return err
+					}
+					return postRepo.InTransaction(context.Background(), func(ctx context.Context) error {
+						return postRepo.Insert(ctx, &models.Post{ID: 1000, Title: "second"})
+					})
+				})
+				So(errors.Is(err, memstore.ErrTxConflict), ShouldBeTrue)
+
+				found, err := postRepo.FindByID(context.Background(), 1000)
+				So(err, ShouldBeNil)
+				So(found.Title, ShouldEqual, "second")
+			})
+
+			Convey("Should let a single one of many transactions insert the same explicit id", func() {
+				var wg sync.WaitGroup
+				var committed atomic.Int32
+				for i := 0; i < 20; i++ {
+					wg.Add(1)
+					go func(i int) {
+						defer wg.Done()
+						err := postRepo.InTransaction(context.Background(), func(ctx context.Context) error {
+							return postRepo.Insert(ctx, &models.Post{ID: 2000, Title: fmt.Sprint("racer ", i)})
+						})
+						if err == nil {
+							committed.Add(1)
+						} else if !errors.Is(err, models.ErrConflict) {
+							panic(err)
+						}
+					}(i)
+				}
+				wg.Wait()
+				So(committed.Load(), ShouldEqual, 1)
+			})
+
+			Convey("Should not leave a comment under a post deleted concurrently", func() {
+				p := &models.Post{Title: "implement repository pattern in go"}
+				try(postRepo.Save(context.Background(), p))
+
+				err := postRepo.InTransaction(context.Background(), func(ctx context.Context) error {
+					if err := postRepo.Delete(ctx, p.ID); err != nil {
+						return err
+					}
+					return commentRepo.InTransaction(context.Background(), func(ctx context.Context) error {
+						return commentRepo.Save(ctx, &models.Comment{PostID: p.ID, Review: "yayy"})
+					})
+				})
+				So(errors.Is(err, memstore.ErrTxConflict), ShouldBeTrue)
+				_, err = postRepo.FindByID(context.Background(), p.ID)
+				So(err, ShouldBeNil)
+
+				err = commentRepo.InTransaction(context.Background(), func(ctx context.Context) error {
+					if err := commentRepo.Save(ctx, &models.Comment{PostID: p.ID, Review: "nayy"}); err != nil {
+						return err
+					}
+					return postRepo.InTransaction(context.Background(), func(ctx context.Context) error {
+						_, err := postRepo.DeleteCascade(ctx, p.ID)
+						return err
+					})
+				})
+				So(errors.Is(err, memstore.ErrTxConflict), ShouldBeTrue)
+				comments, err := commentRepo.FindAll(context.Background())
+				So(err, ShouldBeNil)
+				So(len(comments), ShouldEqual, 0)
+			})
+
+			Convey("Should refuse a comment under a missing post", func() {
+				err := commentRepo.Save(context.Background(), &models.Comment{PostID: 1000, Review: "orphan"})
+				So(errors.Is(err, models.ErrInvalidReference), ShouldBeTrue)
+			})
+
+			Convey("Should only persist committed transactions with unique ids", func() {
+				posts, err := postRepo.FindAll(context.Background())
+				So(err, ShouldBeNil)
+				So(len(posts), ShouldEqual, 25)
+
+				ids := map[int]bool{}
+				for _, p := range posts {
+					ids[p.ID] = true
+				}
+				So(len(ids), ShouldEqual, 25)
+			})
+		})
+	})
+}
+
+// countingPostRepository counts the FindByID calls reaching the repository behind a cache.
+type countingPostRepository struct {
+	models.PostRepository
+	finds atomic.Int32
+	delay time.Duration
+}
+
+func (r *countingPostRepository) FindByID(ctx context.Context, id int) (*models.Post, error) {
+	r.finds.Add(1)
+	time.Sleep(r.delay)
+	return r.PostRepository.FindByID(ctx, id)
+}
@@ -0,0 +1,26 @@
+package memstore
+
+import (
+	"context"
+)
+
+// SaveAll saves every m like Save. It should run in a transaction so a failure does not leave part of ms saved.
+func (t *Table[T, ID]) SaveAll(ctx context.Context, db Database, ms []*T) error {
+	for _, m := range ms {
+		if err := t.Save(ctx, db, m); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// InsertAll inserts every m like Insert. It should run in a transaction so a failure does not leave part of ms
+// inserted.
+func (t *Table[T, ID]) InsertAll(ctx context.Context, db Database, ms []*T) error {
+	for _, m := range ms {
+		if err := t.Insert(ctx, db, m); err != nil {
+			return err
+		}
+	}
+	return nil
+}
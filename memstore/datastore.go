@@ -0,0 +1,71 @@
+package memstore
+
+import (
+	"context"
+	"fmt"
+	"github.com/hendratommy/repository-pattern/models"
+)
+
+const (
+	PostTable    = "posts"
+	CommentTable = "comments"
+)
+
+var (
+	Posts    = NewTable[models.Post, int](PostTable)
+	Comments = NewTable[models.Comment, int](CommentTable).References("PostID", PostTable)
+)
+
+func FindPostByID(ctx context.Context, db Database, id int) (*models.Post, error) {
+	return Posts.FindByID(ctx, db, id)
+}
+
+func SavePost(ctx context.Context, db Database, p *models.Post) error {
+	return Posts.Save(ctx, db, p)
+}
+
+// DeletePost fails with models.ErrInvalidReference while the post still has comments, mirroring the foreign key of
+// the sql schema.
+func DeletePost(ctx context.Context, db Database, id int) error {
+	comments, err := FindCommentsByPostID(ctx, db, id)
+	if err != nil {
+		return err
+	}
+	if len(comments) > 0 {
+		return fmt.Errorf("%w: post %d still has comments", models.ErrInvalidReference, id)
+	}
+	return Posts.Delete(ctx, db, id)
+}
+
+// DeletePostCascade deletes the comments of the post then the post itself, returning how many comments were deleted.
+// It must run in a transaction to be atomic.
+func DeletePostCascade(ctx context.Context, db Database, id int) (int64, error) {
+	return DeletePostCascadeFrom(ctx, db, Posts, Comments, id)
+}
+
+// DeletePostCascadeFrom is DeletePostCascade on posts and comments, which soft delete and stamp the time as they are
+// configured, see SoftDelete and WithClock.
+func DeletePostCascadeFrom(ctx context.Context, db Database, posts *Table[models.Post, int], comments *Table[models.Comment, int], id int) (int64, error) {
+	n, err := comments.DeleteBy(ctx, db, models.Where(models.Eq("PostID", id)))
+	if err != nil {
+		return 0, err
+	}
+	if err := posts.Delete(ctx, db, id); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+func FindCommentsByPostID(ctx context.Context, db Database, postID int) ([]*models.Comment, error) {
+	return Comments.FindBy(ctx, db, func(c *models.Comment) bool {
+		return c.PostID == postID
+	})
+}
+
+func FindCommentPageByPostID(ctx context.Context, db Database, postID int, req models.PageRequest) (*models.Page[models.Comment], error) {
+	return Comments.FindPageBy(ctx, db, models.Where(models.Eq("PostID", postID)), req)
+}
+
+func SaveComment(ctx context.Context, db Database, c *models.Comment) error {
+	return Comments.Save(ctx, db, c)
+}
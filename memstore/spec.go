@@ -0,0 +1,230 @@
+package memstore
+
+import (
+	"context"
+	"fmt"
+	"github.com/hendratommy/repository-pattern/models"
+	"reflect"
+	"regexp"
+	"sort"
+	"time"
+)
+
+// Find returns every row matching spec.
+func (t *Table[T, ID]) Find(ctx context.Context, db Database, spec models.Spec) ([]*T, error) {
+	return t.find(ctx, db, spec, false)
+}
+
+// FindIncludingDeleted returns every row matching spec, soft deleted or not.
+func (t *Table[T, ID]) FindIncludingDeleted(ctx context.Context, db Database, spec models.Spec) ([]*T, error) {
+	return t.find(ctx, db, spec, true)
+}
+
+func (t *Table[T, ID]) find(ctx context.Context, db Database, spec models.Spec, withDeleted bool) ([]*T, error) {
+	match := func(*T) (bool, error) { return true, nil }
+	if spec.Where != nil {
+		var err error
+		if match, err = t.matcher(*spec.Where); err != nil {
+			return nil, err
+		}
+	}
+	for _, o := range spec.Orders {
+		if _, err := t.field(o.Field); err != nil {
+			return nil, err
+		}
+	}
+
+	var matchErr error
+	ms, err := t.findBy(ctx, db, func(m *T) bool {
+		ok, err := match(m)
+		if err != nil && matchErr == nil {
+			matchErr = err
+		}
+		return ok
+	}, withDeleted)
+	if err != nil {
+		return nil, err
+	}
+	if matchErr != nil {
+		return nil, matchErr
+	}
+
+	// rows come ordered by id, a stable sort keeps it as the last key
+	sort.SliceStable(ms, func(i, j int) bool {
+		for _, o := range spec.Orders {
+			a := reflect.ValueOf(ms[i]).Elem().FieldByName(o.Field)
+			b := reflect.ValueOf(ms[j]).Elem().FieldByName(o.Field)
+			n, _ := compare(a, b)
+			if n != 0 {
+				return n < 0 != o.Desc
+			}
+		}
+		return false
+	})
+	return ms, nil
+}
+
+// Count returns how many rows match spec, its order is ignored.
+func (t *Table[T, ID]) Count(ctx context.Context, db Database, spec models.Spec) (int64, error) {
+	ms, err := t.Find(ctx, db, models.Spec{Where: spec.Where})
+	return int64(len(ms)), err
+}
+
+// DeleteBy removes the rows matching spec, or sets their DeletedAt on a SoftDelete table, and returns how many there
+// were.
+func (t *Table[T, ID]) DeleteBy(ctx context.Context, db Database, spec models.Spec) (int64, error) {
+	ms, err := t.Find(ctx, db, models.Spec{Where: spec.Where})
+	if err != nil {
+		return 0, err
+	}
+	for _, m := range ms {
+		if err := t.Delete(ctx, db, t.id(m).Interface().(ID)); err != nil {
+			return 0, err
+		}
+	}
+	return int64(len(ms)), nil
+}
+
+func (t *Table[T, ID]) field(name string) (int, error) {
+	f, ok := reflect.TypeOf((*T)(nil)).Elem().FieldByName(name)
+	if !ok || len(f.Index) != 1 {
+		return 0, fmt.Errorf("%w: %s has no field %q", models.ErrInvalidSpec, t.Name, name)
+	}
+	return f.Index[0], nil
+}
+
+// matcher compiles c into a function reporting whether a row matches it.
+func (t *Table[T, ID]) matcher(c models.Criterion) (func(*T) (bool, error), error) {
+	switch c.Op {
+	case models.OpAnd, models.OpOr:
+		children := make([]func(*T) (bool, error), len(c.Children))
+		for i, child := range c.Children {
+			m, err := t.matcher(child)
+			if err != nil {
+				return nil, err
+			}
+			children[i] = m
+		}
+		all := c.Op == models.OpAnd
+		return func(m *T) (bool, error) {
+			for _, child := range children {
+				ok, err := child(m)
+				if err != nil || ok != all {
+					return ok, err
+				}
+			}
+			return all, nil
+		}, nil
+	}
+
+	i, err := t.field(c.Field)
+	if err != nil {
+		return nil, err
+	}
+	value := func(m *T) reflect.Value {
+		return reflect.ValueOf(m).Elem().Field(i)
+	}
+	cmp := func(m *T, v interface{}) (int, error) {
+		return compare(value(m), reflect.ValueOf(v))
+	}
+
+	switch c.Op {
+	case models.OpEq, models.OpIn:
+		return func(m *T) (bool, error) {
+			for _, v := range c.Values {
+				n, err := cmp(m, v)
+				if err != nil || n == 0 {
+					return err == nil, err
+				}
+			}
+			return false, nil
+		}, nil
+	case models.OpLike:
+		pattern, ok := c.Values[0].(string)
+		if !ok {
+			return nil, fmt.Errorf("%w: like pattern must be a string", models.ErrInvalidSpec)
+		}
+		re := regexp.MustCompile(models.LikeRegexp(pattern))
+		return func(m *T) (bool, error) {
+			v := value(m)
+			if v.Kind() != reflect.String {
+				return false, fmt.Errorf("%w: %s is not a string", models.ErrInvalidSpec, c.Field)
+			}
+			return re.MatchString(v.String()), nil
+		}, nil
+	case models.OpRange:
+		from, to := c.Values[0], c.Values[1]
+		return func(m *T) (bool, error) {
+			if from != nil {
+				if n, err := cmp(m, from); err != nil || n < 0 {
+					return false, err
+				}
+			}
+			if to != nil {
+				if n, err := cmp(m, to); err != nil || n >= 0 {
+					return false, err
+				}
+			}
+			return true, nil
+		}, nil
+	}
+	return nil, fmt.Errorf("%w: unknown operator %d", models.ErrInvalidSpec, c.Op)
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// compare orders a and b like a database would, numbers of any kind compare by value.
+func compare(a, b reflect.Value) (int, error) {
+	sign := func(less, greater bool) int {
+		switch {
+		case less:
+			return -1
+		case greater:
+			return 1
+		}
+		return 0
+	}
+	if !b.IsValid() {
+		return 0, fmt.Errorf("%w: cannot compare %s with nil", models.ErrInvalidSpec, a.Type())
+	}
+	switch {
+	case isInt(a) && isInt(b):
+		return sign(a.Int() < b.Int(), a.Int() > b.Int()), nil
+	case isNumber(a) && isNumber(b):
+		x, y := toFloat(a), toFloat(b)
+		return sign(x < y, x > y), nil
+	case a.Kind() == reflect.String && b.Kind() == reflect.String:
+		return sign(a.String() < b.String(), a.String() > b.String()), nil
+	case a.Kind() == reflect.Bool && b.Kind() == reflect.Bool:
+		return sign(!a.Bool() && b.Bool(), a.Bool() && !b.Bool()), nil
+	case a.Type() == timeType && b.Type() == timeType:
+		return a.Interface().(time.Time).Compare(b.Interface().(time.Time)), nil
+	}
+	return 0, fmt.Errorf("%w: cannot compare %s with %s", models.ErrInvalidSpec, a.Type(), b.Type())
+}
+
+func isInt(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return true
+	}
+	return false
+}
+
+func isNumber(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Float32, reflect.Float64:
+		return true
+	}
+	return isInt(v)
+}
+
+func toFloat(v reflect.Value) float64 {
+	switch v.Kind() {
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(v.Uint())
+	case reflect.Float32, reflect.Float64:
+		return v.Float()
+	}
+	return float64(v.Int())
+}
@@ -0,0 +1,395 @@
+// In-memory datastore, meant for tests and prototyping where running postgres or mongodb is not an option
+package memstore
+
+import (
+	"errors"
+	"fmt"
+	"github.com/hendratommy/repository-pattern/models"
+	"sync"
+)
+
+var ErrTxDone = errors.New("transaction has already been committed or rolled back")
+
+// ErrTxConflict fails the Commit of a transaction that read or wrote data another transaction changed and committed
+// since, running the transaction again may succeed.
+var ErrTxConflict = fmt.Errorf("%w: data changed by a concurrent transaction", models.ErrConflict)
+
+// Database is implemented by DB and Tx, so datastore operations run the same way inside and outside a transaction.
+type Database interface {
+	get(table string, id interface{}) (interface{}, bool, error)
+	rows(table string) ([]interface{}, error)
+	put(table string, id interface{}, row interface{}) error
+	// insert only writes when there is no row with id and reports if it did
+	insert(table string, id interface{}, row interface{}) (bool, error)
+	// update replaces the row with id by the one fn makes out of it, unless fn refuses, it reports whether the row was
+	// found and whether it was written
+	update(table string, id interface{}, fn func(old interface{}) (interface{}, bool)) (bool, bool, error)
+	remove(table string, id interface{}) (bool, error)
+	nextID(table string) int
+	syncID(table string, id int)
+}
+
+type table struct {
+	rows map[interface{}]interface{}
+	// versions holds the version of every row ever written, deleted ones included, version counts the writes to the
+	// table. A row that was never written is at version 0.
+	versions map[interface{}]uint64
+	version  uint64
+	seq      int
+}
+
+// touch records a write of the row with id.
+func (t *table) touch(id interface{}) {
+	t.version++
+	t.versions[id] = t.version
+}
+
+// DB holds every table in memory, it is safe for concurrent use.
+type DB struct {
+	mu     sync.RWMutex
+	tables map[string]*table
+}
+
+func New() *DB {
+	return &DB{tables: map[string]*table{}}
+}
+
+// table must be called with mu held for writing.
+func (db *DB) table(name string) *table {
+	t, ok := db.tables[name]
+	if !ok {
+		t = &table{rows: map[interface{}]interface{}{}, versions: map[interface{}]uint64{}}
+		db.tables[name] = t
+	}
+	return t
+}
+
+func (db *DB) get(table string, id interface{}) (interface{}, bool, error) {
+	row, ok, _ := db.read(table, id)
+	return row, ok, nil
+}
+
+// read returns the row with id along with its version.
+func (db *DB) read(table string, id interface{}) (interface{}, bool, uint64) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	t, ok := db.tables[table]
+	if !ok {
+		return nil, false, 0
+	}
+	row, ok := t.rows[id]
+	return row, ok, t.versions[id]
+}
+
+func (db *DB) rows(table string) ([]interface{}, error) {
+	rows, _ := db.scan(table, nil)
+	return rows, nil
+}
+
+// scan returns the rows of table but those with an id in skip, along with the version of the table.
+func (db *DB) scan(table string, skip map[interface{}]interface{}) ([]interface{}, uint64) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	t, ok := db.tables[table]
+	if !ok {
+		return nil, 0
+	}
+	rows := make([]interface{}, 0, len(t.rows))
+	for id, row := range t.rows {
+		if _, ok := skip[id]; !ok {
+			rows = append(rows, row)
+		}
+	}
+	return rows, t.version
+}
+
+func (db *DB) put(table string, id interface{}, row interface{}) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	t := db.table(table)
+	t.rows[id] = row
+	t.touch(id)
+	return nil
+}
+
+func (db *DB) insert(table string, id interface{}, row interface{}) (bool, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	t := db.table(table)
+	if _, ok := t.rows[id]; ok {
+		return false, nil
+	}
+	t.rows[id] = row
+	t.touch(id)
+	return true, nil
+}
+
+func (db *DB) update(table string, id interface{}, fn func(interface{}) (interface{}, bool)) (bool, bool, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	t := db.table(table)
+	old, ok := t.rows[id]
+	if !ok {
+		return false, false, nil
+	}
+	row, ok := fn(old)
+	if !ok {
+		return true, false, nil
+	}
+	t.rows[id] = row
+	t.touch(id)
+	return true, true, nil
+}
+
+func (db *DB) remove(table string, id interface{}) (bool, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	t := db.table(table)
+	_, ok := t.rows[id]
+	if ok {
+		delete(t.rows, id)
+		t.touch(id)
+	}
+	return ok, nil
+}
+
+// nextID works like a serial column, values handed out are never reused even when the transaction rolls back.
+func (db *DB) nextID(table string) int {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	t := db.table(table)
+	t.seq++
+	return t.seq
+}
+
+// syncID moves the serial past an id inserted explicitly.
+func (db *DB) syncID(table string, id int) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if t := db.table(table); id > t.seq {
+		t.seq = id
+	}
+}
+
+// Begin starts a transaction, changes made through it are invisible to others until Commit.
+func (db *DB) Begin() *Tx {
+	return &Tx{
+		db: db, writes: map[string]map[interface{}]interface{}{},
+		bases: map[string]map[interface{}]uint64{}, scans: map[string]uint64{},
+	}
+}
+
+// Tx buffers its own copy of every written row (a nil row marks a deletion) on top of the committed data in DB.
+// It records the version of every row it read or wrote when it first did, and of every table it scanned, Commit fails
+// when one of them moved since. It is safe for concurrent use.
+type Tx struct {
+	db     *DB
+	mu     sync.Mutex
+	writes map[string]map[interface{}]interface{}
+	bases  map[string]map[interface{}]uint64
+	scans  map[string]uint64
+	done   bool
+}
+
+func (tx *Tx) get(table string, id interface{}) (interface{}, bool, error) {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+	if tx.done {
+		return nil, false, ErrTxDone
+	}
+	row, ok := tx.read(table, id)
+	return row, ok, nil
+}
+
+func (tx *Tx) rows(table string) ([]interface{}, error) {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+	if tx.done {
+		return nil, ErrTxDone
+	}
+	writes := tx.writes[table]
+	rows, version := tx.db.scan(table, writes)
+	if _, ok := tx.scans[table]; !ok {
+		tx.scans[table] = version
+	}
+	for _, row := range writes {
+		if row != nil {
+			rows = append(rows, row)
+		}
+	}
+	return rows, nil
+}
+
+func (tx *Tx) put(table string, id interface{}, row interface{}) error {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+	if tx.done {
+		return ErrTxDone
+	}
+	tx.write(table, id, row)
+	return nil
+}
+
+func (tx *Tx) insert(table string, id interface{}, row interface{}) (bool, error) {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+	if tx.done {
+		return false, ErrTxDone
+	}
+	if _, ok := tx.read(table, id); ok {
+		return false, nil
+	}
+	tx.write(table, id, row)
+	return true, nil
+}
+
+func (tx *Tx) update(table string, id interface{}, fn func(interface{}) (interface{}, bool)) (bool, bool, error) {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+	if tx.done {
+		return false, false, ErrTxDone
+	}
+	old, ok := tx.read(table, id)
+	if !ok {
+		return false, false, nil
+	}
+	row, ok := fn(old)
+	if !ok {
+		return true, false, nil
+	}
+	tx.write(table, id, row)
+	return true, true, nil
+}
+
+func (tx *Tx) remove(table string, id interface{}) (bool, error) {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+	if tx.done {
+		return false, ErrTxDone
+	}
+	if _, ok := tx.read(table, id); !ok {
+		return false, nil
+	}
+	tx.write(table, id, nil)
+	return true, nil
+}
+
+// read returns the row with id as the transaction sees it, recording the version it was read at. It must be called
+// with mu held.
+func (tx *Tx) read(table string, id interface{}) (interface{}, bool) {
+	if row, ok := tx.writes[table][id]; ok {
+		return row, row != nil
+	}
+	row, ok, version := tx.db.read(table, id)
+	tx.base(table, id, version)
+	return row, ok
+}
+
+// base records version as the version of the row with id the transaction started from, unless it already has one. It
+// must be called with mu held.
+func (tx *Tx) base(table string, id interface{}, version uint64) {
+	b, ok := tx.bases[table]
+	if !ok {
+		b = map[interface{}]uint64{}
+		tx.bases[table] = b
+	}
+	if _, ok := b[id]; !ok {
+		b[id] = version
+	}
+}
+
+// write must be called with mu held.
+func (tx *Tx) write(table string, id interface{}, row interface{}) {
+	if _, ok := tx.bases[table][id]; !ok {
+		_, _, version := tx.db.read(table, id)
+		tx.base(table, id, version)
+	}
+	w, ok := tx.writes[table]
+	if !ok {
+		w = map[interface{}]interface{}{}
+		tx.writes[table] = w
+	}
+	w[id] = row
+}
+
+func (tx *Tx) nextID(table string) int {
+	return tx.db.nextID(table)
+}
+
+func (tx *Tx) syncID(table string, id int) {
+	tx.db.syncID(table, id)
+}
+
+// Commit atomically applies every buffered write to DB. It fails, rolling the transaction back, with
+// models.ErrStaleVersion when a row it updated was updated by another transaction committed since, and with
+// ErrTxConflict when anything else it read or wrote changed since.
+func (tx *Tx) Commit() error {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+	if tx.done {
+		return ErrTxDone
+	}
+	tx.done = true
+	defer func() {
+		tx.writes, tx.bases, tx.scans = nil, nil, nil
+	}()
+
+	tx.db.mu.Lock()
+	defer tx.db.mu.Unlock()
+	if err := tx.validate(); err != nil {
+		return err
+	}
+	for name, writes := range tx.writes {
+		t := tx.db.table(name)
+		for id, row := range writes {
+			if row == nil {
+				delete(t.rows, id)
+			} else {
+				t.rows[id] = row
+			}
+			t.touch(id)
+		}
+	}
+	return nil
+}
+
+// validate checks that nothing the transaction read or wrote changed since, it must be called with mu and db.mu held.
+func (tx *Tx) validate() error {
+	for name, bases := range tx.bases {
+		t := tx.db.tables[name]
+		for id, base := range bases {
+			var version uint64
+			if t != nil {
+				version = t.versions[id]
+			}
+			if version == base {
+				continue
+			}
+			// a row updated on top of a row updated since is a lost update, which optimistic locking reports
+			if row, ok := tx.writes[name][id]; ok && row != nil && base != 0 {
+				if _, ok := t.rows[id]; ok {
+					return fmt.Errorf("%w: %s %v was updated by a concurrent transaction", models.ErrStaleVersion, name, id)
+				}
+			}
+			return fmt.Errorf("%w: %s %v", ErrTxConflict, name, id)
+		}
+	}
+	for name, base := range tx.scans {
+		if t := tx.db.tables[name]; t != nil && t.version != base {
+			return fmt.Errorf("%w: %s", ErrTxConflict, name)
+		}
+	}
+	return nil
+}
+
+// Rollback discards every buffered write.
+func (tx *Tx) Rollback() error {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+	if tx.done {
+		return ErrTxDone
+	}
+	tx.done = true
+	tx.writes, tx.bases, tx.scans = nil, nil, nil
+	return nil
+}
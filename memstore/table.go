@@ -0,0 +1,503 @@
+package memstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/hendratommy/repository-pattern/models"
+	"reflect"
+	"sort"
+	"time"
+)
+
+var ErrNoRows = fmt.Errorf("%w: no rows in result set", models.ErrNotFound)
+
+const (
+	idField        = "ID"
+	versionField   = "Version"
+	deletedAtField = "DeletedAt"
+	createdAtField = "CreatedAt"
+	updatedAtField = "UpdatedAt"
+)
+
+// Table stores values of model T keyed by its ID field. Rows are copied in and out, but not what their pointer fields
+// point to. When ID is an int, saving a row with a zero ID assigns the next value of the table serial.
+// An int Version field turns on optimistic locking, see models.ErrStaleVersion. A *time.Time DeletedAt field is only
+// written by Delete, Restore and Purge, see SoftDelete. time.Time CreatedAt and UpdatedAt fields are set on insert,
+// and UpdatedAt again on every update. See References for foreign keys.
+type Table[T any, ID comparable] struct {
+	Name           string
+	references     []reference
+	idField        int
+	versionField   int
+	deletedAtField int
+	createdAtField int
+	updatedAtField int
+	softDelete     bool
+	serial         bool
+	now            func() time.Time
+}
+
+// NewTable creates Table for model T, it panics when T is not a struct or has no ID field.
+func NewTable[T any, ID comparable](name string) *Table[T, ID] {
+	rt := reflect.TypeOf((*T)(nil)).Elem()
+	if rt.Kind() != reflect.Struct {
+		panic(fmt.Sprintf("memstore: %s is not a struct", rt))
+	}
+	f, ok := rt.FieldByName(idField)
+	if !ok || len(f.Index) != 1 {
+		panic(fmt.Sprintf("memstore: %s has no %s field", rt, idField))
+	}
+	t := &Table[T, ID]{
+		Name: name, idField: f.Index[0], versionField: -1, deletedAtField: -1, createdAtField: -1, updatedAtField: -1,
+		serial: f.Type.Kind() == reflect.Int, now: time.Now,
+	}
+	if f, ok := rt.FieldByName(versionField); ok && len(f.Index) == 1 && f.Type.Kind() == reflect.Int {
+		t.versionField = f.Index[0]
+	}
+	if f, ok := rt.FieldByName(deletedAtField); ok && len(f.Index) == 1 && f.Type == reflect.TypeOf((*time.Time)(nil)) {
+		t.deletedAtField = f.Index[0]
+	}
+	if f, ok := rt.FieldByName(createdAtField); ok && len(f.Index) == 1 && f.Type == timeType {
+		t.createdAtField = f.Index[0]
+	}
+	if f, ok := rt.FieldByName(updatedAtField); ok && len(f.Index) == 1 && f.Type == timeType {
+		t.updatedAtField = f.Index[0]
+	}
+	return t
+}
+
+// SoftDelete returns a copy of t whose Delete sets DeletedAt instead of removing the row, every finder of the copy
+// then leaves out the rows with a DeletedAt. It panics when T has no *time.Time DeletedAt field.
+func (t *Table[T, ID]) SoftDelete() *Table[T, ID] {
+	if t.deletedAtField < 0 {
+		panic(fmt.Sprintf("memstore: %s has no %s field", t.Name, deletedAtField))
+	}
+	soft := *t
+	soft.softDelete = true
+	return &soft
+}
+
+type reference struct {
+	field int
+	table string
+}
+
+// References returns a copy of t whose writes fail with models.ErrInvalidReference unless table has a row with the
+// id held by field, mirroring a foreign key of the sql schema. It panics when T has no such field.
+func (t *Table[T, ID]) References(field, table string) *Table[T, ID] {
+	f, ok := reflect.TypeOf((*T)(nil)).Elem().FieldByName(field)
+	if !ok || len(f.Index) != 1 {
+		panic(fmt.Sprintf("memstore: %s has no %s field", t.Name, field))
+	}
+	c := *t
+	c.references = append(append([]reference(nil), t.references...), reference{field: f.Index[0], table: table})
+	return &c
+}
+
+// checkReferences fails with models.ErrInvalidReference when a row m references is missing. Within a transaction the
+// rows are read, so a concurrent delete of one of them makes the commit fail.
+func (t *Table[T, ID]) checkReferences(db Database, m *T) error {
+	for _, ref := range t.references {
+		id := reflect.ValueOf(m).Elem().Field(ref.field).Interface()
+		_, ok, err := db.get(ref.table, id)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return fmt.Errorf("%w: %s %v does not exist", models.ErrInvalidReference, ref.table, id)
+		}
+	}
+	return nil
+}
+
+// WithClock returns a copy of t taking the time of its timestamps from now.
+func (t *Table[T, ID]) WithClock(now func() time.Time) *Table[T, ID] {
+	c := *t
+	c.now = now
+	return &c
+}
+
+func (t *Table[T, ID]) clock() time.Time {
+	return t.now().UTC()
+}
+
+// stamp sets the CreatedAt of m and its UpdatedAt when they are zero.
+func (t *Table[T, ID]) stamp(m *T, now time.Time) {
+	v := reflect.ValueOf(m).Elem()
+	if t.createdAtField >= 0 && v.Field(t.createdAtField).IsZero() {
+		v.Field(t.createdAtField).Set(reflect.ValueOf(now))
+	}
+	if t.updatedAtField >= 0 && v.Field(t.updatedAtField).IsZero() {
+		v.Field(t.updatedAtField).Set(reflect.ValueOf(now))
+	}
+}
+
+// keep copies into m the fields only written on insert or by Delete, Restore and Purge from the stored row old.
+func (t *Table[T, ID]) keep(m, old *T) {
+	v, o := reflect.ValueOf(m).Elem(), reflect.ValueOf(old).Elem()
+	for _, i := range []int{t.createdAtField, t.deletedAtField} {
+		if i >= 0 {
+			v.Field(i).Set(o.Field(i))
+		}
+	}
+}
+
+func (t *Table[T, ID]) deletedAt(m *T) reflect.Value {
+	return reflect.ValueOf(m).Elem().Field(t.deletedAtField)
+}
+
+// hidden reports whether m is soft deleted and t leaves it out.
+func (t *Table[T, ID]) hidden(m *T) bool {
+	return t.softDelete && !t.deletedAt(m).IsNil()
+}
+
+func (t *Table[T, ID]) version(m *T) reflect.Value {
+	return reflect.ValueOf(m).Elem().Field(t.versionField)
+}
+
+func (t *Table[T, ID]) id(m *T) reflect.Value {
+	return reflect.ValueOf(m).Elem().Field(t.idField)
+}
+
+func (t *Table[T, ID]) FindByID(ctx context.Context, db Database, id ID) (*T, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	row, ok, err := db.get(t.Name, id)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrNoRows
+	}
+	m := row.(T)
+	if t.hidden(&m) {
+		return nil, ErrNoRows
+	}
+	return &m, nil
+}
+
+func (t *Table[T, ID]) Exists(ctx context.Context, db Database, id ID) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	row, ok, err := db.get(t.Name, id)
+	if err != nil || !ok {
+		return false, err
+	}
+	m := row.(T)
+	return !t.hidden(&m), nil
+}
+
+func (t *Table[T, ID]) FindAll(ctx context.Context, db Database) ([]*T, error) {
+	return t.FindBy(ctx, db, func(*T) bool { return true })
+}
+
+// FindBy returns every row matching fn ordered by id.
+func (t *Table[T, ID]) FindBy(ctx context.Context, db Database, fn func(*T) bool) ([]*T, error) {
+	return t.findBy(ctx, db, fn, false)
+}
+
+func (t *Table[T, ID]) findBy(ctx context.Context, db Database, fn func(*T) bool, withDeleted bool) ([]*T, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	rows, err := db.rows(t.Name)
+	if err != nil {
+		return nil, err
+	}
+	var ms []*T
+	for _, row := range rows {
+		m := row.(T)
+		if (withDeleted || !t.hidden(&m)) && fn(&m) {
+			ms = append(ms, &m)
+		}
+	}
+	sort.Slice(ms, func(i, j int) bool {
+		return less(t.id(ms[i]), t.id(ms[j]))
+	})
+	return ms, nil
+}
+
+// FindPage returns a page of rows ordered by id.
+func (t *Table[T, ID]) FindPage(ctx context.Context, db Database, req models.PageRequest) (*models.Page[T], error) {
+	return t.FindPageBy(ctx, db, models.All(), req)
+}
+
+// FindPageBy returns a page of the rows matching spec in the order of req, the order of spec is ignored.
+func (t *Table[T, ID]) FindPageBy(ctx context.Context, db Database, spec models.Spec, req models.PageRequest) (*models.Page[T], error) {
+	key := -1
+	if req.OrderBy.Field != "" && req.OrderBy.Field != idField {
+		var err error
+		if key, err = t.field(req.OrderBy.Field); err != nil {
+			return nil, err
+		}
+	}
+	orders := []models.Order{{Field: idField, Desc: req.OrderBy.Desc}}
+	if key >= 0 {
+		orders = append([]models.Order{req.OrderBy}, orders...)
+	}
+	ms, err := t.Find(ctx, db, models.Spec{Where: spec.Where, Orders: orders})
+	if err != nil {
+		return nil, err
+	}
+	if req.Cursor != "" {
+		var value reflect.Value
+		var after ID
+		if key >= 0 {
+			value = reflect.New(reflect.TypeOf((*T)(nil)).Elem().Field(key).Type)
+			after, err = models.DecodeCursor[ID](req.Cursor, value.Interface())
+			value = value.Elem()
+		} else {
+			after, err = models.DecodeCursor[ID](req.Cursor, nil)
+		}
+		if err != nil {
+			return nil, err
+		}
+		a := reflect.ValueOf(after)
+		ms = ms[sort.Search(len(ms), func(i int) bool {
+			if key >= 0 {
+				n, _ := compare(reflect.ValueOf(ms[i]).Elem().Field(key), value)
+				if n != 0 {
+					return n > 0 != req.OrderBy.Desc
+				}
+			}
+			id := t.id(ms[i])
+			if req.OrderBy.Desc {
+				return less(id, a)
+			}
+			return less(a, id)
+		}):]
+	}
+	if req.Offset >= len(ms) {
+		ms = nil
+	} else if req.Offset > 0 {
+		ms = ms[req.Offset:]
+	}
+	if len(ms) > req.Size()+1 {
+		ms = ms[:req.Size()+1]
+	}
+	return models.NewPage(req, ms, func(m *T) string {
+		if key < 0 {
+			return models.EncodeCursor(t.id(m).Interface().(ID), nil)
+		}
+		return models.EncodeCursor(t.id(m).Interface().(ID), reflect.ValueOf(m).Elem().Field(key).Interface())
+	}), nil
+}
+
+// Save inserts m when its id is zero, otherwise it inserts or replaces the row with that id. On a versioned table a
+// replace fails with models.ErrStaleVersion when the row was changed since m was read.
+func (t *Table[T, ID]) Save(ctx context.Context, db Database, m *T) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	id := t.id(m)
+	if id.IsZero() {
+		return t.Insert(ctx, db, m)
+	}
+	if t.versionField >= 0 {
+		if err := t.Update(ctx, db, m); !errors.Is(err, models.ErrNotFound) {
+			return err
+		}
+		return t.Insert(ctx, db, m)
+	}
+	now := t.clock()
+	row := *m
+	t.stamp(&row, now)
+	if t.updatedAtField >= 0 {
+		reflect.ValueOf(&row).Elem().Field(t.updatedAtField).Set(reflect.ValueOf(now))
+	}
+	if err := t.checkReferences(db, &row); err != nil {
+		return err
+	}
+	hidden := false
+	found, _, err := db.update(t.Name, id.Interface(), func(old interface{}) (interface{}, bool) {
+		o := old.(T)
+		if hidden = t.hidden(&o); hidden {
+			return nil, false
+		}
+		t.keep(&row, &o)
+		return row, true
+	})
+	if err != nil {
+		return err
+	}
+	if hidden {
+		return fmt.Errorf("%w: %s %v is deleted", models.ErrConflict, t.Name, id.Interface())
+	}
+	if !found {
+		return t.Insert(ctx, db, m)
+	}
+	*m = row
+	return nil
+}
+
+// Insert inserts m, it returns models.ErrConflict when a row with the same id already exists. On a versioned table m
+// starts at version 1.
+func (t *Table[T, ID]) Insert(ctx context.Context, db Database, m *T) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	id := t.id(m)
+	if t.serial {
+		if id.IsZero() {
+			id.SetInt(int64(db.nextID(t.Name)))
+		} else {
+			db.syncID(t.Name, int(id.Int()))
+		}
+	}
+	row := *m
+	t.stamp(&row, t.clock())
+	if t.versionField >= 0 {
+		t.version(&row).SetInt(1)
+	}
+	if err := t.checkReferences(db, &row); err != nil {
+		return err
+	}
+	ok, err := db.insert(t.Name, id.Interface(), row)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("%w: %s %v already exists", models.ErrConflict, t.Name, id.Interface())
+	}
+	*m = row
+	return nil
+}
+
+// Update replaces the row with the id of m, it returns models.ErrNotFound when there is none. On a versioned table
+// only the row still at the version of m is replaced, the version is incremented in the row and in m, otherwise it
+// returns models.ErrStaleVersion. The UpdatedAt of m is set to now, its CreatedAt is kept from the row.
+func (t *Table[T, ID]) Update(ctx context.Context, db Database, m *T) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	id := t.id(m).Interface()
+	row := *m
+	if t.updatedAtField >= 0 {
+		reflect.ValueOf(&row).Elem().Field(t.updatedAtField).Set(reflect.ValueOf(t.clock()))
+	}
+	var version int64
+	if t.versionField >= 0 {
+		version = t.version(m).Int()
+		t.version(&row).SetInt(version + 1)
+	}
+	if err := t.checkReferences(db, &row); err != nil {
+		return err
+	}
+	hidden := false
+	found, ok, err := db.update(t.Name, id, func(old interface{}) (interface{}, bool) {
+		o := old.(T)
+		if hidden = t.hidden(&o); hidden {
+			return nil, false
+		}
+		if t.versionField >= 0 && t.version(&o).Int() != version {
+			return nil, false
+		}
+		t.keep(&row, &o)
+		return row, true
+	})
+	if err != nil {
+		return err
+	}
+	if !found || hidden {
+		return fmt.Errorf("%w: %s %v", models.ErrNotFound, t.Name, id)
+	}
+	if !ok {
+		return fmt.Errorf("%w: %s %v at version %d", models.ErrStaleVersion, t.Name, id, version)
+	}
+	*m = row
+	return nil
+}
+
+// Delete removes the row with id, or sets its DeletedAt on a SoftDelete table. It returns models.ErrNotFound when
+// there is none.
+func (t *Table[T, ID]) Delete(ctx context.Context, db Database, id ID) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if t.softDelete {
+		now := t.clock()
+		return t.setDeletedAt(db, id, &now)
+	}
+	ok, err := db.remove(t.Name, id)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("%w: %s %v", models.ErrNotFound, t.Name, id)
+	}
+	return nil
+}
+
+// Restore clears the DeletedAt of the row with id, it returns models.ErrNotFound when there is no such deleted row.
+func (t *Table[T, ID]) Restore(ctx context.Context, db Database, id ID) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if t.deletedAtField < 0 {
+		return fmt.Errorf("memstore: %s has no %s field", t.Name, deletedAtField)
+	}
+	return t.setDeletedAt(db, id, nil)
+}
+
+// setDeletedAt sets the DeletedAt of the row with id to at, provided it is not already deleted, or restored when at is
+// nil.
+func (t *Table[T, ID]) setDeletedAt(db Database, id ID, at *time.Time) error {
+	found, ok, err := db.update(t.Name, id, func(old interface{}) (interface{}, bool) {
+		o := old.(T)
+		v := t.deletedAt(&o)
+		if v.IsNil() == (at == nil) {
+			return nil, false
+		}
+		v.Set(reflect.ValueOf(at))
+		return o, true
+	})
+	if err != nil {
+		return err
+	}
+	if !found || !ok {
+		return fmt.Errorf("%w: %s %v", models.ErrNotFound, t.Name, id)
+	}
+	return nil
+}
+
+// Purge removes the rows deleted more than olderThan ago and returns how many there were.
+func (t *Table[T, ID]) Purge(ctx context.Context, db Database, olderThan time.Duration) (int64, error) {
+	if t.deletedAtField < 0 {
+		return 0, fmt.Errorf("memstore: %s has no %s field", t.Name, deletedAtField)
+	}
+	cutoff := t.clock().Add(-olderThan)
+	ms, err := t.findBy(ctx, db, func(m *T) bool {
+		at := t.deletedAt(m)
+		return !at.IsNil() && at.Interface().(*time.Time).Before(cutoff)
+	}, true)
+	if err != nil {
+		return 0, err
+	}
+	var n int64
+	for _, m := range ms {
+		ok, err := db.remove(t.Name, t.id(m).Interface())
+		if err != nil {
+			return n, err
+		}
+		if ok {
+			n++
+		}
+	}
+	return n, nil
+}
+
+func less(a, b reflect.Value) bool {
+	switch a.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return a.Int() < b.Int()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return a.Uint() < b.Uint()
+	case reflect.String:
+		return a.String() < b.String()
+	default:
+		return fmt.Sprint(a.Interface()) < fmt.Sprint(b.Interface())
+	}
+}
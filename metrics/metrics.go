@@ -0,0 +1,54 @@
+// Package metrics is the small interface instrumented repositories record into, with an in process Registry that
+// exports in the Prometheus text format.
+package metrics
+
+import (
+	"sort"
+	"strings"
+)
+
+// Labels tell apart the series of a metric, like the operation of a repository.
+type Labels map[string]string
+
+// Metrics records counters and histograms by name, names and label names follow the Prometheus conventions.
+// Implementations must be safe for concurrent use.
+type Metrics interface {
+	// Inc adds 1 to the counter name.
+	Inc(name string, labels Labels)
+	// Observe adds value to the histogram name.
+	Observe(name string, labels Labels, value float64)
+}
+
+// Discard records nothing.
+var Discard Metrics = discard{}
+
+type discard struct{}
+
+func (discard) Inc(string, Labels) {}
+
+func (discard) Observe(string, Labels, float64) {}
+
+// key renders labels sorted by name in the Prometheus syntax, it identifies a series of a metric.
+func (l Labels) key() string {
+	if len(l) == 0 {
+		return ""
+	}
+	names := make([]string, 0, len(l))
+	for name := range l {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var b strings.Builder
+	for i, name := range names {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(name)
+		b.WriteString(`="`)
+		b.WriteString(escaper.Replace(l[name]))
+		b.WriteByte('"')
+	}
+	return b.String()
+}
+
+var escaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
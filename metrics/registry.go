@@ -0,0 +1,175 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+// DefaultBuckets are the upper bounds, in seconds, of the histograms of a Registry, the Prometheus defaults.
+var DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// Registry keeps metrics in memory and writes them in the Prometheus text format, it is an http.Handler serving them.
+type Registry struct {
+	mu         sync.Mutex
+	help       map[string]string
+	counters   map[string]map[string]float64
+	histograms map[string]map[string]*histogram
+	buckets    []float64
+}
+
+type histogram struct {
+	counts []uint64 // per bucket, not cumulated, the last one counting what is above every bound
+	count  uint64
+	sum    float64
+}
+
+// NewRegistry creates an empty Registry with histograms of buckets, DefaultBuckets when there are none.
+func NewRegistry(buckets ...float64) *Registry {
+	if len(buckets) == 0 {
+		buckets = DefaultBuckets
+	}
+	buckets = append([]float64(nil), buckets...)
+	sort.Float64s(buckets)
+	return &Registry{
+		help:       map[string]string{},
+		counters:   map[string]map[string]float64{},
+		histograms: map[string]map[string]*histogram{},
+		buckets:    buckets,
+	}
+}
+
+// Help sets the description exported along with the metric name.
+func (r *Registry) Help(name, help string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.help[name] = help
+}
+
+func (r *Registry) Inc(name string, labels Labels) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	series, ok := r.counters[name]
+	if !ok {
+		series = map[string]float64{}
+		r.counters[name] = series
+	}
+	series[labels.key()]++
+}
+
+func (r *Registry) Observe(name string, labels Labels, value float64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	series, ok := r.histograms[name]
+	if !ok {
+		series = map[string]*histogram{}
+		r.histograms[name] = series
+	}
+	h, ok := series[labels.key()]
+	if !ok {
+		h = &histogram{counts: make([]uint64, len(r.buckets)+1)}
+		series[labels.key()] = h
+	}
+	h.counts[sort.SearchFloat64s(r.buckets, value)]++
+	h.count++
+	h.sum += value
+}
+
+// Counter returns the value of the counter name with labels, 0 when it was never incremented.
+func (r *Registry) Counter(name string, labels Labels) float64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.counters[name][labels.key()]
+}
+
+// Histogram returns how many values the histogram name with labels observed and their sum.
+func (r *Registry) Histogram(name string, labels Labels) (count uint64, sum float64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if h, ok := r.histograms[name][labels.key()]; ok {
+		return h.count, h.sum
+	}
+	return 0, 0
+}
+
+// WritePrometheus writes every metric to w in the Prometheus text format, ordered by name then labels.
+func (r *Registry) WritePrometheus(w io.Writer) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	bw := bufio.NewWriter(w)
+
+	for _, name := range sortedKeys(r.counters) {
+		r.writeHeader(bw, name, "counter")
+		for _, key := range sortedKeys(r.counters[name]) {
+			fmt.Fprintf(bw, "%s%s %s\n", name, braces(key), formatFloat(r.counters[name][key]))
+		}
+	}
+	for _, name := range sortedKeys(r.histograms) {
+		r.writeHeader(bw, name, "histogram")
+		for _, key := range sortedKeys(r.histograms[name]) {
+			h := r.histograms[name][key]
+			var cumulated uint64
+			for i, bound := range r.buckets {
+				cumulated += h.counts[i]
+				fmt.Fprintf(bw, "%s_bucket%s %d\n", name, braces(join(key, `le="`+formatFloat(bound)+`"`)), cumulated)
+			}
+			fmt.Fprintf(bw, "%s_bucket%s %d\n", name, braces(join(key, `le="+Inf"`)), h.count)
+			fmt.Fprintf(bw, "%s_sum%s %s\n", name, braces(key), formatFloat(h.sum))
+			fmt.Fprintf(bw, "%s_count%s %d\n", name, braces(key), h.count)
+		}
+	}
+	return bw.Flush()
+}
+
+func (r *Registry) writeHeader(w io.Writer, name, kind string) {
+	if help, ok := r.help[name]; ok {
+		fmt.Fprintf(w, "# HELP %s %s\n", name, help)
+	}
+	fmt.Fprintf(w, "# TYPE %s %s\n", name, kind)
+}
+
+// ServeHTTP writes the metrics in the Prometheus text format.
+func (r *Registry) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	if err := r.WritePrometheus(w); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func join(key, label string) string {
+	if key == "" {
+		return label
+	}
+	return key + "," + label
+}
+
+func braces(key string) string {
+	if key == "" {
+		return ""
+	}
+	return "{" + key + "}"
+}
+
+func formatFloat(f float64) string {
+	switch {
+	case math.IsInf(f, 1):
+		return "+Inf"
+	case math.IsInf(f, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
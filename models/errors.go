@@ -0,0 +1,48 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+)
+
+// TxError is returned by InTransaction when fn fails, Err is the error returned by fn and RollbackErr the error, if
+// any, of rolling the transaction back. errors.Is and errors.As look through TxError into Err.
+type TxError struct {
+	Err         error
+	RollbackErr error
+}
+
+func (e *TxError) Error() string {
+	if e.RollbackErr != nil {
+		return fmt.Sprintf("%v (rollback failed: %v)", e.Err, e.RollbackErr)
+	}
+	return e.Err.Error()
+}
+
+func (e *TxError) Unwrap() error {
+	return e.Err
+}
+
+// Every backend translates its driver errors into these, so callers can use errors.Is without importing any driver.
+var (
+	// ErrNotFound means the entity looked up, updated or deleted does not exist.
+	ErrNotFound = errors.New("not found")
+	// ErrConflict means the write collides with an existing entity, typically a duplicated id or unique key.
+	ErrConflict = errors.New("conflict")
+	// ErrInvalidReference means the write points to an entity that does not exist, or removes one still referenced.
+	ErrInvalidReference = errors.New("invalid reference")
+	// ErrInvalidEntity means the entity breaks a constraint of the schema, like a missing value or a too long string.
+	ErrInvalidEntity = errors.New("invalid entity")
+)
+
+// ErrStaleVersion means the entity was changed by someone else since it was read, it is an ErrConflict.
+var ErrStaleVersion = fmt.Errorf("%w: stale version", ErrConflict)
+
+// ErrInvalidCursor means the page cursor was not returned by a previous page.
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// ErrInvalidSpec means a Spec names a field the entity does not have or uses a value the backend cannot compare.
+var ErrInvalidSpec = errors.New("invalid spec")
+
+// ErrChecksumMismatch means a schema migration already applied to the database was changed since.
+var ErrChecksumMismatch = errors.New("migration checksum mismatch")
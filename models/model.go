@@ -1,13 +1,23 @@
 // Domain models package, includes Repository interface
 package models
 
+import "time"
+
 type Post struct {
-	ID int `db:"id" bson:"_id"`
-	Title string `db:"title" bson:"title"`
+	ID        int        `db:"id" bson:"_id"`
+	Title     string     `db:"title" bson:"title" maxlen:"250"`
+	Version   int        `db:"version" bson:"version"`
+	DeletedAt *time.Time `db:"deleted_at" bson:"deleted_at"`
+	CreatedAt time.Time  `db:"created_at" bson:"created_at"`
+	UpdatedAt time.Time  `db:"updated_at" bson:"updated_at"`
 }
 
 type Comment struct {
-	ID int `db:"id" bson:"_id"`
-	Review string `db:"review" bson:"review"`
-	PostID int `db:"post_id" bson:"post_id"`
+	ID        int        `db:"id" bson:"_id"`
+	Review    string     `db:"review" bson:"review" maxlen:"250"`
+	PostID    int        `db:"post_id" bson:"post_id"`
+	Version   int        `db:"version" bson:"version"`
+	DeletedAt *time.Time `db:"deleted_at" bson:"deleted_at"`
+	CreatedAt time.Time  `db:"created_at" bson:"created_at"`
+	UpdatedAt time.Time  `db:"updated_at" bson:"updated_at"`
 }
@@ -0,0 +1,98 @@
+package models
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+const (
+	DefaultPageLimit = 20
+	MaxPageLimit     = 1000
+)
+
+// PageRequest asks for a page of entities ordered by OrderBy then by id, or by id alone when OrderBy has no field.
+// Cursor is the NextCursor of the previous page requested with the same OrderBy, keyset paging stays fast and stable
+// while entities are added, Offset skips entities after Cursor, or from the start when there is no Cursor. Limit
+// defaults to DefaultPageLimit and is capped at MaxPageLimit.
+type PageRequest struct {
+	Limit   int
+	Offset  int
+	Cursor  string
+	OrderBy Order
+}
+
+// Size is the number of entities to return, Limit once defaulted and capped.
+func (r PageRequest) Size() int {
+	switch {
+	case r.Limit <= 0:
+		return DefaultPageLimit
+	case r.Limit > MaxPageLimit:
+		return MaxPageLimit
+	}
+	return r.Limit
+}
+
+// Page is one page of entities, NextCursor is empty on the last page.
+type Page[T any] struct {
+	Items      []*T
+	NextCursor string
+	HasMore    bool
+}
+
+type cursor[ID comparable] struct {
+	After ID              `json:"after"`
+	Key   json.RawMessage `json:"key,omitempty"`
+}
+
+// EncodeCursor returns the opaque cursor of the page starting after the entity with id, key being the value of the
+// field the page is ordered by, if any.
+func EncodeCursor[ID comparable](id ID, key interface{}) string {
+	c := cursor[ID]{After: id}
+	if key != nil {
+		b, err := json.Marshal(key)
+		if err != nil {
+			panic(err)
+		}
+		c.Key = b
+	}
+	b, err := json.Marshal(c)
+	if err != nil {
+		panic(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// DecodeCursor returns the id encoded by EncodeCursor and decodes its key into key, unless key is nil. It returns
+// ErrInvalidCursor when s was not made by EncodeCursor.
+func DecodeCursor[ID comparable](s string, key interface{}) (ID, error) {
+	var c cursor[ID]
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err == nil {
+		err = json.Unmarshal(b, &c)
+	}
+	if err == nil && key != nil {
+		if len(c.Key) == 0 {
+			err = errors.New("cursor has no key")
+		} else {
+			err = json.Unmarshal(c.Key, key)
+		}
+	}
+	if err != nil {
+		return c.After, fmt.Errorf("%w: %v", ErrInvalidCursor, err)
+	}
+	return c.After, nil
+}
+
+// NewPage makes the page of a request from items, the result of a query fetching up to one entity more than the
+// request size, that extra entity telling there are more pages. cursor returns the cursor of the page after an item.
+func NewPage[T any](r PageRequest, items []*T, cursor func(*T) string) *Page[T] {
+	p := &Page[T]{Items: items}
+	if len(items) > r.Size() {
+		p.Items = items[:r.Size()]
+		p.HasMore = true
+		p.NextCursor = cursor(p.Items[len(p.Items)-1])
+	}
+	return p
+}
@@ -2,16 +2,53 @@ package models
 
 import (
 	"context"
+	"time"
 )
 
-type PostRepository interface {
-	Save(ctx context.Context, p *Post) error
-	FindByID(ctx context.Context, id int) (*Post, error)
+// Repository is the persistence contract shared by every entity, T is the entity and ID the type of its identifier.
+// Entity specific repositories embed it and only declare their extra finders, ad hoc lookups go through FindBy.
+// Save inserts an entity with a zero ID and inserts or updates one with an ID set, while Insert fails with
+// ErrConflict when the ID is already taken and Update with ErrNotFound when there is nothing to update.
+// SaveAll saves every entity like Save in a single transaction, inserting the new ones in batches.
+// Delete returns ErrNotFound when there is nothing to delete, like every other operation it joins the transaction
+// carried by ctx. Repositories created with soft delete only mark entities deleted, every finder but
+// FindIncludingDeleted leaves them out until Restore, and Purge removes the ones deleted more than olderThan ago.
+// InTransactionWithOptions is InTransaction with a transaction tuned by opts, see TxOptions.
+//
+// Besides ID, the fields repositories know about are optional on a model, a model without one simply goes without
+// the feature. An int Version is compared on every update and incremented, a write based on an outdated copy fails
+// with ErrStaleVersion. A *time.Time DeletedAt is set instead of removing the entity by repositories created with
+// soft delete. time.Time CreatedAt and UpdatedAt are set on insert, and UpdatedAt again on every update. A
+// `maxlen:"n"` tag on a string limits it like a varchar(n) column, mongo enforces it through its validators.
+type Repository[T any, ID comparable] interface {
+	FindByID(ctx context.Context, id ID) (*T, error)
+	FindAll(ctx context.Context) ([]*T, error)
+	FindBy(ctx context.Context, spec Spec) ([]*T, error)
+	Count(ctx context.Context, spec Spec) (int64, error)
+	Exists(ctx context.Context, id ID) (bool, error)
+	FindPage(ctx context.Context, req PageRequest) (*Page[T], error)
+	Save(ctx context.Context, m *T) error
+	SaveAll(ctx context.Context, ms []*T) error
+	Insert(ctx context.Context, m *T) error
+	Update(ctx context.Context, m *T) error
+	Delete(ctx context.Context, id ID) error
+	Restore(ctx context.Context, id ID) error
+	FindIncludingDeleted(ctx context.Context, spec Spec) ([]*T, error)
+	Purge(ctx context.Context, olderThan time.Duration) (int64, error)
 	InTransaction(ctx context.Context, fn func(context.Context) error) error
+	InTransactionWithOptions(ctx context.Context, opts TxOptions, fn func(context.Context) error) error
+}
+
+// PostRepository refuses to Delete a post that still has comments, it returns ErrInvalidReference instead, unless it
+// soft deletes. DeleteCascade deletes the post together with its comments in a single transaction and returns how many
+// comments were deleted.
+type PostRepository interface {
+	Repository[Post, int]
+	DeleteCascade(ctx context.Context, id int) (int64, error)
 }
 
 type CommentRepository interface {
-	Save(ctx context.Context, c *Comment) error
+	Repository[Comment, int]
 	FindByPostID(ctx context.Context, postID int) ([]*Comment, error)
-	InTransaction(ctx context.Context, fn func(context.Context) error) error
+	FindPageByPostID(ctx context.Context, postID int, req PageRequest) (*Page[Comment], error)
 }
@@ -0,0 +1,107 @@
+package models
+
+import (
+	"regexp"
+	"strings"
+)
+
+type Op int
+
+const (
+	OpEq Op = iota
+	OpIn
+	OpLike
+	OpRange
+	OpAnd
+	OpOr
+)
+
+// Criterion is a condition on the fields of an entity, built with Eq, In, Like, Range, And and Or. Fields are named
+// after the Go struct fields, every backend maps them onto its own columns and only ever sends values as parameters.
+type Criterion struct {
+	Op       Op
+	Field    string
+	Values   []interface{}
+	Children []Criterion
+}
+
+func Eq(field string, value interface{}) Criterion {
+	return Criterion{Op: OpEq, Field: field, Values: []interface{}{value}}
+}
+
+// In matches when field equals any of values, it matches nothing when values is empty.
+func In(field string, values ...interface{}) Criterion {
+	return Criterion{Op: OpIn, Field: field, Values: values}
+}
+
+// Like matches a string field against a sql LIKE pattern, % matches any run of characters and _ a single one.
+// Case sensitivity follows the backend.
+func Like(field string, pattern string) Criterion {
+	return Criterion{Op: OpLike, Field: field, Values: []interface{}{pattern}}
+}
+
+// Range matches from <= field < to, a nil bound leaves that side open.
+func Range(field string, from, to interface{}) Criterion {
+	return Criterion{Op: OpRange, Field: field, Values: []interface{}{from, to}}
+}
+
+// And matches when every criterion matches, it matches everything when there are none.
+func And(criteria ...Criterion) Criterion {
+	return Criterion{Op: OpAnd, Children: criteria}
+}
+
+// Or matches when any criterion matches, it matches nothing when there are none.
+func Or(criteria ...Criterion) Criterion {
+	return Criterion{Op: OpOr, Children: criteria}
+}
+
+type Order struct {
+	Field string
+	Desc  bool
+}
+
+func Asc(field string) Order {
+	return Order{Field: field}
+}
+
+func Desc(field string) Order {
+	return Order{Field: field, Desc: true}
+}
+
+// Spec selects entities matching Where, nil matching them all, sorted by Orders then by id.
+type Spec struct {
+	Where  *Criterion
+	Orders []Order
+}
+
+func Where(c Criterion) Spec {
+	return Spec{Where: &c}
+}
+
+// All is the Spec matching every entity.
+func All() Spec {
+	return Spec{}
+}
+
+func (s Spec) OrderBy(orders ...Order) Spec {
+	s.Orders = append(append([]Order(nil), s.Orders...), orders...)
+	return s
+}
+
+// LikeRegexp translates a Like pattern into an anchored regular expression, for backends without LIKE.
+func LikeRegexp(pattern string) string {
+	var b strings.Builder
+	b.WriteString("^")
+	for _, r := range pattern {
+		switch r {
+		case '%':
+			b.WriteString("(?s:.*)")
+		case '_':
+			b.WriteString("(?s:.)")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	b.WriteString("$")
+	return b.String()
+}
@@ -0,0 +1,43 @@
+package models
+
+import "time"
+
+// IsolationLevel is how much a transaction sees of the transactions running alongside it.
+type IsolationLevel int
+
+const (
+	// IsolationDefault is the default level of the backend.
+	IsolationDefault IsolationLevel = iota
+	// IsolationReadCommitted only reads committed data, possibly a different version at every read.
+	IsolationReadCommitted
+	// IsolationRepeatableRead reads the same version of a row every time.
+	IsolationRepeatableRead
+	// IsolationSnapshot reads every row as of the start of the transaction.
+	IsolationSnapshot
+	// IsolationSerializable runs as if no other transaction ran alongside.
+	IsolationSerializable
+)
+
+var isolationNames = [...]string{"default", "read committed", "repeatable read", "snapshot", "serializable"}
+
+func (l IsolationLevel) String() string {
+	if l < 0 || int(l) >= len(isolationNames) {
+		return "unknown"
+	}
+	return isolationNames[l]
+}
+
+// TxOptions tune a transaction, the zero value is the default transaction of the backend.
+// On sql Isolation and ReadOnly go to the engine, snapshot being repeatable read, which postgres and mysql implement
+// with a snapshot. sqlite transactions are always serializable and do not enforce ReadOnly.
+// On mongo read committed reads with a majority read concern and the stricter levels with a snapshot one, the
+// strictest isolation mongo has. ReadOnly is not enforced there, nor by the memory store, which ignores Isolation.
+type TxOptions struct {
+	Isolation IsolationLevel
+	ReadOnly  bool
+	// Timeout bounds the whole transaction, retries included, the transaction is rolled back once it elapsed.
+	Timeout time.Duration
+	// DurableCommit makes a mongo commit wait for a majority of the replica set, sql commits are durable once they
+	// return anyway.
+	DurableCommit bool
+}
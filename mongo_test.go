@@ -1,17 +1,25 @@
 package repository_pattern
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"github.com/hendratommy/mongo-sequence/pkg/sequence"
 	"github.com/hendratommy/repository-pattern/models"
 	"github.com/hendratommy/repository-pattern/mongostore"
+	"github.com/hendratommy/repository-pattern/querylog"
 	"github.com/hendratommy/repository-pattern/repositories"
+	"github.com/hendratommy/repository-pattern/tracing"
 	. "github.com/smartystreets/goconvey/convey"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
+	"io"
+	"log/slog"
 	"os"
+	"strings"
 	"testing"
 	"time"
 )
@@ -24,14 +32,17 @@ func try(err error) {
 
 func prepareMongoEnvironment(db *mongo.Database) {
 	try(db.Drop(context.Background()))
-	try(db.CreateCollection(context.Background(), mongostore.PostCollection))
-	try(db.CreateCollection(context.Background(), mongostore.CommentCollection))
+	try(mongostore.Migrate(context.Background(), db))
+	_, err := mongostore.EnsureSchema(context.Background(), db)
+	try(err)
 	sequence.SetupDefaultSequence(db, 30*time.Second)
 }
 
 func TestMongoRepository(t *testing.T) {
 	var dbName = "repositoryPattern"
-	var client, err = mongo.NewClient(options.Client().ApplyURI(os.Getenv("MONGODB_URI")))
+	var queryLog = &querylog.Logger{Logger: slog.New(slog.NewJSONHandler(io.Discard, nil)), Redact: querylog.RedactStrings}
+	var monitor = mongostore.Monitors(mongostore.TracingMonitor(querylog.RedactStrings), mongostore.LoggingMonitor(queryLog))
+	var client, err = mongo.NewClient(options.Client().ApplyURI(os.Getenv("MONGODB_URI")).SetMonitor(monitor))
 	if err != nil {
 		panic(err)
 	}
@@ -122,7 +133,10 @@ func TestMongoRepository(t *testing.T) {
 			})
 
 			Convey("Should rollback successfully", func() {
-				So(err, ShouldBeNil)
+				var txErr *models.TxError
+				So(errors.As(err, &txErr), ShouldBeTrue)
+				So(txErr.Err.Error(), ShouldEqual, "should rollback")
+				So(txErr.RollbackErr, ShouldBeNil)
 
 				var posts []bson.M
 				cur, err := db.Collection(mongostore.PostCollection).Find(context.Background(), bson.D{})
@@ -140,6 +154,748 @@ func TestMongoRepository(t *testing.T) {
 			})
 		})
 
+		Convey("Test transaction panic", func() {
+			So(func() {
+				postRepo.InTransaction(context.Background(), func(ctx context.Context) error {
+					if err := postRepo.Save(ctx, &models.Post{Title: "this should not persisted"}); err != nil {
+						return err
+					}
+					panic("should rollback")
+				})
+			}, ShouldPanicWith, "should rollback")
+
+			Convey("Should rollback before propagating the panic", func() {
+				count, err := db.Collection(mongostore.PostCollection).CountDocuments(context.Background(), bson.D{})
+				try(err)
+
+				So(count, ShouldEqual, 0)
+			})
+		})
+
+		Convey("Test transaction rollback failure", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			err := postRepo.InTransaction(ctx, func(ctx context.Context) error {
+				if err := postRepo.Save(ctx, &models.Post{Title: "this should not persisted"}); err != nil {
+					return err
+				}
+				// abortTransaction cannot be sent with a cancelled context
+				cancel()
+				return errors.New("should rollback")
+			})
+
+			Convey("Should return both the fn and the rollback error", func() {
+				var txErr *models.TxError
+				So(errors.As(err, &txErr), ShouldBeTrue)
+				So(txErr.Err.Error(), ShouldEqual, "should rollback")
+				So(txErr.RollbackErr, ShouldNotBeNil)
+			})
+		})
+
+		Convey("Test error translation", func() {
+			_, findErr := postRepo.FindByID(context.Background(), 42)
+
+			Convey("Should return domain errors", func() {
+				So(errors.Is(findErr, models.ErrNotFound), ShouldBeTrue)
+			})
+		})
+
+		Convey("Test delete", func() {
+			p := &models.Post{Title: "implement repository pattern in go"}
+			try(postRepo.Save(context.Background(), p))
+			c := &models.Comment{PostID: p.ID, Review: "yayy"}
+			try(commentRepo.Save(context.Background(), c))
+
+			Convey("Should refuse to delete a post with comments", func() {
+				err := postRepo.Delete(context.Background(), p.ID)
+				So(errors.Is(err, models.ErrInvalidReference), ShouldBeTrue)
+			})
+
+			Convey("Should return not found when nothing is deleted", func() {
+				err := commentRepo.Delete(context.Background(), c.ID+1)
+				So(errors.Is(err, models.ErrNotFound), ShouldBeTrue)
+			})
+
+			Convey("Should join the transaction in ctx", func() {
+				err := postRepo.InTransaction(context.Background(), func(ctx context.Context) error {
+					if err := commentRepo.Delete(ctx, c.ID); err != nil {
+						return err
+					}
+					if err := postRepo.Delete(ctx, p.ID); err != nil {
+						return err
+					}
+					return errors.New("should rollback")
+				})
+				So(err.Error(), ShouldEqual, "should rollback")
+
+				_, err = commentRepo.FindByID(context.Background(), c.ID)
+				So(err, ShouldBeNil)
+
+				try(commentRepo.Delete(context.Background(), c.ID))
+				try(postRepo.Delete(context.Background(), p.ID))
+
+				_, err = postRepo.FindByID(context.Background(), p.ID)
+				So(errors.Is(err, models.ErrNotFound), ShouldBeTrue)
+			})
+		})
+
+		Convey("Test delete cascade", func() {
+			p := &models.Post{Title: "implement repository pattern in go"}
+			try(postRepo.Save(context.Background(), p))
+			try(commentRepo.Save(context.Background(), &models.Comment{PostID: p.ID, Review: "yayy"}))
+			try(commentRepo.Save(context.Background(), &models.Comment{PostID: p.ID, Review: "nayy"}))
+
+			Convey("Should delete the post and its comments", func() {
+				n, err := postRepo.DeleteCascade(context.Background(), p.ID)
+				So(err, ShouldBeNil)
+				So(n, ShouldEqual, 2)
+
+				_, err = postRepo.FindByID(context.Background(), p.ID)
+				So(errors.Is(err, models.ErrNotFound), ShouldBeTrue)
+				comments, err := commentRepo.FindByPostID(context.Background(), p.ID)
+				So(err, ShouldBeNil)
+				So(len(comments), ShouldEqual, 0)
+			})
+
+			Convey("Should return not found for unknown post", func() {
+				_, err := postRepo.DeleteCascade(context.Background(), p.ID+1)
+				So(errors.Is(err, models.ErrNotFound), ShouldBeTrue)
+			})
+
+			Convey("Should keep everything when the transaction rolls back", func() {
+				err := postRepo.InTransaction(context.Background(), func(ctx context.Context) error {
+					if _, err := postRepo.DeleteCascade(ctx, p.ID); err != nil {
+						return err
+					}
+					return errors.New("should rollback")
+				})
+				So(err.Error(), ShouldEqual, "should rollback")
+
+				comments, err := commentRepo.FindByPostID(context.Background(), p.ID)
+				So(err, ShouldBeNil)
+				So(len(comments), ShouldEqual, 2)
+			})
+		})
+
+		Convey("Test save existing id", func() {
+			p := &models.Post{Title: "implement repository pattern in go"}
+			try(postRepo.Save(context.Background(), p))
+			id := p.ID
+
+			p.Title = "implement repository pattern in go, revised"
+			try(postRepo.Save(context.Background(), p))
+
+			Convey("Should update instead of inserting", func() {
+				So(p.ID, ShouldEqual, id)
+
+				posts, err := postRepo.FindAll(context.Background())
+				So(err, ShouldBeNil)
+				So(len(posts), ShouldEqual, 1)
+				So(posts[0].Title, ShouldEqual, "implement repository pattern in go, revised")
+			})
+
+			Convey("Should insert with the given id and keep generating after it", func() {
+				explicit := &models.Post{ID: id + 10, Title: "explicit id"}
+				try(postRepo.Save(context.Background(), explicit))
+				So(explicit.ID, ShouldEqual, id+10)
+
+				found, err := postRepo.FindByID(context.Background(), id+10)
+				So(err, ShouldBeNil)
+				So(found.Title, ShouldEqual, "explicit id")
+
+				try(postRepo.Insert(context.Background(), &models.Post{ID: id + 20, Title: "explicit id"}))
+				try(postRepo.Save(context.Background(), &models.Post{ID: id + 15, Title: "explicit id"}))
+				generated := &models.Post{Title: "generated id"}
+				try(postRepo.Save(context.Background(), generated))
+				So(generated.ID, ShouldEqual, id+21)
+			})
+
+			Convey("Should fail to insert a taken id", func() {
+				err := postRepo.Insert(context.Background(), &models.Post{ID: id, Title: "duplicate"})
+				So(errors.Is(err, models.ErrConflict), ShouldBeTrue)
+			})
+
+			Convey("Should fail to update a missing id", func() {
+				err := postRepo.Update(context.Background(), &models.Post{ID: id + 1, Title: "missing"})
+				So(errors.Is(err, models.ErrNotFound), ShouldBeTrue)
+
+				p.Title = "updated"
+				try(postRepo.Update(context.Background(), p))
+				found, err := postRepo.FindByID(context.Background(), id)
+				So(err, ShouldBeNil)
+				So(found.Title, ShouldEqual, "updated")
+			})
+		})
+
+		Convey("Test optimistic locking", func() {
+			p := &models.Post{Title: "implement repository pattern in go"}
+			try(postRepo.Save(context.Background(), p))
+			stale, err := postRepo.FindByID(context.Background(), p.ID)
+			try(err)
+
+			Convey("Should start at version 1 and increment on update", func() {
+				So(p.Version, ShouldEqual, 1)
+
+				p.Title = "implement repository pattern in go, revised"
+				try(postRepo.Update(context.Background(), p))
+				So(p.Version, ShouldEqual, 2)
+				try(postRepo.Save(context.Background(), p))
+				So(p.Version, ShouldEqual, 3)
+
+				found, err := postRepo.FindByID(context.Background(), p.ID)
+				So(err, ShouldBeNil)
+				So(found.Version, ShouldEqual, 3)
+			})
+
+			Convey("Should insert an explicit unknown id at version 1 whatever its version", func() {
+				explicit := &models.Post{ID: p.ID + 100, Title: "explicit id", Version: 7}
+				try(postRepo.Save(context.Background(), explicit))
+				So(explicit.Version, ShouldEqual, 1)
+
+				found, err := postRepo.FindByID(context.Background(), explicit.ID)
+				So(err, ShouldBeNil)
+				So(found.Version, ShouldEqual, 1)
+			})
+
+			Convey("Should report a conflict saving over a deleted entity", func() {
+				softPostRepo := repositories.NewMongoPostRepository(db, repositories.WithSoftDelete())
+				try(softPostRepo.Delete(context.Background(), p.ID))
+				err := softPostRepo.Save(context.Background(), p)
+				So(errors.Is(err, models.ErrConflict), ShouldBeTrue)
+				So(errors.Is(err, models.ErrStaleVersion), ShouldBeFalse)
+			})
+
+			Convey("Should refuse to overwrite a newer version", func() {
+				p.Title = "first writer"
+				try(postRepo.Update(context.Background(), p))
+
+				stale.Title = "second writer"
+				err := postRepo.Update(context.Background(), stale)
+				So(errors.Is(err, models.ErrStaleVersion), ShouldBeTrue)
+				So(errors.Is(err, models.ErrConflict), ShouldBeTrue)
+				So(stale.Version, ShouldEqual, 1)
+
+				err = postRepo.Save(context.Background(), stale)
+				So(errors.Is(err, models.ErrStaleVersion), ShouldBeTrue)
+
+				found, err := postRepo.FindByID(context.Background(), p.ID)
+				So(err, ShouldBeNil)
+				So(found.Title, ShouldEqual, "first writer")
+			})
+		})
+
+		Convey("Test pagination", func() {
+			p := &models.Post{Title: "implement repository pattern in go"}
+			try(postRepo.Save(context.Background(), p))
+			for i := 0; i < 5; i++ {
+				try(postRepo.Save(context.Background(), &models.Post{Title: "filler"}))
+			}
+			for i := 0; i < 5; i++ {
+				try(commentRepo.Save(context.Background(), &models.Comment{PostID: p.ID, Review: "yayy"}))
+			}
+
+			Convey("Should walk every page with the cursor", func() {
+				var ids []int
+				req := models.PageRequest{Limit: 2}
+				for {
+					page, err := commentRepo.FindPageByPostID(context.Background(), p.ID, req)
+					So(err, ShouldBeNil)
+					for _, c := range page.Items {
+						ids = append(ids, c.ID)
+					}
+					if !page.HasMore {
+						So(page.NextCursor, ShouldBeEmpty)
+						break
+					}
+					req.Cursor = page.NextCursor
+				}
+				So(len(ids), ShouldEqual, 5)
+				for i := 1; i < len(ids); i++ {
+					So(ids[i], ShouldBeGreaterThan, ids[i-1])
+				}
+			})
+
+			Convey("Should skip with offset", func() {
+				page, err := postRepo.FindPage(context.Background(), models.PageRequest{Limit: 4, Offset: 4})
+				So(err, ShouldBeNil)
+				So(len(page.Items), ShouldEqual, 2)
+				So(page.HasMore, ShouldBeFalse)
+
+				page, err = postRepo.FindPage(context.Background(), models.PageRequest{Limit: 4, Offset: 1})
+				So(err, ShouldBeNil)
+				So(len(page.Items), ShouldEqual, 4)
+				So(page.HasMore, ShouldBeTrue)
+				So(page.Items[0].ID, ShouldBeGreaterThan, p.ID)
+			})
+
+			Convey("Should reject an invalid cursor", func() {
+				_, err := postRepo.FindPage(context.Background(), models.PageRequest{Cursor: "not a cursor"})
+				So(errors.Is(err, models.ErrInvalidCursor), ShouldBeTrue)
+			})
+		})
+
+		Convey("Test find by spec", func() {
+			p1 := &models.Post{Title: "implement repository pattern in go"}
+			try(postRepo.Save(context.Background(), p1))
+			p2 := &models.Post{Title: "implement unit of work in go"}
+			try(postRepo.Save(context.Background(), p2))
+			p3 := &models.Post{Title: "hello world"}
+			try(postRepo.Save(context.Background(), p3))
+			try(commentRepo.Save(context.Background(), &models.Comment{PostID: p1.ID, Review: "yayy"}))
+			try(commentRepo.Save(context.Background(), &models.Comment{PostID: p2.ID, Review: "nayy"}))
+			try(commentRepo.Save(context.Background(), &models.Comment{PostID: p2.ID, Review: "yayy"}))
+
+			Convey("Should filter with every operator", func() {
+				posts, err := postRepo.FindBy(context.Background(), models.Where(models.Like("Title", "implement%")))
+				So(err, ShouldBeNil)
+				So(len(posts), ShouldEqual, 2)
+
+				posts, err = postRepo.FindBy(context.Background(), models.Where(models.In("ID", p1.ID, p3.ID)))
+				So(err, ShouldBeNil)
+				So(len(posts), ShouldEqual, 2)
+				So(posts[1].ID, ShouldEqual, p3.ID)
+
+				posts, err = postRepo.FindBy(context.Background(), models.Where(models.Range("ID", p2.ID, nil)))
+				So(err, ShouldBeNil)
+				So(len(posts), ShouldEqual, 2)
+
+				comments, err := commentRepo.FindBy(context.Background(), models.Where(models.And(
+					models.Eq("PostID", p2.ID),
+					models.Or(models.Eq("Review", "yayy"), models.Eq("Review", "meh")),
+				)))
+				So(err, ShouldBeNil)
+				So(len(comments), ShouldEqual, 1)
+				So(comments[0].PostID, ShouldEqual, p2.ID)
+			})
+
+			Convey("Should order by the given fields then id", func() {
+				comments, err := commentRepo.FindBy(context.Background(), models.All().OrderBy(models.Asc("Review"), models.Desc("PostID")))
+				So(err, ShouldBeNil)
+				So(len(comments), ShouldEqual, 3)
+				So(comments[0].Review, ShouldEqual, "nayy")
+				So(comments[1].PostID, ShouldEqual, p2.ID)
+				So(comments[2].PostID, ShouldEqual, p1.ID)
+			})
+
+			Convey("Should treat values as data", func() {
+				posts, err := postRepo.FindBy(context.Background(), models.Where(models.Eq("Title", "x' OR '1'='1")))
+				So(err, ShouldBeNil)
+				So(len(posts), ShouldEqual, 0)
+			})
+
+			Convey("Should reject unknown fields", func() {
+				_, err := postRepo.FindBy(context.Background(), models.Where(models.Eq("title; DROP TABLE posts", 1)))
+				So(errors.Is(err, models.ErrInvalidSpec), ShouldBeTrue)
+			})
+		})
+
+		Convey("Test count and exists", func() {
+			p := &models.Post{Title: "implement repository pattern in go"}
+			try(postRepo.Save(context.Background(), p))
+			try(commentRepo.Save(context.Background(), &models.Comment{PostID: p.ID, Review: "yayy"}))
+			try(commentRepo.Save(context.Background(), &models.Comment{PostID: p.ID, Review: "nayy"}))
+
+			Convey("Should count matching entities", func() {
+				n, err := commentRepo.Count(context.Background(), models.Where(models.Eq("PostID", p.ID)))
+				So(err, ShouldBeNil)
+				So(n, ShouldEqual, 2)
+
+				n, err = commentRepo.Count(context.Background(), models.Where(models.Eq("PostID", p.ID+1)))
+				So(err, ShouldBeNil)
+				So(n, ShouldEqual, 0)
+
+				n, err = postRepo.Count(context.Background(), models.All())
+				So(err, ShouldBeNil)
+				So(n, ShouldEqual, 1)
+			})
+
+			Convey("Should tell whether an id exists", func() {
+				ok, err := postRepo.Exists(context.Background(), p.ID)
+				So(err, ShouldBeNil)
+				So(ok, ShouldBeTrue)
+
+				ok, err = postRepo.Exists(context.Background(), p.ID+1)
+				So(err, ShouldBeNil)
+				So(ok, ShouldBeFalse)
+			})
+
+			Convey("Should see the writes of the transaction in ctx", func() {
+				err := postRepo.InTransaction(context.Background(), func(ctx context.Context) error {
+					try(commentRepo.Save(ctx, &models.Comment{PostID: p.ID, Review: "meh"}))
+					n, err := commentRepo.Count(ctx, models.Where(models.Eq("PostID", p.ID)))
+					So(err, ShouldBeNil)
+					So(n, ShouldEqual, 3)
+					return errors.New("should rollback")
+				})
+				So(err, ShouldNotBeNil)
+
+				n, err := commentRepo.Count(context.Background(), models.Where(models.Eq("PostID", p.ID)))
+				So(err, ShouldBeNil)
+				So(n, ShouldEqual, 2)
+			})
+		})
+
+		Convey("Test save all", func() {
+			p := &models.Post{Title: "implement repository pattern in go"}
+			try(postRepo.Save(context.Background(), p))
+
+			Convey("Should insert in batches and assign the ids", func() {
+				comments := make([]*models.Comment, 2500)
+				for i := range comments {
+					comments[i] = &models.Comment{PostID: p.ID, Review: fmt.Sprintf("review %d", i)}
+				}
+				try(commentRepo.SaveAll(context.Background(), comments))
+
+				ids := map[int]bool{}
+				for _, c := range comments {
+					So(c.Version, ShouldEqual, 1)
+					ids[c.ID] = true
+				}
+				So(len(ids), ShouldEqual, len(comments))
+
+				n, err := commentRepo.Count(context.Background(), models.Where(models.Eq("PostID", p.ID)))
+				So(err, ShouldBeNil)
+				So(n, ShouldEqual, len(comments))
+
+				found, err := commentRepo.FindByID(context.Background(), comments[1234].ID)
+				So(err, ShouldBeNil)
+				So(found.Review, ShouldEqual, "review 1234")
+			})
+
+			Convey("Should save nothing when one entity fails", func() {
+				stale := *p
+				p.Title = "first writer"
+				try(postRepo.Update(context.Background(), p))
+
+				fresh := &models.Post{ID: p.ID, Title: "second writer", Version: p.Version}
+				err := postRepo.SaveAll(context.Background(), []*models.Post{fresh, &stale, {Title: "new"}})
+				So(errors.Is(err, models.ErrStaleVersion), ShouldBeTrue)
+
+				posts, err := postRepo.FindAll(context.Background())
+				So(err, ShouldBeNil)
+				So(len(posts), ShouldEqual, 1)
+				So(posts[0].Title, ShouldEqual, "first writer")
+			})
+		})
+
+		Convey("Test soft delete", func() {
+			softPostRepo := repositories.NewMongoPostRepository(db, repositories.WithSoftDelete())
+			softCommentRepo := repositories.NewMongoCommentRepository(db, repositories.WithSoftDelete())
+
+			p := &models.Post{Title: "implement repository pattern in go"}
+			try(softPostRepo.Save(context.Background(), p))
+			c := &models.Comment{PostID: p.ID, Review: "yayy"}
+			try(softCommentRepo.Save(context.Background(), c))
+			try(softCommentRepo.Delete(context.Background(), c.ID))
+
+			Convey("Should hide deleted entities from the finders", func() {
+				_, err := softCommentRepo.FindByID(context.Background(), c.ID)
+				So(errors.Is(err, models.ErrNotFound), ShouldBeTrue)
+				comments, err := softCommentRepo.FindByPostID(context.Background(), p.ID)
+				So(err, ShouldBeNil)
+				So(len(comments), ShouldEqual, 0)
+				n, err := softCommentRepo.Count(context.Background(), models.All())
+				So(err, ShouldBeNil)
+				So(n, ShouldEqual, 0)
+				ok, err := softCommentRepo.Exists(context.Background(), c.ID)
+				So(err, ShouldBeNil)
+				So(ok, ShouldBeFalse)
+
+				err = softCommentRepo.Delete(context.Background(), c.ID)
+				So(errors.Is(err, models.ErrNotFound), ShouldBeTrue)
+				err = softCommentRepo.Update(context.Background(), c)
+				So(errors.Is(err, models.ErrNotFound), ShouldBeTrue)
+			})
+
+			Convey("Should still find deleted entities on request", func() {
+				comments, err := softCommentRepo.FindIncludingDeleted(context.Background(), models.Where(models.Eq("PostID", p.ID)))
+				So(err, ShouldBeNil)
+				So(len(comments), ShouldEqual, 1)
+				So(comments[0].DeletedAt, ShouldNotBeNil)
+
+				found, err := commentRepo.FindByID(context.Background(), c.ID)
+				So(err, ShouldBeNil)
+				So(found.DeletedAt, ShouldNotBeNil)
+			})
+
+			Convey("Should restore deleted entities", func() {
+				try(softCommentRepo.Restore(context.Background(), c.ID))
+				found, err := softCommentRepo.FindByID(context.Background(), c.ID)
+				So(err, ShouldBeNil)
+				So(found.DeletedAt, ShouldBeNil)
+
+				err = softCommentRepo.Restore(context.Background(), c.ID)
+				So(errors.Is(err, models.ErrNotFound), ShouldBeTrue)
+			})
+
+			Convey("Should only purge entities deleted long enough ago", func() {
+				n, err := softCommentRepo.Purge(context.Background(), time.Hour)
+				So(err, ShouldBeNil)
+				So(n, ShouldEqual, 0)
+
+				n, err = softCommentRepo.Purge(context.Background(), -time.Hour)
+				So(err, ShouldBeNil)
+				So(n, ShouldEqual, 1)
+				comments, err := softCommentRepo.FindIncludingDeleted(context.Background(), models.All())
+				So(err, ShouldBeNil)
+				So(len(comments), ShouldEqual, 0)
+			})
+
+			Convey("Should hide a post with its comments", func() {
+				try(softCommentRepo.Restore(context.Background(), c.ID))
+				try(softPostRepo.Delete(context.Background(), p.ID))
+				_, err := softPostRepo.FindByID(context.Background(), p.ID)
+				So(errors.Is(err, models.ErrNotFound), ShouldBeTrue)
+				try(softPostRepo.Restore(context.Background(), p.ID))
+
+				n, err := softPostRepo.DeleteCascade(context.Background(), p.ID)
+				So(err, ShouldBeNil)
+				So(n, ShouldEqual, 1)
+				comments, err := softCommentRepo.FindIncludingDeleted(context.Background(), models.Where(models.Eq("PostID", p.ID)))
+				So(err, ShouldBeNil)
+				So(len(comments), ShouldEqual, 1)
+				So(comments[0].DeletedAt, ShouldNotBeNil)
+			})
+		})
+
+		Convey("Test timestamps", func() {
+			start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+			now := start
+			clock := func() time.Time {
+				now = now.Add(time.Minute)
+				return now
+			}
+			tsPostRepo := repositories.NewMongoPostRepository(db, repositories.WithClock(clock))
+
+			p := &models.Post{Title: "implement repository pattern in go"}
+			try(tsPostRepo.Save(context.Background(), p))
+
+			Convey("Should set CreatedAt and UpdatedAt on insert", func() {
+				So(p.CreatedAt.Equal(start.Add(time.Minute)), ShouldBeTrue)
+				So(p.UpdatedAt.Equal(p.CreatedAt), ShouldBeTrue)
+
+				found, err := tsPostRepo.FindByID(context.Background(), p.ID)
+				So(err, ShouldBeNil)
+				So(found.CreatedAt.Equal(p.CreatedAt), ShouldBeTrue)
+				So(found.UpdatedAt.Equal(p.UpdatedAt), ShouldBeTrue)
+			})
+
+			Convey("Should only move UpdatedAt on update", func() {
+				created := p.CreatedAt
+				p.Title = "implement repository pattern in go, again"
+				p.CreatedAt = time.Time{}
+				try(tsPostRepo.Update(context.Background(), p))
+				So(p.UpdatedAt.After(created), ShouldBeTrue)
+
+				found, err := tsPostRepo.FindByID(context.Background(), p.ID)
+				So(err, ShouldBeNil)
+				So(found.CreatedAt.Equal(created), ShouldBeTrue)
+				So(found.UpdatedAt.Equal(p.UpdatedAt), ShouldBeTrue)
+
+				found.CreatedAt = time.Time{}
+				try(tsPostRepo.Save(context.Background(), found))
+				found, err = tsPostRepo.FindByID(context.Background(), p.ID)
+				So(err, ShouldBeNil)
+				So(found.CreatedAt.Equal(created), ShouldBeTrue)
+				So(found.UpdatedAt.After(p.UpdatedAt), ShouldBeTrue)
+			})
+
+			Convey("Should stamp a cascaded soft delete with the clock", func() {
+				softPostRepo := repositories.NewMongoPostRepository(db, repositories.WithSoftDelete(), repositories.WithClock(clock))
+				c := &models.Comment{PostID: p.ID, Review: "stamped by the clock"}
+				try(commentRepo.Save(context.Background(), c))
+				before := now
+
+				n, err := softPostRepo.DeleteCascade(context.Background(), p.ID)
+				So(err, ShouldBeNil)
+				So(n, ShouldEqual, 1)
+				found, err := commentRepo.FindByID(context.Background(), c.ID)
+				So(err, ShouldBeNil)
+				So(found.DeletedAt, ShouldNotBeNil)
+				So(found.DeletedAt.After(before) && !found.DeletedAt.After(now), ShouldBeTrue)
+				posts, err := softPostRepo.FindIncludingDeleted(context.Background(), models.Where(models.Eq("ID", p.ID)))
+				So(err, ShouldBeNil)
+				So(len(posts), ShouldEqual, 1)
+				So(posts[0].DeletedAt.After(before) && !posts[0].DeletedAt.After(now), ShouldBeTrue)
+			})
+
+			Convey("Should order by timestamps", func() {
+				p2 := &models.Post{Title: "second"}
+				p3 := &models.Post{Title: "third"}
+				try(tsPostRepo.Save(context.Background(), p2))
+				try(tsPostRepo.Save(context.Background(), p3))
+
+				posts, err := tsPostRepo.FindBy(context.Background(), models.All().OrderBy(models.Desc("CreatedAt")))
+				So(err, ShouldBeNil)
+				So(len(posts), ShouldEqual, 3)
+				So(posts[0].ID, ShouldEqual, p3.ID)
+				So(posts[2].ID, ShouldEqual, p.ID)
+
+				req := models.PageRequest{Limit: 2, OrderBy: models.Desc("CreatedAt")}
+				page, err := tsPostRepo.FindPage(context.Background(), req)
+				So(err, ShouldBeNil)
+				So(len(page.Items), ShouldEqual, 2)
+				So(page.Items[0].ID, ShouldEqual, p3.ID)
+				So(page.Items[1].ID, ShouldEqual, p2.ID)
+				So(page.HasMore, ShouldBeTrue)
+
+				req.Cursor = page.NextCursor
+				page, err = tsPostRepo.FindPage(context.Background(), req)
+				So(err, ShouldBeNil)
+				So(len(page.Items), ShouldEqual, 1)
+				So(page.Items[0].ID, ShouldEqual, p.ID)
+				So(page.HasMore, ShouldBeFalse)
+
+				_, err = tsPostRepo.FindPage(context.Background(), models.PageRequest{OrderBy: models.Asc("Missing")})
+				So(errors.Is(err, models.ErrInvalidSpec), ShouldBeTrue)
+			})
+		})
+
+		Convey("Test migrations", func() {
+			m := mongostore.NewMigrator(db)
+			m.Migrations = append([]mongostore.Migration(nil), m.Migrations...)
+
+			Convey("Should be at the latest version", func() {
+				version, err := m.Version(context.Background())
+				So(err, ShouldBeNil)
+				So(version, ShouldEqual, m.Migrations[len(m.Migrations)-1].Version)
+
+				done, err := m.Up(context.Background())
+				So(err, ShouldBeNil)
+				So(len(done), ShouldEqual, 0)
+			})
+
+			Convey("Should only list the migrations on a dry run", func() {
+				m.DryRun = true
+				done, err := m.Down(context.Background(), 0)
+				So(err, ShouldBeNil)
+				So(len(done), ShouldEqual, len(m.Migrations))
+
+				names, err := db.ListCollectionNames(context.Background(), bson.M{"name": mongostore.PostCollection})
+				So(err, ShouldBeNil)
+				So(len(names), ShouldEqual, 1)
+			})
+
+			Convey("Should migrate down and up again", func() {
+				done, err := m.Down(context.Background(), 0)
+				So(err, ShouldBeNil)
+				So(len(done), ShouldEqual, len(m.Migrations))
+				names, err := db.ListCollectionNames(context.Background(), bson.M{"name": mongostore.PostCollection})
+				So(err, ShouldBeNil)
+				So(len(names), ShouldEqual, 0)
+
+				done, err = m.Up(context.Background())
+				So(err, ShouldBeNil)
+				So(len(done), ShouldEqual, len(m.Migrations))
+				try(postRepo.Save(context.Background(), &models.Post{Title: "implement repository pattern in go"}))
+			})
+
+			Convey("Should refuse to run after an applied migration was renamed", func() {
+				m.Migrations[0].Name += "_renamed"
+				_, err := m.Up(context.Background())
+				So(errors.Is(err, models.ErrChecksumMismatch), ShouldBeTrue)
+			})
+		})
+
+		Convey("Test ensure schema", func() {
+			Convey("Should change nothing on an up to date database", func() {
+				changes, err := mongostore.EnsureSchema(context.Background(), db)
+				So(err, ShouldBeNil)
+				So(len(changes), ShouldEqual, 0)
+			})
+
+			Convey("Should restore missing collections, indexes and validators", func() {
+				comments := db.Collection(mongostore.CommentCollection)
+				_, err := comments.Indexes().DropOne(context.Background(), "post_id_1")
+				try(err)
+				cmd := bson.D{{Key: "collMod", Value: mongostore.CommentCollection}, {Key: "validator", Value: bson.D{}}}
+				try(db.RunCommand(context.Background(), cmd).Err())
+				try(db.Collection(mongostore.PostCollection).Drop(context.Background()))
+
+				changes, err := mongostore.EnsureSchema(context.Background(), db)
+				So(err, ShouldBeNil)
+				So(changes, ShouldResemble, []string{
+					"created collection posts",
+					"updated validator of comments",
+					"created index comments.post_id_1",
+				})
+			})
+
+			Convey("Should reject documents breaking the models", func() {
+				doc := bson.M{"_id": 1, "post_id": "1", "review": "yayy"}
+				_, err := db.Collection(mongostore.CommentCollection).InsertOne(context.Background(), doc)
+				So(err, ShouldNotBeNil)
+
+				err = postRepo.Save(context.Background(), &models.Post{Title: strings.Repeat("a", 251)})
+				So(errors.Is(err, models.ErrInvalidEntity), ShouldBeTrue)
+				try(postRepo.Save(context.Background(), &models.Post{Title: strings.Repeat("a", 250)}))
+			})
+		})
+
+		Convey("Test tracing", func() {
+			exporter := &tracing.InMemoryExporter{}
+			tracedPostRepo := repositories.NewTracedPostRepository(postRepo, tracing.NewTracer(exporter))
+
+			p := &models.Post{Title: "implement repository pattern in go"}
+			try(tracedPostRepo.Save(context.Background(), p))
+			_, err := tracedPostRepo.FindByID(context.Background(), p.ID)
+			try(err)
+			byName := map[string]tracing.SpanData{}
+			for _, span := range exporter.Spans() {
+				byName[span.Name] = span
+			}
+
+			Convey("Should record the commands as children of the operations", func() {
+				find := byName["mongo find"]
+				So(find.ParentID, ShouldEqual, byName["posts.FindByID"].SpanID)
+				So(find.Attributes["db.system"], ShouldEqual, "mongodb")
+				So(find.Attributes["db.collection"], ShouldEqual, "posts")
+				So(find.Attributes["db.rows"], ShouldEqual, 1)
+				So(byName["posts.FindByID"].Attributes["db.table"], ShouldEqual, "posts")
+			})
+
+			Convey("Should redact the documents of the commands", func() {
+				for _, span := range exporter.Spans() {
+					if statement, ok := span.Attributes["db.statement"].(string); ok {
+						So(statement, ShouldNotContainSubstring, p.Title)
+					}
+				}
+				So(byName["mongo insert"].Attributes["db.statement"], ShouldContainSubstring, querylog.Redacted)
+			})
+		})
+
+		Convey("Test query logging", func() {
+			var buf bytes.Buffer
+			queryLog.Logger = slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+			defer func() { queryLog.Logger = slog.New(slog.NewJSONHandler(io.Discard, nil)) }()
+
+			p := &models.Post{Title: "implement repository pattern in go"}
+			try(postRepo.InTransaction(context.Background(), func(ctx context.Context) error {
+				return postRepo.Save(ctx, p)
+			}))
+
+			var records []map[string]interface{}
+			for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+				record := map[string]interface{}{}
+				try(json.Unmarshal([]byte(line), &record))
+				records = append(records, record)
+			}
+
+			Convey("Should log the commands with redacted documents and their transaction", func() {
+				var update map[string]interface{}
+				for _, record := range records {
+					if strings.HasPrefix(record["statement"].(string), `{"update":"posts"`) {
+						update = record
+					}
+				}
+				So(update, ShouldNotBeNil)
+				So(update["db.system"], ShouldEqual, "mongodb")
+				So(update["statement"], ShouldContainSubstring, querylog.Redacted)
+				So(update["statement"], ShouldNotContainSubstring, p.Title)
+				So(update["rows"], ShouldEqual, 1)
+				So(update["tx"], ShouldNotBeEmpty)
+			})
+		})
+
 		Convey("Test nested transactions", func() {
 
 			Convey("Test nested transaction commit", func() {
@@ -235,7 +991,7 @@ func TestMongoRepository(t *testing.T) {
 						return err
 					}
 
-					return postRepo.InTransaction(context.Background(), func(ctx context.Context) error {
+					innerErr := postRepo.InTransaction(context.Background(), func(ctx context.Context) error {
 						p := &models.Post{
 							Title: "implement repository pattern in go",
 						}
@@ -259,6 +1015,9 @@ func TestMongoRepository(t *testing.T) {
 						}
 						return errors.New("should rollback")
 					})
+					// the inner transaction rolls back on its own, the outer one still commits
+					So(innerErr, ShouldNotBeNil)
+					return nil
 				})
 
 				Convey("Should partial commit successfully", func() {
@@ -336,7 +1095,7 @@ func TestMongoRepository(t *testing.T) {
 				})
 
 				Convey("Should rollback successfully", func() {
-					So(err, ShouldBeNil)
+					So(err, ShouldNotBeNil)
 
 					var posts []bson.M
 					cur, err := db.Collection(mongostore.PostCollection).Find(context.Background(), bson.D{})
@@ -0,0 +1,165 @@
+package mongostore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+
+	"github.com/hendratommy/mongo-sequence/pkg/sequence"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// DefaultBatchSize is the most documents InsertAll sends, and ids it reserves, in a single call unless told otherwise,
+// see WithBatchSize.
+const DefaultBatchSize = 1000
+
+// WithBatchSize returns a copy of c whose InsertAll sends at most size documents per call, DefaultBatchSize when size
+// is not positive.
+func (c *Collection[T, ID]) WithBatchSize(size int) *Collection[T, ID] {
+	cc := *c
+	cc.batchSize = size
+	return &cc
+}
+
+// SaveAll saves every m like Save, the ones with a zero id are inserted by InsertAll. It should run in a transaction
+// so a failure does not leave part of ms saved.
+func (c *Collection[T, ID]) SaveAll(ctx context.Context, db *mongo.Database, ms []*T) error {
+	var inserts []*T
+	for _, m := range ms {
+		if c.id(m).IsZero() {
+			inserts = append(inserts, m)
+			continue
+		}
+		if err := c.Save(ctx, db, m); err != nil {
+			return err
+		}
+	}
+	return c.InsertAll(ctx, db, inserts)
+}
+
+// InsertAll inserts ms with InsertMany calls of at most WithBatchSize documents. Zero ids are taken from a block of
+// Sequence values reserved in a single call per batch. On a versioned collection every m starts at version 1.
+func (c *Collection[T, ID]) InsertAll(ctx context.Context, db *mongo.Database, ms []*T) error {
+	size := c.batchSize
+	if size <= 0 {
+		size = DefaultBatchSize
+	}
+	for start := 0; start < len(ms); start += size {
+		end := start + size
+		if end > len(ms) {
+			end = len(ms)
+		}
+		if err := c.insertBatch(ctx, db, ms[start:end]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *Collection[T, ID]) insertBatch(ctx context.Context, db *mongo.Database, ms []*T) error {
+	var zero, explicit []*T
+	for _, m := range ms {
+		switch {
+		case c.Sequence == "":
+		case c.id(m).IsZero():
+			zero = append(zero, m)
+		default:
+			explicit = append(explicit, m)
+		}
+	}
+	if len(zero) > 0 {
+		first, err := reserve(db, c.Sequence, len(zero))
+		if err != nil {
+			return err
+		}
+		for i, m := range zero {
+			c.id(m).SetInt(first + int64(i))
+		}
+	}
+
+	docs := make([]interface{}, len(ms))
+	olds := make([]int64, len(ms))
+	now := c.clock()
+	for i, m := range ms {
+		c.stamp(m, now)
+		if c.versionField >= 0 {
+			olds[i] = c.version(m).Int()
+			c.version(m).SetInt(1)
+		}
+		docs[i] = m
+	}
+	if _, err := c.coll(db).InsertMany(ctx, docs); err != nil {
+		if c.versionField >= 0 {
+			for i, m := range ms {
+				c.version(m).SetInt(olds[i])
+			}
+		}
+		return translateError(err)
+	}
+	return c.syncSequence(db, explicit...)
+}
+
+// syncSequence moves Sequence past the explicit ids of ms, so the ids it generates later do not collide with them.
+func (c *Collection[T, ID]) syncSequence(db *mongo.Database, ms ...*T) error {
+	if c.Sequence == "" || len(ms) == 0 {
+		return nil
+	}
+	var max int64
+	for _, m := range ms {
+		if id := c.id(m); id.Kind() == reflect.Int && id.Int() > max {
+			max = id.Int()
+		}
+	}
+	if max == 0 {
+		return nil
+	}
+	return advance(db, c.Sequence, max)
+}
+
+// advance makes the sequence name hand out values above id, it never moves it back. Like reserve it runs outside the
+// transaction in ctx.
+func advance(db *mongo.Database, name string, id int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), sequence.DefaultTimeout)
+	defer cancel()
+
+	// the sequence document holds the next value to hand out
+	_, err := db.Collection(sequence.DefaultCollectionName).UpdateOne(ctx, bson.M{"name": name},
+		bson.M{"$max": bson.M{"value": id + 1}}, options.Update().SetUpsert(true))
+	return translateError(err)
+}
+
+// reserve takes n values of the sequence name at once and returns the first. It shares the documents of the default
+// sequence, which must have been set up on db, so NextVal and reserve never hand out the same value. Like NextVal it
+// runs outside the transaction in ctx, reserved values are not given back on rollback.
+func reserve(db *mongo.Database, name string, n int) (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), sequence.DefaultTimeout)
+	defer cancel()
+
+	coll := db.Collection(sequence.DefaultCollectionName)
+	opts := options.FindOneAndUpdate().SetUpsert(true)
+	filter := bson.M{"name": name}
+	inc := bson.M{"$inc": bson.M{"value": n}}
+	res := coll.FindOneAndUpdate(ctx, filter, inc, opts)
+	if errors.Is(res.Err(), mongo.ErrNoDocuments) {
+		// the sequence was just created by the upsert, which returns no document
+		res = coll.FindOneAndUpdate(ctx, filter, inc, opts)
+	}
+	if err := res.Err(); err != nil {
+		return 0, translateError(err)
+	}
+	var doc bson.M
+	if err := res.Decode(&doc); err != nil {
+		return 0, err
+	}
+	switch v := doc["value"].(type) {
+	case int32:
+		return int64(v), nil
+	case int64:
+		return int64(v), nil
+	default:
+		return 0, fmt.Errorf("mongostore: sequence %s has a non integer value %v", name, v)
+	}
+}
@@ -0,0 +1,459 @@
+package mongostore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/hendratommy/mongo-sequence/pkg/sequence"
+	"github.com/hendratommy/repository-pattern/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	idField        = "_id"
+	versionField   = "version"
+	deletedAtField = "deleted_at"
+	createdAtField = "created_at"
+	updatedAtField = "updated_at"
+)
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// Collection maps model T onto a mongo collection using the `bson` struct tags of T, the field tagged `bson:"_id"` is
+// the document id. When Sequence is set, documents saved with a zero id get their id from that sequence.
+// An int field tagged `bson:"version"` turns on optimistic locking, see models.ErrStaleVersion. A *time.Time field
+// tagged `bson:"deleted_at"` is only written by Delete, Restore and Purge, see SoftDelete. time.Time fields tagged
+// `bson:"created_at"` and `bson:"updated_at"` are set on insert, and updated_at again on every update.
+type Collection[T any, ID comparable] struct {
+	Name           string
+	Sequence       string
+	idField        int
+	versionField   int
+	createdAtField int
+	updatedAtField int
+	deletedAt      bool
+	softDelete     bool
+	byField        map[string]string
+	now            func() time.Time
+	batchSize      int
+}
+
+// NewCollection creates Collection for model T, it panics when T is not a struct or has no field tagged `bson:"_id"`.
+func NewCollection[T any, ID comparable](name, seq string) *Collection[T, ID] {
+	c := &Collection[T, ID]{
+		Name: name, Sequence: seq, idField: -1, versionField: -1, createdAtField: -1, updatedAtField: -1,
+		byField: map[string]string{}, now: time.Now,
+	}
+	rt := reflect.TypeOf((*T)(nil)).Elem()
+	if rt.Kind() != reflect.Struct {
+		panic(fmt.Sprintf("mongostore: %s is not a struct", rt))
+	}
+	for i := 0; i < rt.NumField(); i++ {
+		key := strings.Split(rt.Field(i).Tag.Get("bson"), ",")[0]
+		if key != "" && key != "-" {
+			c.byField[rt.Field(i).Name] = key
+		}
+		switch key {
+		case idField:
+			c.idField = i
+		case versionField:
+			if rt.Field(i).Type.Kind() == reflect.Int {
+				c.versionField = i
+			}
+		case deletedAtField:
+			c.deletedAt = rt.Field(i).Type == reflect.TypeOf((*time.Time)(nil))
+		case createdAtField:
+			if rt.Field(i).Type == timeType {
+				c.createdAtField = i
+			}
+		case updatedAtField:
+			if rt.Field(i).Type == timeType {
+				c.updatedAtField = i
+			}
+		}
+	}
+	if c.idField < 0 {
+		panic(fmt.Sprintf("mongostore: %s has no field tagged `bson:\"%s\"`", rt, idField))
+	}
+	if k := rt.Field(c.idField).Type.Kind(); seq != "" && k != reflect.Int && k != reflect.Int64 {
+		panic(fmt.Sprintf("mongostore: %s id must be an int to use sequence %s", rt, seq))
+	}
+	return c
+}
+
+// SoftDelete returns a copy of c whose Delete sets deleted_at instead of removing the document, every finder of the
+// copy then leaves out the documents with a deleted_at. It panics when T has no *time.Time field tagged
+// `bson:"deleted_at"`.
+func (c *Collection[T, ID]) SoftDelete() *Collection[T, ID] {
+	if !c.deletedAt {
+		panic(fmt.Sprintf("mongostore: %s has no %s field", c.Name, deletedAtField))
+	}
+	soft := *c
+	soft.softDelete = true
+	return &soft
+}
+
+// WithClock returns a copy of c taking the time of its timestamps from now.
+func (c *Collection[T, ID]) WithClock(now func() time.Time) *Collection[T, ID] {
+	cc := *c
+	cc.now = now
+	return &cc
+}
+
+// clock returns the current time in UTC, rounded to the millisecond mongo keeps.
+func (c *Collection[T, ID]) clock() time.Time {
+	return c.now().UTC().Truncate(time.Millisecond)
+}
+
+func (c *Collection[T, ID]) field(m *T, i int) reflect.Value {
+	return reflect.ValueOf(m).Elem().Field(i)
+}
+
+// stamp sets the created_at of m and its updated_at when they are zero.
+func (c *Collection[T, ID]) stamp(m *T, now time.Time) {
+	if c.createdAtField >= 0 && c.field(m, c.createdAtField).Interface().(time.Time).IsZero() {
+		c.field(m, c.createdAtField).Set(reflect.ValueOf(now))
+	}
+	if c.updatedAtField >= 0 && c.field(m, c.updatedAtField).Interface().(time.Time).IsZero() {
+		c.field(m, c.updatedAtField).Set(reflect.ValueOf(now))
+	}
+}
+
+// update renders the update writing m over a document, created_at is only set when the update inserts and deleted_at
+// is left to Delete, Restore and Purge.
+func (c *Collection[T, ID]) update(m *T) (bson.M, error) {
+	b, err := bson.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+	var set bson.M
+	if err := bson.Unmarshal(b, &set); err != nil {
+		return nil, err
+	}
+	delete(set, idField)
+	delete(set, deletedAtField)
+	update := bson.M{"$set": set}
+	if c.createdAtField >= 0 {
+		update["$setOnInsert"] = bson.M{createdAtField: set[createdAtField]}
+		delete(set, createdAtField)
+	}
+	return update, nil
+}
+
+// alive restricts filter to the documents not soft deleted, a missing deleted_at counting as null.
+func (c *Collection[T, ID]) alive(filter interface{}) interface{} {
+	if !c.softDelete {
+		return filter
+	}
+	return bson.M{"$and": bson.A{filter, bson.M{deletedAtField: nil}}}
+}
+
+func (c *Collection[T, ID]) coll(db *mongo.Database) *mongo.Collection {
+	return db.Collection(c.Name)
+}
+
+func (c *Collection[T, ID]) id(m *T) reflect.Value {
+	return reflect.ValueOf(m).Elem().Field(c.idField)
+}
+
+func (c *Collection[T, ID]) version(m *T) reflect.Value {
+	return reflect.ValueOf(m).Elem().Field(c.versionField)
+}
+
+// staleOrNotFound tells apart why a versioned write on the document with id matched nothing.
+func (c *Collection[T, ID]) staleOrNotFound(ctx context.Context, db *mongo.Database, id interface{}, version int64) error {
+	n, err := c.coll(db).CountDocuments(ctx, c.alive(bson.M{idField: id}))
+	if err != nil {
+		return translateError(err)
+	}
+	if n == 0 {
+		return fmt.Errorf("%w: %s %v", models.ErrNotFound, c.Name, id)
+	}
+	return fmt.Errorf("%w: %s %v at version %d", models.ErrStaleVersion, c.Name, id, version)
+}
+
+func (c *Collection[T, ID]) FindByID(ctx context.Context, db *mongo.Database, id ID) (*T, error) {
+	m := new(T)
+	res := c.coll(db).FindOne(ctx, c.alive(bson.M{idField: id}))
+	if err := res.Err(); err != nil {
+		return nil, translateError(err)
+	}
+	return m, translateError(res.Decode(m))
+}
+
+func (c *Collection[T, ID]) Exists(ctx context.Context, db *mongo.Database, id ID) (bool, error) {
+	opts := options.FindOne().SetProjection(bson.M{idField: 1})
+	err := c.coll(db).FindOne(ctx, c.alive(bson.M{idField: id}), opts).Err()
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return false, nil
+	}
+	return err == nil, translateError(err)
+}
+
+func (c *Collection[T, ID]) FindAll(ctx context.Context, db *mongo.Database) ([]*T, error) {
+	return c.Find(ctx, db, models.All())
+}
+
+// FindBy returns every document matching filter ordered by id.
+func (c *Collection[T, ID]) FindBy(ctx context.Context, db *mongo.Database, filter interface{}) ([]*T, error) {
+	opts := options.Find().SetSort(bson.M{idField: 1})
+	cur, err := c.coll(db).Find(ctx, c.alive(filter), opts)
+	if err != nil {
+		return nil, translateError(err)
+	}
+	var ms []*T
+	err = cur.All(ctx, &ms)
+	return ms, translateError(err)
+}
+
+// FindPage returns a page of documents ordered by id.
+func (c *Collection[T, ID]) FindPage(ctx context.Context, db *mongo.Database, req models.PageRequest) (*models.Page[T], error) {
+	return c.FindPageBy(ctx, db, models.All(), req)
+}
+
+// FindPageBy returns a page of the documents matching spec in the order of req, the order of spec is ignored.
+func (c *Collection[T, ID]) FindPageBy(ctx context.Context, db *mongo.Database, spec models.Spec, req models.PageRequest) (*models.Page[T], error) {
+	key, err := c.pageKey(req.OrderBy)
+	if err != nil {
+		return nil, err
+	}
+	filter, err := c.specFilter(spec, false)
+	if err != nil {
+		return nil, err
+	}
+	op, dir := "$gt", 1
+	if req.OrderBy.Desc {
+		op, dir = "$lt", -1
+	}
+	if req.Cursor != "" {
+		after, value, err := c.decodeCursor(req.Cursor, key)
+		if err != nil {
+			return nil, err
+		}
+		next := bson.M{idField: bson.M{op: after}}
+		if key != nil {
+			next = bson.M{"$or": bson.A{
+				bson.M{key.name: bson.M{op: value}},
+				bson.M{key.name: value, idField: bson.M{op: after}},
+			}}
+		}
+		filter = bson.M{"$and": bson.A{filter, next}}
+	}
+	sort := bson.D{{Key: idField, Value: dir}}
+	if key != nil {
+		sort = append(bson.D{{Key: key.name, Value: dir}}, sort...)
+	}
+	// one document more than asked tells whether there is a next page
+	opts := options.Find().SetSort(sort).SetLimit(int64(req.Size() + 1))
+	if req.Offset > 0 {
+		opts.SetSkip(int64(req.Offset))
+	}
+	cur, err := c.coll(db).Find(ctx, filter, opts)
+	if err != nil {
+		return nil, translateError(err)
+	}
+	var ms []*T
+	if err := cur.All(ctx, &ms); err != nil {
+		return nil, translateError(err)
+	}
+	return models.NewPage(req, ms, func(m *T) string {
+		if key == nil {
+			return models.EncodeCursor(c.id(m).Interface().(ID), nil)
+		}
+		return models.EncodeCursor(c.id(m).Interface().(ID), c.field(m, key.field).Interface())
+	}), nil
+}
+
+type pageKey struct {
+	name  string
+	field int
+}
+
+// pageKey resolves the field a page is ordered by before the id, it is nil when the page is only ordered by id.
+func (c *Collection[T, ID]) pageKey(o models.Order) (*pageKey, error) {
+	if o.Field == "" {
+		return nil, nil
+	}
+	name, err := c.key(o.Field)
+	if err != nil {
+		return nil, err
+	}
+	if name == idField {
+		return nil, nil
+	}
+	f, _ := reflect.TypeOf((*T)(nil)).Elem().FieldByName(o.Field)
+	return &pageKey{name: name, field: f.Index[0]}, nil
+}
+
+func (c *Collection[T, ID]) decodeCursor(cursor string, key *pageKey) (ID, interface{}, error) {
+	if key == nil {
+		after, err := models.DecodeCursor[ID](cursor, nil)
+		return after, nil, err
+	}
+	value := reflect.New(reflect.TypeOf((*T)(nil)).Elem().Field(key.field).Type)
+	after, err := models.DecodeCursor[ID](cursor, value.Interface())
+	if tm, ok := value.Interface().(*time.Time); ok {
+		return after, tm.UTC(), err
+	}
+	return after, value.Elem().Interface(), err
+}
+
+// assignID sets the id of m from Sequence when it is zero.
+func (c *Collection[T, ID]) assignID(m *T) error {
+	id := c.id(m)
+	if id.IsZero() && c.Sequence != "" {
+		seq, err := sequence.NextVal(c.Sequence)
+		if err != nil {
+			return err
+		}
+		id.SetInt(int64(seq))
+	}
+	return nil
+}
+
+// Save inserts m when its id is zero, otherwise it inserts or updates the document with that id and moves Sequence
+// past it. On a versioned collection an update fails with models.ErrStaleVersion when the document was changed since
+// m was read.
+func (c *Collection[T, ID]) Save(ctx context.Context, db *mongo.Database, m *T) error {
+	if c.id(m).IsZero() {
+		return c.Insert(ctx, db, m)
+	}
+	if c.versionField >= 0 {
+		if err := c.Update(ctx, db, m); !errors.Is(err, models.ErrNotFound) {
+			return err
+		}
+		return c.Insert(ctx, db, m)
+	}
+	now := c.clock()
+	c.stamp(m, now)
+	if c.updatedAtField >= 0 {
+		c.field(m, c.updatedAtField).Set(reflect.ValueOf(now))
+	}
+	update, err := c.update(m)
+	if err != nil {
+		return err
+	}
+	opts := options.Update().SetUpsert(true)
+	if _, err = c.coll(db).UpdateOne(ctx, c.alive(bson.M{idField: c.id(m).Interface()}), update, opts); err != nil {
+		return translateError(err)
+	}
+	return c.syncSequence(db, m)
+}
+
+// Insert inserts m, it returns models.ErrConflict when a document with the same id already exists. An explicit id
+// moves Sequence past it. On a versioned collection m starts at version 1.
+func (c *Collection[T, ID]) Insert(ctx context.Context, db *mongo.Database, m *T) error {
+	explicit := !c.id(m).IsZero()
+	if err := c.assignID(m); err != nil {
+		return err
+	}
+	c.stamp(m, c.clock())
+	if c.versionField < 0 {
+		if _, err := c.coll(db).InsertOne(ctx, m); err != nil {
+			return translateError(err)
+		}
+	} else {
+		v := c.version(m)
+		old := v.Int()
+		v.SetInt(1)
+		if _, err := c.coll(db).InsertOne(ctx, m); err != nil {
+			v.SetInt(old)
+			return translateError(err)
+		}
+	}
+	if explicit {
+		return c.syncSequence(db, m)
+	}
+	return nil
+}
+
+// Update writes m over the document with its id, it returns models.ErrNotFound when there is none. On a versioned
+// collection only the document still at the version of m is updated, the version is incremented in the document and
+// in m, otherwise it returns models.ErrStaleVersion. The updated_at of m is set to now, its created_at is not written.
+func (c *Collection[T, ID]) Update(ctx context.Context, db *mongo.Database, m *T) error {
+	id := c.id(m).Interface()
+	row := *m
+	if c.updatedAtField >= 0 {
+		c.field(&row, c.updatedAtField).Set(reflect.ValueOf(c.clock()))
+	}
+	filter := bson.M{idField: id}
+	if c.versionField >= 0 {
+		filter[versionField] = c.version(m).Int()
+		c.version(&row).SetInt(c.version(m).Int() + 1)
+	}
+	update, err := c.update(&row)
+	if err != nil {
+		return err
+	}
+	delete(update, "$setOnInsert")
+	res, err := c.coll(db).UpdateOne(ctx, c.alive(filter), update)
+	if err != nil {
+		return translateError(err)
+	}
+	if res.MatchedCount == 0 {
+		if c.versionField >= 0 {
+			return c.staleOrNotFound(ctx, db, id, c.version(m).Int())
+		}
+		return fmt.Errorf("%w: %s %v", models.ErrNotFound, c.Name, id)
+	}
+	*m = row
+	return nil
+}
+
+// Delete removes the document with id, or sets its deleted_at on a SoftDelete collection. It returns
+// models.ErrNotFound when there is none.
+func (c *Collection[T, ID]) Delete(ctx context.Context, db *mongo.Database, id ID) error {
+	if c.softDelete {
+		update := bson.M{"$set": bson.M{deletedAtField: c.clock()}}
+		return c.updateOne(ctx, db, id, c.alive(bson.M{idField: id}), update)
+	}
+	res, err := c.coll(db).DeleteOne(ctx, bson.M{idField: id})
+	if err != nil {
+		return translateError(err)
+	}
+	if res.DeletedCount == 0 {
+		return fmt.Errorf("%w: %s %v", models.ErrNotFound, c.Name, id)
+	}
+	return nil
+}
+
+// Restore clears the deleted_at of the document with id, it returns models.ErrNotFound when there is no such deleted
+// document.
+func (c *Collection[T, ID]) Restore(ctx context.Context, db *mongo.Database, id ID) error {
+	if !c.deletedAt {
+		return fmt.Errorf("mongostore: %s has no %s field", c.Name, deletedAtField)
+	}
+	filter := bson.M{idField: id, deletedAtField: bson.M{"$ne": nil}}
+	return c.updateOne(ctx, db, id, filter, bson.M{"$set": bson.M{deletedAtField: nil}})
+}
+
+// Purge removes the documents deleted more than olderThan ago and returns how many there were.
+func (c *Collection[T, ID]) Purge(ctx context.Context, db *mongo.Database, olderThan time.Duration) (int64, error) {
+	if !c.deletedAt {
+		return 0, fmt.Errorf("mongostore: %s has no %s field", c.Name, deletedAtField)
+	}
+	filter := bson.M{deletedAtField: bson.M{"$lt": c.clock().Add(-olderThan)}}
+	res, err := c.coll(db).DeleteMany(ctx, filter)
+	if err != nil {
+		return 0, translateError(err)
+	}
+	return res.DeletedCount, nil
+}
+
+// updateOne applies update to the document with id matching filter, it returns models.ErrNotFound when none matches.
+func (c *Collection[T, ID]) updateOne(ctx context.Context, db *mongo.Database, id ID, filter interface{}, update bson.M) error {
+	res, err := c.coll(db).UpdateOne(ctx, filter, update)
+	if err != nil {
+		return translateError(err)
+	}
+	if res.MatchedCount == 0 {
+		return fmt.Errorf("%w: %s %v", models.ErrNotFound, c.Name, id)
+	}
+	return nil
+}
@@ -2,7 +2,7 @@ package mongostore
 
 import (
 	"context"
-	"github.com/hendratommy/mongo-sequence/pkg/sequence"
+	"fmt"
 	"github.com/hendratommy/repository-pattern/models"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
@@ -14,7 +14,12 @@ const (
 	CommentCollection = "comments"
 )
 
-func FindByID(ctx context.Context, coll *mongo.Collection, id int, m interface{}) error {
+var (
+	Posts    = NewCollection[models.Post, int](PostCollection, "postSeq")
+	Comments = NewCollection[models.Comment, int](CommentCollection, "commentSeq")
+)
+
+func FindByID(ctx context.Context, coll *mongo.Collection, id interface{}, m interface{}) error {
 	res := coll.FindOne(ctx, bson.M{"_id": id})
 	if err := res.Err(); err != nil {
 		return err
@@ -23,51 +28,53 @@ func FindByID(ctx context.Context, coll *mongo.Collection, id int, m interface{}
 }
 
 func FindPostByID(ctx context.Context, db *mongo.Database, id int) (*models.Post, error) {
-	p := new(models.Post)
-	err := FindByID(ctx, db.Collection(PostCollection), id, p)
-	return p, err
+	return Posts.FindByID(ctx, db, id)
 }
 
 func SavePost(ctx context.Context, db *mongo.Database, p *models.Post) error {
-	if p.ID == 0 {
-		id, err := sequence.NextVal("postSeq")
-		if err != nil {
-			return err
-		}
-		p.ID = id
+	return Posts.Save(ctx, db, p)
+}
+
+// DeletePost fails with models.ErrInvalidReference while the post still has comments, mirroring the foreign key of
+// the sql schema. The check and the delete are only atomic when ctx carries a transaction.
+func DeletePost(ctx context.Context, db *mongo.Database, id int) error {
+	n, err := db.Collection(CommentCollection).CountDocuments(ctx, bson.M{"post_id": id}, options.Count().SetLimit(1))
+	if err != nil {
+		return translateError(err)
 	}
-	opts := options.FindOneAndReplace().SetUpsert(true)
-	var doc bson.M
-	err := db.Collection(PostCollection).FindOneAndReplace(ctx, bson.D{{"_id", p.ID}}, p, opts).Decode(&doc)
-	if err != nil && err != mongo.ErrNoDocuments {
-		return err
+	if n > 0 {
+		return fmt.Errorf("%w: post %d still has comments", models.ErrInvalidReference, id)
 	}
-	return nil
+	return Posts.Delete(ctx, db, id)
 }
 
-func FindCommentsByPostID(ctx context.Context, db *mongo.Database, postID int) ([]*models.Comment, error) {
-	cur, err := db.Collection(CommentCollection).Find(ctx, bson.D{{ "post_id", postID }})
+// DeletePostCascade deletes the comments of the post then the post itself, returning how many comments were deleted.
+// It must run in a transaction to be atomic.
+func DeletePostCascade(ctx context.Context, db *mongo.Database, id int) (int64, error) {
+	return DeletePostCascadeFrom(ctx, db, Posts, Comments, id)
+}
+
+// DeletePostCascadeFrom is DeletePostCascade on posts and comments, which soft delete and stamp the time as they are
+// configured, see SoftDelete and WithClock.
+func DeletePostCascadeFrom(ctx context.Context, db *mongo.Database, posts *Collection[models.Post, int], comments *Collection[models.Comment, int], id int) (int64, error) {
+	n, err := comments.DeleteBy(ctx, db, models.Where(models.Eq("PostID", id)))
 	if err != nil {
-		return nil, err
+		return 0, err
+	}
+	if err := posts.Delete(ctx, db, id); err != nil {
+		return 0, err
 	}
-	var comments []*models.Comment
-	err = cur.All(ctx, &comments)
-	return comments, err
+	return n, nil
+}
+
+func FindCommentsByPostID(ctx context.Context, db *mongo.Database, postID int) ([]*models.Comment, error) {
+	return Comments.FindBy(ctx, db, bson.M{"post_id": postID})
+}
+
+func FindCommentPageByPostID(ctx context.Context, db *mongo.Database, postID int, req models.PageRequest) (*models.Page[models.Comment], error) {
+	return Comments.FindPageBy(ctx, db, models.Where(models.Eq("PostID", postID)), req)
 }
 
 func SaveComment(ctx context.Context, db *mongo.Database, c *models.Comment) error {
-	if c.ID == 0 {
-		id, err := sequence.NextVal("commentSeq")
-		if err != nil {
-			return err
-		}
-		c.ID = id
-	}
-	opts := options.FindOneAndReplace().SetUpsert(true)
-	var doc bson.M
-	err := db.Collection(CommentCollection).FindOneAndReplace(ctx, bson.D{{"_id", c.ID}}, c, opts).Decode(&doc)
-	if err != nil && err != mongo.ErrNoDocuments {
-		return err
-	}
-	return nil
-}
\ No newline at end of file
+	return Comments.Save(ctx, db, c)
+}
@@ -0,0 +1,95 @@
+package mongostore
+
+import (
+	"errors"
+	"fmt"
+	"github.com/hendratommy/repository-pattern/models"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// wrapError makes err match the domain error with errors.Is while keeping the driver error reachable.
+func wrapError(domain error, err error) error {
+	return fmt.Errorf("%w: %w", domain, err)
+}
+
+func isDuplicateKeyCode(code int) bool {
+	return code == 11000 || code == 11001 || code == 12582
+}
+
+func isValidationCode(code int) bool {
+	return code == 121 // DocumentValidationFailure
+}
+
+func isDuplicateKeyError(err error) bool {
+	return hasErrorCode(err, isDuplicateKeyCode)
+}
+
+// hasErrorCode reports whether a write or command error in err has a code matching is.
+func hasErrorCode(err error, is func(int) bool) bool {
+	var we mongo.WriteException
+	if errors.As(err, &we) {
+		for _, e := range we.WriteErrors {
+			if is(e.Code) {
+				return true
+			}
+		}
+		if we.WriteConcernError != nil && is(we.WriteConcernError.Code) {
+			return true
+		}
+	}
+	var bwe mongo.BulkWriteException
+	if errors.As(err, &bwe) {
+		for _, e := range bwe.WriteErrors {
+			if is(e.Code) {
+				return true
+			}
+		}
+	}
+	var ce mongo.CommandError
+	return errors.As(err, &ce) && is(int(ce.Code))
+}
+
+// Error labels of the server and driver telling how to recover from the failure of a transaction.
+const (
+	TransientTransactionError      = "TransientTransactionError"
+	UnknownTransactionCommitResult = "UnknownTransactionCommitResult"
+)
+
+// HasErrorLabel reports whether a write or command error in err carries label.
+func HasErrorLabel(err error, label string) bool {
+	var we mongo.WriteException
+	if errors.As(err, &we) && we.HasErrorLabel(label) {
+		return true
+	}
+	var bwe mongo.BulkWriteException
+	if errors.As(err, &bwe) && bwe.HasErrorLabel(label) {
+		return true
+	}
+	var ce mongo.CommandError
+	return errors.As(err, &ce) && ce.HasErrorLabel(label)
+}
+
+// IsTransientTransactionError reports whether the transaction failed on a transient error, like a write conflict or
+// an election, and can be run again from the start.
+func IsTransientTransactionError(err error) bool {
+	return HasErrorLabel(err, TransientTransactionError)
+}
+
+// IsUnknownTransactionCommitResult reports whether a commit may or may not have happened, the commit can be retried.
+func IsUnknownTransactionCommitResult(err error) bool {
+	return HasErrorLabel(err, UnknownTransactionCommitResult)
+}
+
+func translateError(err error) error {
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, mongo.ErrNoDocuments):
+		return wrapError(models.ErrNotFound, err)
+	case isDuplicateKeyError(err):
+		return wrapError(models.ErrConflict, err)
+	case hasErrorCode(err, isValidationCode):
+		return wrapError(models.ErrInvalidEntity, err)
+	}
+	return err
+}
@@ -0,0 +1,149 @@
+package mongostore
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"github.com/hendratommy/repository-pattern/querylog"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/event"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// commandMetadata are the fields the driver adds to every command, left out of the logs.
+var commandMetadata = map[string]bool{
+	"lsid": true, "txnNumber": true, "autocommit": true, "startTransaction": true,
+	"$clusterTime": true, "$db": true, "$readPreference": true,
+}
+
+type startedCommand struct {
+	ctx       context.Context
+	statement string
+	txID      string
+}
+
+// LoggingMonitor returns a command monitor logging every command to l, with its duration, the documents it returned
+// or changed and its transaction, the session id and transaction number. The values of the documents of a command,
+// like its filter or the documents it inserts, go through the redactor of l. Set it with options.Client().SetMonitor,
+// along with TracingMonitor through Monitors.
+func LoggingMonitor(l *querylog.Logger) *event.CommandMonitor {
+	var started sync.Map // request id to startedCommand
+	finish := func(requestID int64, duration int64, rows int64, err error) {
+		cmd, ok := started.LoadAndDelete(requestID)
+		if !ok {
+			return
+		}
+		c := cmd.(startedCommand)
+		l.Log(c.ctx, querylog.Query{
+			System:    "mongodb",
+			Statement: c.statement,
+			Duration:  time.Duration(duration),
+			Rows:      rows,
+			TxID:      c.txID,
+			Err:       err,
+		})
+	}
+	return &event.CommandMonitor{
+		Started: func(ctx context.Context, evt *event.CommandStartedEvent) {
+			started.Store(evt.RequestID, startedCommand{ctx: ctx, statement: redactCommand(l, evt.Command), txID: txID(evt.Command)})
+		},
+		Succeeded: func(_ context.Context, evt *event.CommandSucceededEvent) {
+			rows, ok := replyRows(evt.Reply)
+			if !ok {
+				rows = -1
+			}
+			finish(evt.RequestID, evt.DurationNanos, rows, nil)
+		},
+		Failed: func(_ context.Context, evt *event.CommandFailedEvent) {
+			finish(evt.RequestID, evt.DurationNanos, -1, errors.New(evt.Failure))
+		},
+	}
+}
+
+// Monitors returns a command monitor calling every one of monitors in turn.
+func Monitors(monitors ...*event.CommandMonitor) *event.CommandMonitor {
+	return &event.CommandMonitor{
+		Started: func(ctx context.Context, evt *event.CommandStartedEvent) {
+			for _, m := range monitors {
+				if m.Started != nil {
+					m.Started(ctx, evt)
+				}
+			}
+		},
+		Succeeded: func(ctx context.Context, evt *event.CommandSucceededEvent) {
+			for _, m := range monitors {
+				if m.Succeeded != nil {
+					m.Succeeded(ctx, evt)
+				}
+			}
+		},
+		Failed: func(ctx context.Context, evt *event.CommandFailedEvent) {
+			for _, m := range monitors {
+				if m.Failed != nil {
+					m.Failed(ctx, evt)
+				}
+			}
+		},
+	}
+}
+
+// redactCommand renders cmd as extended json without its metadata, the options of the command are kept while the
+// values of its documents go through the redactor of l.
+func redactCommand(l *querylog.Logger, cmd bson.Raw) string {
+	var doc bson.D
+	if err := bson.Unmarshal(cmd, &doc); err != nil {
+		return cmd.String()
+	}
+	out := make(bson.D, 0, len(doc))
+	for _, e := range doc {
+		if commandMetadata[e.Key] {
+			continue
+		}
+		switch e.Value.(type) {
+		case bson.D, bson.A:
+			e.Value = redactValue(l, e.Key, e.Value)
+		}
+		out = append(out, e)
+	}
+	b, err := bson.MarshalExtJSON(out, false, false)
+	if err != nil {
+		return cmd.String()
+	}
+	return string(b)
+}
+
+func redactValue(l *querylog.Logger, path string, v interface{}) interface{} {
+	switch v := v.(type) {
+	case bson.D:
+		out := make(bson.D, len(v))
+		for i, e := range v {
+			out[i] = bson.E{Key: e.Key, Value: redactValue(l, path+"."+e.Key, e.Value)}
+		}
+		return out
+	case bson.A:
+		out := make(bson.A, len(v))
+		for i, e := range v {
+			out[i] = redactValue(l, path+"."+strconv.Itoa(i), e)
+		}
+		return out
+	}
+	return l.RedactValue(path, v)
+}
+
+// txID identifies the transaction cmd runs in by its session id and transaction number, empty outside transactions.
+func txID(cmd bson.Raw) string {
+	if _, ok := cmd.Lookup("autocommit").BooleanOK(); !ok {
+		return ""
+	}
+	n, ok := cmd.Lookup("txnNumber").Int64OK()
+	if !ok {
+		return ""
+	}
+	_, session, ok := cmd.Lookup("lsid", "id").BinaryOK()
+	if !ok {
+		return ""
+	}
+	return hex.EncodeToString(session) + ":" + strconv.FormatInt(n, 10)
+}
@@ -0,0 +1,231 @@
+package mongostore
+
+import (
+	"context"
+	"fmt"
+	"github.com/hendratommy/repository-pattern/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"sort"
+	"time"
+)
+
+// MigrationCollection records the version and name of every migration applied to a database.
+const MigrationCollection = "schema_migrations"
+
+const (
+	migrationLockCollection = MigrationCollection + "_lock"
+	migrationLock           = "mongostore_migrations"
+	// lockTimeout is how long a lock is held at most, a lock older than that was left by a migrator that died.
+	lockTimeout = 10 * time.Minute
+)
+
+// Migration moves the collections and indexes from the previous version to Version with Up, and back with Down.
+// Migrations are code, so the name recorded when a migration is applied stands in for the checksum of sql
+// migrations.
+type Migration struct {
+	Version int
+	Name    string
+	Up      func(ctx context.Context, db *mongo.Database) error
+	Down    func(ctx context.Context, db *mongo.Database) error
+}
+
+func (m Migration) String() string {
+	return fmt.Sprintf("%d_%s", m.Version, m.Name)
+}
+
+// Migrations of the Posts and Comments collections, ordered by version.
+var Migrations = []Migration{
+	{
+		Version: 1,
+		Name:    "create_posts_and_comments",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			if err := createCollection(ctx, db, PostCollection); err != nil {
+				return err
+			}
+			if err := createCollection(ctx, db, CommentCollection); err != nil {
+				return err
+			}
+			_, err := db.Collection(CommentCollection).Indexes().CreateOne(ctx, mongo.IndexModel{Keys: bson.D{{Key: "post_id", Value: 1}}})
+			return err
+		},
+		Down: func(ctx context.Context, db *mongo.Database) error {
+			if err := db.Collection(CommentCollection).Drop(ctx); err != nil {
+				return err
+			}
+			return db.Collection(PostCollection).Drop(ctx)
+		},
+	},
+}
+
+// createCollection creates the collection name unless it already exists.
+func createCollection(ctx context.Context, db *mongo.Database, name string) error {
+	names, err := db.ListCollectionNames(ctx, bson.M{"name": name})
+	if err != nil || len(names) > 0 {
+		return err
+	}
+	return db.CreateCollection(ctx, name)
+}
+
+// Migrator applies Migrations to DB and records them in MigrationCollection. Migrators of the same database wait for
+// each other on a lock document. Migrations do not run in transactions, a failed one has to be cleaned up by hand.
+type Migrator struct {
+	DB         *mongo.Database
+	Migrations []Migration
+	// DryRun makes Up and Down return the migrations they would run without running them.
+	DryRun bool
+}
+
+// NewMigrator creates a Migrator of the Posts and Comments collections.
+func NewMigrator(db *mongo.Database) *Migrator {
+	return &Migrator{DB: db, Migrations: Migrations}
+}
+
+// Migrate brings db up to the latest version of the Posts and Comments collections.
+func Migrate(ctx context.Context, db *mongo.Database) error {
+	_, err := NewMigrator(db).Up(ctx)
+	return err
+}
+
+// Version returns the highest version applied to the database, 0 when there is none.
+func (m *Migrator) Version(ctx context.Context) (int, error) {
+	var version int
+	err := m.run(ctx, func(applied map[int]string) error {
+		for v := range applied {
+			if v > version {
+				version = v
+			}
+		}
+		return nil
+	})
+	return version, err
+}
+
+// Up applies the migrations not applied yet in version order and returns them. It fails with
+// models.ErrChecksumMismatch, before running anything, when an applied migration was renamed since.
+func (m *Migrator) Up(ctx context.Context) ([]Migration, error) {
+	var done []Migration
+	err := m.run(ctx, func(applied map[int]string) error {
+		for _, mg := range m.Migrations {
+			if _, ok := applied[mg.Version]; ok {
+				continue
+			}
+			if !m.DryRun {
+				if err := mg.Up(ctx, m.DB); err != nil {
+					return fmt.Errorf("mongostore: migration %s: %w", mg, err)
+				}
+				doc := bson.M{idField: mg.Version, "name": mg.Name, "applied_at": time.Now().UTC()}
+				if _, err := m.DB.Collection(MigrationCollection).InsertOne(ctx, doc); err != nil {
+					return translateError(err)
+				}
+			}
+			done = append(done, mg)
+		}
+		return nil
+	})
+	return done, err
+}
+
+// Down reverts the applied migrations above version to, latest first, and returns them. Down to 0 reverts them all.
+func (m *Migrator) Down(ctx context.Context, to int) ([]Migration, error) {
+	var done []Migration
+	err := m.run(ctx, func(applied map[int]string) error {
+		var versions []int
+		for v := range applied {
+			if v > to {
+				versions = append(versions, v)
+			}
+		}
+		sort.Sort(sort.Reverse(sort.IntSlice(versions)))
+		for _, v := range versions {
+			mg, ok := m.migration(v)
+			if !ok {
+				return fmt.Errorf("mongostore: applied migration %d is unknown", v)
+			}
+			if mg.Down == nil {
+				return fmt.Errorf("mongostore: migration %s has no down", mg)
+			}
+			if !m.DryRun {
+				if err := mg.Down(ctx, m.DB); err != nil {
+					return fmt.Errorf("mongostore: migration %s: %w", mg, err)
+				}
+				if _, err := m.DB.Collection(MigrationCollection).DeleteOne(ctx, bson.M{idField: v}); err != nil {
+					return translateError(err)
+				}
+			}
+			done = append(done, mg)
+		}
+		return nil
+	})
+	return done, err
+}
+
+func (m *Migrator) migration(version int) (Migration, bool) {
+	for _, mg := range m.Migrations {
+		if mg.Version == version {
+			return mg, true
+		}
+	}
+	return Migration{}, false
+}
+
+// run calls fn holding the migration lock with the names of the applied migrations by version, after checking them
+// against Migrations.
+func (m *Migrator) run(ctx context.Context, fn func(applied map[int]string) error) (err error) {
+	owner, err := m.lock(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		// a lock taken over as stale belongs to another migrator now, only our own is released
+		lock := bson.M{idField: migrationLock, "owner": owner}
+		_, unlockErr := m.DB.Collection(migrationLockCollection).DeleteOne(context.Background(), lock)
+		if err == nil {
+			err = translateError(unlockErr)
+		}
+	}()
+
+	cur, err := m.DB.Collection(MigrationCollection).Find(ctx, bson.M{})
+	if err != nil {
+		return translateError(err)
+	}
+	var docs []struct {
+		Version int    `bson:"_id"`
+		Name    string `bson:"name"`
+	}
+	if err := cur.All(ctx, &docs); err != nil {
+		return translateError(err)
+	}
+	applied := map[int]string{}
+	for _, doc := range docs {
+		if mg, ok := m.migration(doc.Version); ok && mg.Name != doc.Name {
+			return fmt.Errorf("%w: %s was applied as %s", models.ErrChecksumMismatch, mg, doc.Name)
+		}
+		applied[doc.Version] = doc.Name
+	}
+	return fn(applied)
+}
+
+// lock waits until it inserts the lock document, taking over a lock older than lockTimeout, and returns the owner
+// token stored in it.
+func (m *Migrator) lock(ctx context.Context) (primitive.ObjectID, error) {
+	coll := m.DB.Collection(migrationLockCollection)
+	owner := primitive.NewObjectID()
+	for {
+		now := time.Now().UTC()
+		_, err := coll.InsertOne(ctx, bson.M{idField: migrationLock, "owner": owner, "locked_at": now})
+		if !isDuplicateKeyError(err) {
+			return owner, translateError(err)
+		}
+		stale := bson.M{idField: migrationLock, "locked_at": bson.M{"$lt": now.Add(-lockTimeout)}}
+		if _, err := coll.DeleteOne(ctx, stale); err != nil {
+			return owner, translateError(err)
+		}
+		select {
+		case <-ctx.Done():
+			return owner, ctx.Err()
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+}
@@ -0,0 +1,152 @@
+package mongostore
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"strings"
+)
+
+// Index is an index of a collection, named like mongo names it by default.
+type Index struct {
+	Keys   bson.D
+	Unique bool
+}
+
+// Name returns the name mongo gives the index, its keys and directions joined by underscores.
+func (i Index) Name() string {
+	parts := make([]string, len(i.Keys))
+	for n, k := range i.Keys {
+		parts[n] = fmt.Sprintf("%s_%v", k.Key, k.Value)
+	}
+	return strings.Join(parts, "_")
+}
+
+// CollectionSchema describes a collection along with the indexes and validator it should have.
+type CollectionSchema struct {
+	Name      string
+	Indexes   []Index
+	Validator bson.D
+}
+
+// Schema of the Posts and Comments collections, the validators follow the models.
+var Schema = []CollectionSchema{
+	{Name: PostCollection, Validator: Posts.Validator()},
+	{
+		Name:      CommentCollection,
+		Indexes:   []Index{{Keys: bson.D{{Key: "post_id", Value: 1}}}},
+		Validator: Comments.Validator(),
+	},
+}
+
+// EnsureSchema brings the collections of db up to Schema, see EnsureCollections.
+func EnsureSchema(ctx context.Context, db *mongo.Database) ([]string, error) {
+	return EnsureCollections(ctx, db, Schema...)
+}
+
+// EnsureCollections creates the collections of schema missing in db and their missing indexes, and replaces their
+// validator when it differs, which is how a validator follows a model that changed. It returns a line per change,
+// none when db was already up to date, so it is safe to run on every start. Indexes are only matched by name, an
+// existing index is never changed or dropped.
+func EnsureCollections(ctx context.Context, db *mongo.Database, schema ...CollectionSchema) ([]string, error) {
+	cur, err := db.ListCollections(ctx, bson.M{})
+	if err != nil {
+		return nil, translateError(err)
+	}
+	var infos []struct {
+		Name    string `bson:"name"`
+		Options struct {
+			Validator bson.Raw `bson:"validator"`
+		} `bson:"options"`
+	}
+	if err := cur.All(ctx, &infos); err != nil {
+		return nil, translateError(err)
+	}
+	validators := map[string]bson.Raw{}
+	for _, info := range infos {
+		validators[info.Name] = info.Options.Validator
+	}
+
+	var changes []string
+	for _, cs := range schema {
+		validator := cs.Validator
+		if validator == nil {
+			validator = bson.D{}
+		}
+		current, exists := validators[cs.Name]
+		if !exists {
+			if err := db.CreateCollection(ctx, cs.Name, options.CreateCollection().SetValidator(validator)); err != nil {
+				return changes, translateError(err)
+			}
+			changes = append(changes, "created collection "+cs.Name)
+		} else if same, err := sameDocument(current, validator); err != nil {
+			return changes, err
+		} else if !same {
+			cmd := bson.D{{Key: "collMod", Value: cs.Name}, {Key: "validator", Value: validator}}
+			if err := db.RunCommand(ctx, cmd).Err(); err != nil {
+				return changes, translateError(err)
+			}
+			changes = append(changes, "updated validator of "+cs.Name)
+		}
+
+		created, err := ensureIndexes(ctx, db.Collection(cs.Name), cs.Indexes)
+		for _, name := range created {
+			changes = append(changes, "created index "+cs.Name+"."+name)
+		}
+		if err != nil {
+			return changes, err
+		}
+	}
+	return changes, nil
+}
+
+// ensureIndexes creates the indexes of coll missing by name and returns their names.
+func ensureIndexes(ctx context.Context, coll *mongo.Collection, indexes []Index) ([]string, error) {
+	cur, err := coll.Indexes().List(ctx)
+	if err != nil {
+		return nil, translateError(err)
+	}
+	var existing []struct {
+		Name string `bson:"name"`
+	}
+	if err := cur.All(ctx, &existing); err != nil {
+		return nil, translateError(err)
+	}
+	names := map[string]bool{}
+	for _, idx := range existing {
+		names[idx.Name] = true
+	}
+
+	var created []string
+	for _, idx := range indexes {
+		if names[idx.Name()] {
+			continue
+		}
+		model := mongo.IndexModel{Keys: idx.Keys, Options: options.Index().SetName(idx.Name()).SetUnique(idx.Unique)}
+		if _, err := coll.Indexes().CreateOne(ctx, model); err != nil {
+			return created, translateError(err)
+		}
+		created = append(created, idx.Name())
+	}
+	return created, nil
+}
+
+// sameDocument compares the stored document a with b in relaxed extended json, so numbers of any width holding the
+// same value are equal. A missing document equals an empty one.
+func sameDocument(a bson.Raw, b interface{}) (bool, error) {
+	if a == nil {
+		a = bson.Raw{5, 0, 0, 0, 0}
+	}
+	x, err := bson.MarshalExtJSON(a, false, false)
+	if err != nil {
+		return false, err
+	}
+	y, err := bson.MarshalExtJSON(b, false, false)
+	if err != nil {
+		return false, err
+	}
+	return bytes.Equal(x, y), nil
+}
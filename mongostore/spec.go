@@ -0,0 +1,171 @@
+package mongostore
+
+import (
+	"context"
+	"fmt"
+	"github.com/hendratommy/repository-pattern/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Find returns every document matching spec.
+func (c *Collection[T, ID]) Find(ctx context.Context, db *mongo.Database, spec models.Spec) ([]*T, error) {
+	return c.find(ctx, db, spec, false)
+}
+
+// FindIncludingDeleted returns every document matching spec, soft deleted or not.
+func (c *Collection[T, ID]) FindIncludingDeleted(ctx context.Context, db *mongo.Database, spec models.Spec) ([]*T, error) {
+	return c.find(ctx, db, spec, true)
+}
+
+func (c *Collection[T, ID]) find(ctx context.Context, db *mongo.Database, spec models.Spec, withDeleted bool) ([]*T, error) {
+	filter, err := c.specFilter(spec, withDeleted)
+	if err != nil {
+		return nil, err
+	}
+	sort, err := c.sort(spec.Orders)
+	if err != nil {
+		return nil, err
+	}
+	cur, err := c.coll(db).Find(ctx, filter, options.Find().SetSort(sort))
+	if err != nil {
+		return nil, translateError(err)
+	}
+	var ms []*T
+	err = cur.All(ctx, &ms)
+	return ms, translateError(err)
+}
+
+// Count returns how many documents match spec, its order is ignored.
+func (c *Collection[T, ID]) Count(ctx context.Context, db *mongo.Database, spec models.Spec) (int64, error) {
+	filter, err := c.specFilter(spec, false)
+	if err != nil {
+		return 0, err
+	}
+	n, err := c.coll(db).CountDocuments(ctx, filter)
+	return n, translateError(err)
+}
+
+// DeleteBy removes the documents matching spec, or sets their deleted_at on a SoftDelete collection, and returns how
+// many there were.
+func (c *Collection[T, ID]) DeleteBy(ctx context.Context, db *mongo.Database, spec models.Spec) (int64, error) {
+	filter, err := c.specFilter(spec, false)
+	if err != nil {
+		return 0, err
+	}
+	if c.softDelete {
+		res, err := c.coll(db).UpdateMany(ctx, filter, bson.M{"$set": bson.M{deletedAtField: c.clock()}})
+		if err != nil {
+			return 0, translateError(err)
+		}
+		return res.ModifiedCount, nil
+	}
+	res, err := c.coll(db).DeleteMany(ctx, filter)
+	if err != nil {
+		return 0, translateError(err)
+	}
+	return res.DeletedCount, nil
+}
+
+// specFilter renders the filter selecting the documents of spec, leaving out the soft deleted ones unless
+// withDeleted.
+func (c *Collection[T, ID]) specFilter(spec models.Spec, withDeleted bool) (interface{}, error) {
+	filter := bson.M{}
+	if spec.Where != nil {
+		var err error
+		if filter, err = c.filter(*spec.Where); err != nil {
+			return nil, err
+		}
+	}
+	if withDeleted {
+		return filter, nil
+	}
+	return c.alive(filter), nil
+}
+
+func (c *Collection[T, ID]) key(field string) (string, error) {
+	key, ok := c.byField[field]
+	if !ok {
+		return "", fmt.Errorf("%w: %s has no field %q", models.ErrInvalidSpec, c.Name, field)
+	}
+	return key, nil
+}
+
+// filter renders cr as a query filter, values are only ever compared so they cannot inject operators.
+func (c *Collection[T, ID]) filter(cr models.Criterion) (bson.M, error) {
+	switch cr.Op {
+	case models.OpAnd, models.OpOr:
+		if len(cr.Children) == 0 {
+			if cr.Op == models.OpAnd {
+				return bson.M{}, nil
+			}
+			// $or refuses an empty array
+			return bson.M{idField: bson.M{"$in": bson.A{}}}, nil
+		}
+		children := make(bson.A, len(cr.Children))
+		for i, child := range cr.Children {
+			f, err := c.filter(child)
+			if err != nil {
+				return nil, err
+			}
+			children[i] = f
+		}
+		if cr.Op == models.OpAnd {
+			return bson.M{"$and": children}, nil
+		}
+		return bson.M{"$or": children}, nil
+	}
+
+	key, err := c.key(cr.Field)
+	if err != nil {
+		return nil, err
+	}
+	switch cr.Op {
+	case models.OpEq:
+		return bson.M{key: bson.M{"$eq": cr.Values[0]}}, nil
+	case models.OpIn:
+		return bson.M{key: bson.M{"$in": bson.A(cr.Values)}}, nil
+	case models.OpLike:
+		pattern, ok := cr.Values[0].(string)
+		if !ok {
+			return nil, fmt.Errorf("%w: like pattern must be a string", models.ErrInvalidSpec)
+		}
+		return bson.M{key: primitive.Regex{Pattern: models.LikeRegexp(pattern)}}, nil
+	case models.OpRange:
+		cond := bson.M{}
+		if from := cr.Values[0]; from != nil {
+			cond["$gte"] = from
+		}
+		if to := cr.Values[1]; to != nil {
+			cond["$lt"] = to
+		}
+		if len(cond) == 0 {
+			return bson.M{}, nil
+		}
+		return bson.M{key: cond}, nil
+	}
+	return nil, fmt.Errorf("%w: unknown operator %d", models.ErrInvalidSpec, cr.Op)
+}
+
+func (c *Collection[T, ID]) sort(orders []models.Order) (bson.D, error) {
+	var sort bson.D
+	byID := false
+	for _, o := range orders {
+		key, err := c.key(o.Field)
+		if err != nil {
+			return nil, err
+		}
+		dir := 1
+		if o.Desc {
+			dir = -1
+		}
+		sort = append(sort, bson.E{Key: key, Value: dir})
+		byID = byID || key == idField
+	}
+	if byID {
+		return sort, nil
+	}
+	return append(sort, bson.E{Key: idField, Value: 1}), nil
+}
@@ -0,0 +1,71 @@
+package mongostore
+
+import (
+	"context"
+	"errors"
+	"github.com/hendratommy/repository-pattern/querylog"
+	"github.com/hendratommy/repository-pattern/tracing"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/event"
+	"sync"
+)
+
+// TracingMonitor returns a command monitor recording a span per command, a child of the span carried by the ctx of
+// the operation. The spans hold the command, its collection and how many documents it returned or changed. The values
+// of the documents of the command go through redact, querylog.RedactAll when nil, as they do in the query logs.
+// Commands run with a ctx carrying no span are not traced. Set it with options.Client().SetMonitor.
+func TracingMonitor(redact querylog.Redactor) *event.CommandMonitor {
+	redactor := &querylog.Logger{Redact: redact}
+	var spans sync.Map // request id to *tracing.Span
+	end := func(requestID int64) *tracing.Span {
+		span, ok := spans.LoadAndDelete(requestID)
+		if !ok {
+			return nil
+		}
+		return span.(*tracing.Span)
+	}
+	return &event.CommandMonitor{
+		Started: func(ctx context.Context, evt *event.CommandStartedEvent) {
+			_, span := tracing.Start(ctx, "mongo "+evt.CommandName)
+			if span == nil {
+				return
+			}
+			span.SetAttribute("db.system", "mongodb")
+			span.SetAttribute("db.name", evt.DatabaseName)
+			span.SetAttribute("db.operation", evt.CommandName)
+			if coll, ok := evt.Command.Lookup(evt.CommandName).StringValueOK(); ok {
+				span.SetAttribute("db.collection", coll)
+			}
+			span.SetAttribute("db.statement", redactCommand(redactor, evt.Command))
+			spans.Store(evt.RequestID, span)
+		},
+		Succeeded: func(_ context.Context, evt *event.CommandSucceededEvent) {
+			span := end(evt.RequestID)
+			if n, ok := replyRows(evt.Reply); ok {
+				span.SetAttribute("db.rows", n)
+			}
+			span.End()
+		},
+		Failed: func(_ context.Context, evt *event.CommandFailedEvent) {
+			span := end(evt.RequestID)
+			span.RecordError(errors.New(evt.Failure))
+			span.End()
+		},
+	}
+}
+
+// replyRows counts the documents of a command reply, n for writes and counts, the first batch for cursors.
+func replyRows(reply bson.Raw) (int64, bool) {
+	n := reply.Lookup("n")
+	if i, ok := n.Int32OK(); ok {
+		return int64(i), true
+	}
+	if i, ok := n.Int64OK(); ok {
+		return i, true
+	}
+	if batch, ok := reply.Lookup("cursor", "firstBatch").ArrayOK(); ok {
+		values, err := batch.Values()
+		return int64(len(values)), err == nil
+	}
+	return 0, false
+}
@@ -0,0 +1,83 @@
+package mongostore
+
+import (
+	"go.mongodb.org/mongo-driver/bson"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// Validator returns the $jsonSchema validator of the documents of c derived from the fields of T, so mongo rejects
+// what the sql schema rejects. Every field is required but pointers, which may also be null, and fields tagged
+// omitempty. A string field tagged `maxlen:"n"` holds at most n characters. Fields of types without a bson
+// counterpart, like nested structs, are only required.
+func (c *Collection[T, ID]) Validator() bson.D {
+	rt := reflect.TypeOf((*T)(nil)).Elem()
+	required := []string{}
+	properties := bson.D{}
+	for i := 0; i < rt.NumField(); i++ {
+		f := rt.Field(i)
+		tag := strings.Split(f.Tag.Get("bson"), ",")
+		key := tag[0]
+		if key == "" || key == "-" || !f.IsExported() {
+			continue
+		}
+
+		t, nullable := f.Type, false
+		if t.Kind() == reflect.Ptr {
+			t, nullable = t.Elem(), true
+		}
+		if !nullable && !hasOption(tag[1:], "omitempty") {
+			required = append(required, key)
+		}
+		types := bsonTypes(t)
+		if types == nil {
+			continue
+		}
+		if nullable {
+			types = append(types, "null")
+		}
+		property := bson.D{{Key: "bsonType", Value: types[0]}}
+		if len(types) > 1 {
+			property[0].Value = types
+		}
+		if n, err := strconv.Atoi(f.Tag.Get("maxlen")); err == nil && t.Kind() == reflect.String {
+			property = append(property, bson.E{Key: "maxLength", Value: n})
+		}
+		properties = append(properties, bson.E{Key: key, Value: property})
+	}
+	return bson.D{{Key: "$jsonSchema", Value: bson.D{
+		{Key: "bsonType", Value: "object"},
+		{Key: "required", Value: required},
+		{Key: "properties", Value: properties},
+	}}}
+}
+
+// bsonTypes returns the bson types the driver encodes t into, nil when there is no simple one.
+func bsonTypes(t reflect.Type) bson.A {
+	if t == timeType {
+		return bson.A{"date"}
+	}
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint, reflect.Uint64:
+		// the driver writes an int32 or an int64 depending on the go type and the value
+		return bson.A{"int", "long"}
+	case reflect.Float32, reflect.Float64:
+		return bson.A{"double"}
+	case reflect.String:
+		return bson.A{"string"}
+	case reflect.Bool:
+		return bson.A{"bool"}
+	}
+	return nil
+}
+
+func hasOption(options []string, option string) bool {
+	for _, o := range options {
+		if o == option {
+			return true
+		}
+	}
+	return false
+}
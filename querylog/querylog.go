@@ -0,0 +1,126 @@
+// Package querylog logs the queries run against the databases with log/slog, their statement, redacted arguments,
+// duration, rows and transaction, at warn level when they are slow or fail.
+package querylog
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"strconv"
+	"time"
+)
+
+// Redactor returns what to log of the argument value, name is its position for sql statements, starting at 1, and
+// its dotted path in the command for mongo, like filter._id.
+type Redactor func(name string, value interface{}) interface{}
+
+// Redacted replaces the arguments hidden by a Redactor.
+const Redacted = "[redacted]"
+
+// RedactAll hides every argument, it is the default.
+func RedactAll(string, interface{}) interface{} {
+	return Redacted
+}
+
+// RedactStrings hides text, where personal data lives, and keeps numbers, booleans and times like ids and versions.
+func RedactStrings(_ string, value interface{}) interface{} {
+	switch value.(type) {
+	case string, []byte, *string:
+		return Redacted
+	}
+	return value
+}
+
+// KeepAll logs the arguments as they are, for development only.
+func KeepAll(_ string, value interface{}) interface{} {
+	return value
+}
+
+// Logger logs queries to Logger, slog.Default when nil. Queries run at debug level, those lasting SlowThreshold or
+// more, when set, and those failing at warn level.
+type Logger struct {
+	Logger        *slog.Logger
+	SlowThreshold time.Duration
+	Redact        Redactor // RedactAll when nil
+}
+
+// Query is a statement that ran, Rows is -1 when unknown.
+type Query struct {
+	System    string
+	Statement string
+	Args      []interface{}
+	Duration  time.Duration
+	Rows      int64
+	TxID      string
+	Err       error
+}
+
+// Log logs q, with the transaction id of ctx when q has none.
+func (l *Logger) Log(ctx context.Context, q Query) {
+	logger := l.Logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+	level, msg := slog.LevelDebug, "query"
+	switch {
+	case q.Err != nil:
+		level, msg = slog.LevelWarn, "query failed"
+	case l.SlowThreshold > 0 && q.Duration >= l.SlowThreshold:
+		level, msg = slog.LevelWarn, "slow query"
+	}
+	if !logger.Enabled(ctx, level) {
+		return
+	}
+
+	attrs := []slog.Attr{slog.String("db.system", q.System), slog.String("statement", q.Statement)}
+	if len(q.Args) > 0 {
+		args := make([]interface{}, len(q.Args))
+		for i, arg := range q.Args {
+			args[i] = l.RedactValue(strconv.Itoa(i+1), arg)
+		}
+		attrs = append(attrs, slog.Any("args", args))
+	}
+	attrs = append(attrs, slog.Duration("duration", q.Duration))
+	if q.Rows >= 0 {
+		attrs = append(attrs, slog.Int64("rows", q.Rows))
+	}
+	if q.TxID == "" {
+		q.TxID = TxID(ctx)
+	}
+	if q.TxID != "" {
+		attrs = append(attrs, slog.String("tx", q.TxID))
+	}
+	if q.Err != nil {
+		attrs = append(attrs, slog.String("error", q.Err.Error()))
+	}
+	logger.LogAttrs(ctx, level, msg, attrs...)
+}
+
+// RedactValue returns what to log of the argument value named name, see Redactor.
+func (l *Logger) RedactValue(name string, value interface{}) interface{} {
+	if l.Redact == nil {
+		return RedactAll(name, value)
+	}
+	return l.Redact(name, value)
+}
+
+type ctxTxIDKey struct{}
+
+// WithTxID returns ctx identifying the transaction its queries run in as id.
+func WithTxID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, ctxTxIDKey{}, id)
+}
+
+// TxID returns the id of the transaction carried by ctx, empty when there is none.
+func TxID(ctx context.Context) string {
+	id, _ := ctx.Value(ctxTxIDKey{}).(string)
+	return id
+}
+
+// NewTxID returns a random transaction id.
+func NewTxID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,125 @@
+package repositories
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+)
+
+// cache is a least recently used cache whose entries expire ttl after they were loaded. Concurrent misses of a key
+// share a single load.
+type cache[K comparable, V any] struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	size    int
+	now     func() time.Time
+	entries map[K]*list.Element
+	lru     *list.List // of *entry[K, V], most recently used first
+	loads   map[K]*load[V]
+	// gen changes on every invalidation, a load started before one is not cached as it may have read the old value
+	gen uint64
+}
+
+type entry[K comparable, V any] struct {
+	key     K
+	value   V
+	expires time.Time
+}
+
+type load[V any] struct {
+	done  chan struct{}
+	value V
+	err   error
+}
+
+func newCache[K comparable, V any](ttl time.Duration, size int, now func() time.Time) *cache[K, V] {
+	return &cache[K, V]{
+		ttl: ttl, size: size, now: now,
+		entries: map[K]*list.Element{}, lru: list.New(), loads: map[K]*load[V]{},
+	}
+}
+
+// get returns the value of key, calling fn to load it when it is missing or expired. A failed load is not cached.
+// The load is shared by every caller missing key meanwhile, so it runs with the values of ctx but not its
+// cancellation, each caller stops waiting for it when its own ctx is done.
+func (c *cache[K, V]) get(ctx context.Context, key K, fn func(context.Context) (V, error)) (V, error) {
+	c.mu.Lock()
+	if el, ok := c.entries[key]; ok {
+		e := el.Value.(*entry[K, V])
+		if c.now().Before(e.expires) {
+			c.lru.MoveToFront(el)
+			c.mu.Unlock()
+			return e.value, nil
+		}
+		c.remove(el)
+	}
+	l, ok := c.loads[key]
+	if !ok {
+		l = &load[V]{done: make(chan struct{})}
+		c.loads[key] = l
+		go c.load(context.WithoutCancel(ctx), key, l, c.gen, fn)
+	}
+	c.mu.Unlock()
+
+	select {
+	case <-l.done:
+		return l.value, l.err
+	case <-ctx.Done():
+		var zero V
+		return zero, ctx.Err()
+	}
+}
+
+// load runs fn for l and caches its value unless key was invalidated since gen.
+func (c *cache[K, V]) load(ctx context.Context, key K, l *load[V], gen uint64, fn func(context.Context) (V, error)) {
+	defer close(l.done)
+	l.value, l.err = fn(ctx)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.loads[key] == l {
+		delete(c.loads, key)
+	}
+	if l.err == nil && gen == c.gen {
+		c.put(key, l.value)
+	}
+}
+
+func (c *cache[K, V]) put(key K, value V) {
+	if c.size <= 0 {
+		return
+	}
+	if el, ok := c.entries[key]; ok {
+		c.remove(el)
+	}
+	c.entries[key] = c.lru.PushFront(&entry[K, V]{key: key, value: value, expires: c.now().Add(c.ttl)})
+	for c.lru.Len() > c.size {
+		c.remove(c.lru.Back())
+	}
+}
+
+func (c *cache[K, V]) remove(el *list.Element) {
+	c.lru.Remove(el)
+	delete(c.entries, el.Value.(*entry[K, V]).key)
+}
+
+// invalidate drops key, a load of key in progress is no longer shared with later misses.
+func (c *cache[K, V]) invalidate(key K) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.entries[key]; ok {
+		c.remove(el)
+	}
+	delete(c.loads, key)
+	c.gen++
+}
+
+// clear drops every key.
+func (c *cache[K, V]) clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries = map[K]*list.Element{}
+	c.lru.Init()
+	c.loads = map[K]*load[V]{}
+	c.gen++
+}
@@ -0,0 +1,248 @@
+package repositories
+
+import (
+	"context"
+	"github.com/hendratommy/repository-pattern/models"
+	"go.mongodb.org/mongo-driver/mongo"
+	"sync"
+	"time"
+)
+
+type ctxInvalidationsKey struct{}
+
+// invalidations collects the cache invalidations of the writes of a transaction, they only run once it is over so
+// no reader caches a value in between.
+type invalidations struct {
+	mu  sync.Mutex
+	fns []func()
+}
+
+// invalidate runs fn now, or once the transaction of a caching repository carried by ctx is over.
+func invalidate(ctx context.Context, fn func()) {
+	if inv, ok := ctx.Value(ctxInvalidationsKey{}).(*invalidations); ok {
+		inv.mu.Lock()
+		inv.fns = append(inv.fns, fn)
+		inv.mu.Unlock()
+		return
+	}
+	fn()
+}
+
+// inTransaction tells whether ctx carries a transaction of a repository of this package, whose reads may see writes
+// not committed yet and must not be cached.
+func inTransaction(ctx context.Context) bool {
+	return ctx.Value(ctxInvalidationsKey{}) != nil || ctx.Value(ctxTransactionKey{}) != nil ||
+		ctx.Value(ctxMemoryTransactionKey{}) != nil || mongo.SessionFromContext(ctx) != nil
+}
+
+// cachingTransaction runs fn with begin then the invalidations of its writes, whether it committed or not
+// as invalidating too much is harmless.
+func cachingTransaction(ctx context.Context, begin func(context.Context, func(context.Context) error) error, fn func(context.Context) error) error {
+	inv := &invalidations{}
+	defer func() {
+		for _, fn := range inv.fns {
+			fn()
+		}
+	}()
+	return begin(context.WithValue(ctx, ctxInvalidationsKey{}, inv), fn)
+}
+
+// CachingRepository decorates a models.Repository with a cache of FindByID, every other finder goes to the repository.
+// Writes invalidate the entities they touch, after commit when they run in a transaction started by InTransaction of
+// a caching repository, reads in a transaction skip the cache to see its writes. The writes of a transaction started
+// by the wrapped repository invalidate right away, a concurrent read may cache the old value again until it expires.
+// Entities are copied in and out of the cache, but not what their pointer fields, like DeletedAt, point to.
+type CachingRepository[T any, ID comparable] struct {
+	models.Repository[T, ID]
+	id   func(*T) ID
+	byID *cache[ID, T]
+	// related drops the other caches a write of an entity may change
+	related func()
+}
+
+// NewCachingRepository wraps repo, id returns the identifier of an entity.
+func NewCachingRepository[T any, ID comparable](repo models.Repository[T, ID], id func(*T) ID, opts ...Option) *CachingRepository[T, ID] {
+	o := newOptions(opts)
+	now := o.now
+	if now == nil {
+		now = time.Now
+	}
+	return &CachingRepository[T, ID]{Repository: repo, id: id, byID: newCache[ID, T](o.cacheTTL, o.cacheSize, now)}
+}
+
+func (r *CachingRepository[T, ID]) FindByID(ctx context.Context, id ID) (*T, error) {
+	if inTransaction(ctx) {
+		return r.Repository.FindByID(ctx, id)
+	}
+	m, err := r.byID.get(ctx, id, func(ctx context.Context) (T, error) {
+		m, err := r.Repository.FindByID(ctx, id)
+		if err != nil {
+			var zero T
+			return zero, err
+		}
+		return *m, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+func (r *CachingRepository[T, ID]) invalidate(ctx context.Context, ids ...ID) {
+	invalidate(ctx, func() {
+		for _, id := range ids {
+			r.byID.invalidate(id)
+		}
+		if r.related != nil {
+			r.related()
+		}
+	})
+}
+
+func (r *CachingRepository[T, ID]) Save(ctx context.Context, m *T) error {
+	err := r.Repository.Save(ctx, m)
+	r.invalidate(ctx, r.id(m))
+	return err
+}
+
+func (r *CachingRepository[T, ID]) SaveAll(ctx context.Context, ms []*T) error {
+	err := r.Repository.SaveAll(ctx, ms)
+	ids := make([]ID, len(ms))
+	for i, m := range ms {
+		ids[i] = r.id(m)
+	}
+	r.invalidate(ctx, ids...)
+	return err
+}
+
+func (r *CachingRepository[T, ID]) Insert(ctx context.Context, m *T) error {
+	err := r.Repository.Insert(ctx, m)
+	r.invalidate(ctx, r.id(m))
+	return err
+}
+
+func (r *CachingRepository[T, ID]) Update(ctx context.Context, m *T) error {
+	err := r.Repository.Update(ctx, m)
+	r.invalidate(ctx, r.id(m))
+	return err
+}
+
+func (r *CachingRepository[T, ID]) Delete(ctx context.Context, id ID) error {
+	err := r.Repository.Delete(ctx, id)
+	r.invalidate(ctx, id)
+	return err
+}
+
+func (r *CachingRepository[T, ID]) Restore(ctx context.Context, id ID) error {
+	err := r.Repository.Restore(ctx, id)
+	r.invalidate(ctx, id)
+	return err
+}
+
+// Purge drops the whole cache, the purged ids are not known.
+func (r *CachingRepository[T, ID]) Purge(ctx context.Context, olderThan time.Duration) (int64, error) {
+	n, err := r.Repository.Purge(ctx, olderThan)
+	invalidate(ctx, func() {
+		r.byID.clear()
+		if r.related != nil {
+			r.related()
+		}
+	})
+	return n, err
+}
+
+func (r *CachingRepository[T, ID]) InTransaction(ctx context.Context, fn func(context.Context) error) error {
+	return cachingTransaction(ctx, r.Repository.InTransaction, fn)
+}
+
+func (r *CachingRepository[T, ID]) InTransactionWithOptions(ctx context.Context, opts models.TxOptions, fn func(context.Context) error) error {
+	return cachingTransaction(ctx, func(ctx context.Context, fn func(context.Context) error) error {
+		return r.Repository.InTransactionWithOptions(ctx, opts, fn)
+	}, fn)
+}
+
+// CachingPostRepository caches FindByID of a models.PostRepository, see CachingRepository. DeleteCascade only drops
+// the caches of the comment repositories linked by CascadeTo, the comments it deletes stay in the others until they
+// expire.
+type CachingPostRepository struct {
+	*CachingRepository[models.Post, int]
+	posts    models.PostRepository
+	cascades []*CachingCommentRepository
+}
+
+func NewCachingPostRepository(repo models.PostRepository, opts ...Option) *CachingPostRepository {
+	return &CachingPostRepository{
+		CachingRepository: NewCachingRepository[models.Post, int](repo, func(p *models.Post) int { return p.ID }, opts...),
+		posts:             repo,
+	}
+}
+
+// CascadeTo makes DeleteCascade drop the caches of comments, which must cache the comments of the same database.
+func (r *CachingPostRepository) CascadeTo(comments *CachingCommentRepository) *CachingPostRepository {
+	r.cascades = append(r.cascades, comments)
+	return r
+}
+
+// DeleteCascade drops the whole cache of the linked comment repositories, the deleted comment ids are not known.
+func (r *CachingPostRepository) DeleteCascade(ctx context.Context, id int) (int64, error) {
+	n, err := r.posts.DeleteCascade(ctx, id)
+	r.invalidate(ctx, id)
+	for _, comments := range r.cascades {
+		invalidate(ctx, comments.clear)
+	}
+	return n, err
+}
+
+// CachingCommentRepository caches FindByID and FindByPostID of a models.CommentRepository, see CachingRepository.
+// The post of a comment may change on update, so every write drops the whole FindByPostID cache.
+type CachingCommentRepository struct {
+	*CachingRepository[models.Comment, int]
+	comments models.CommentRepository
+	byPostID *cache[int, []models.Comment]
+}
+
+func NewCachingCommentRepository(repo models.CommentRepository, opts ...Option) *CachingCommentRepository {
+	r := &CachingCommentRepository{
+		CachingRepository: NewCachingRepository[models.Comment, int](repo, func(c *models.Comment) int { return c.ID }, opts...),
+		comments:          repo,
+	}
+	byID := r.CachingRepository.byID
+	r.byPostID = newCache[int, []models.Comment](byID.ttl, byID.size, byID.now)
+	r.related = r.byPostID.clear
+	return r
+}
+
+func (r *CachingCommentRepository) clear() {
+	r.byID.clear()
+	r.byPostID.clear()
+}
+
+func (r *CachingCommentRepository) FindByPostID(ctx context.Context, postID int) ([]*models.Comment, error) {
+	if inTransaction(ctx) {
+		return r.comments.FindByPostID(ctx, postID)
+	}
+	cs, err := r.byPostID.get(ctx, postID, func(ctx context.Context) ([]models.Comment, error) {
+		comments, err := r.comments.FindByPostID(ctx, postID)
+		if err != nil {
+			return nil, err
+		}
+		cs := make([]models.Comment, len(comments))
+		for i, c := range comments {
+			cs[i] = *c
+		}
+		return cs, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	comments := make([]*models.Comment, len(cs))
+	for i := range cs {
+		c := cs[i]
+		comments[i] = &c
+	}
+	return comments, nil
+}
+
+func (r *CachingCommentRepository) FindPageByPostID(ctx context.Context, postID int, req models.PageRequest) (*models.Page[models.Comment], error) {
+	return r.comments.FindPageByPostID(ctx, postID, req)
+}
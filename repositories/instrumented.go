@@ -0,0 +1,266 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"github.com/hendratommy/repository-pattern/metrics"
+	"github.com/hendratommy/repository-pattern/models"
+	"time"
+)
+
+// Metrics recorded by instrumented repositories, labelled by repository, operation and error class or transaction
+// outcome.
+const (
+	OperationDurationMetric   = "repository_operation_duration_seconds"
+	OperationErrorsMetric     = "repository_operation_errors_total"
+	TransactionsMetric        = "repository_transactions_total"
+	TransactionDurationMetric = "repository_transaction_duration_seconds"
+)
+
+// Transaction outcomes, TxError means fn failed and the transaction was rolled back, any other error means it could
+// not begin or commit.
+const (
+	OutcomeCommit   = "commit"
+	OutcomeRollback = "rollback"
+	OutcomeError    = "error"
+)
+
+var metricsHelp = map[string]string{
+	OperationDurationMetric:   "Duration of repository operations.",
+	OperationErrorsMetric:     "Repository operations that failed, by error class.",
+	TransactionsMetric:        "Repository transactions, by outcome.",
+	TransactionDurationMetric: "Duration of repository transactions, by outcome.",
+}
+
+// errorClass names the kind of err, one of the models errors or the cancellation of the context.
+func errorClass(err error) string {
+	switch {
+	case errors.Is(err, models.ErrNotFound):
+		return "not_found"
+	case errors.Is(err, models.ErrStaleVersion):
+		return "stale_version"
+	case errors.Is(err, models.ErrConflict):
+		return "conflict"
+	case errors.Is(err, models.ErrInvalidReference):
+		return "invalid_reference"
+	case errors.Is(err, models.ErrInvalidEntity):
+		return "invalid_entity"
+	case errors.Is(err, models.ErrInvalidCursor):
+		return "invalid_cursor"
+	case errors.Is(err, models.ErrInvalidSpec):
+		return "invalid_spec"
+	case errors.Is(err, context.Canceled):
+		return "canceled"
+	case errors.Is(err, context.DeadlineExceeded):
+		return "deadline_exceeded"
+	}
+	return "other"
+}
+
+// InstrumentedRepository decorates a models.Repository recording the duration of every operation, the errors by
+// class and the outcome and duration of transactions into m.
+type InstrumentedRepository[T any, ID comparable] struct {
+	repo    models.Repository[T, ID]
+	name    string
+	metrics metrics.Metrics
+}
+
+// NewInstrumentedRepository wraps repo, name is the repository label of its metrics. When m takes descriptions, like
+// metrics.Registry, the metrics are described to it.
+func NewInstrumentedRepository[T any, ID comparable](repo models.Repository[T, ID], name string, m metrics.Metrics) *InstrumentedRepository[T, ID] {
+	if h, ok := m.(interface{ Help(name, help string) }); ok {
+		for metric, help := range metricsHelp {
+			h.Help(metric, help)
+		}
+	}
+	return &InstrumentedRepository[T, ID]{repo: repo, name: name, metrics: m}
+}
+
+func (r *InstrumentedRepository[T, ID]) observe(operation string, start time.Time, err error) {
+	labels := metrics.Labels{"repository": r.name, "operation": operation}
+	r.metrics.Observe(OperationDurationMetric, labels, time.Since(start).Seconds())
+	if err != nil {
+		labels["class"] = errorClass(err)
+		r.metrics.Inc(OperationErrorsMetric, labels)
+	}
+}
+
+func (r *InstrumentedRepository[T, ID]) FindByID(ctx context.Context, id ID) (*T, error) {
+	start := time.Now()
+	m, err := r.repo.FindByID(ctx, id)
+	r.observe("FindByID", start, err)
+	return m, err
+}
+
+func (r *InstrumentedRepository[T, ID]) FindAll(ctx context.Context) ([]*T, error) {
+	start := time.Now()
+	ms, err := r.repo.FindAll(ctx)
+	r.observe("FindAll", start, err)
+	return ms, err
+}
+
+func (r *InstrumentedRepository[T, ID]) FindBy(ctx context.Context, spec models.Spec) ([]*T, error) {
+	start := time.Now()
+	ms, err := r.repo.FindBy(ctx, spec)
+	r.observe("FindBy", start, err)
+	return ms, err
+}
+
+func (r *InstrumentedRepository[T, ID]) Count(ctx context.Context, spec models.Spec) (int64, error) {
+	start := time.Now()
+	n, err := r.repo.Count(ctx, spec)
+	r.observe("Count", start, err)
+	return n, err
+}
+
+func (r *InstrumentedRepository[T, ID]) Exists(ctx context.Context, id ID) (bool, error) {
+	start := time.Now()
+	ok, err := r.repo.Exists(ctx, id)
+	r.observe("Exists", start, err)
+	return ok, err
+}
+
+func (r *InstrumentedRepository[T, ID]) FindPage(ctx context.Context, req models.PageRequest) (*models.Page[T], error) {
+	start := time.Now()
+	page, err := r.repo.FindPage(ctx, req)
+	r.observe("FindPage", start, err)
+	return page, err
+}
+
+func (r *InstrumentedRepository[T, ID]) Save(ctx context.Context, m *T) error {
+	start := time.Now()
+	err := r.repo.Save(ctx, m)
+	r.observe("Save", start, err)
+	return err
+}
+
+func (r *InstrumentedRepository[T, ID]) SaveAll(ctx context.Context, ms []*T) error {
+	start := time.Now()
+	err := r.repo.SaveAll(ctx, ms)
+	r.observe("SaveAll", start, err)
+	return err
+}
+
+func (r *InstrumentedRepository[T, ID]) Insert(ctx context.Context, m *T) error {
+	start := time.Now()
+	err := r.repo.Insert(ctx, m)
+	r.observe("Insert", start, err)
+	return err
+}
+
+func (r *InstrumentedRepository[T, ID]) Update(ctx context.Context, m *T) error {
+	start := time.Now()
+	err := r.repo.Update(ctx, m)
+	r.observe("Update", start, err)
+	return err
+}
+
+func (r *InstrumentedRepository[T, ID]) Delete(ctx context.Context, id ID) error {
+	start := time.Now()
+	err := r.repo.Delete(ctx, id)
+	r.observe("Delete", start, err)
+	return err
+}
+
+func (r *InstrumentedRepository[T, ID]) Restore(ctx context.Context, id ID) error {
+	start := time.Now()
+	err := r.repo.Restore(ctx, id)
+	r.observe("Restore", start, err)
+	return err
+}
+
+func (r *InstrumentedRepository[T, ID]) FindIncludingDeleted(ctx context.Context, spec models.Spec) ([]*T, error) {
+	start := time.Now()
+	ms, err := r.repo.FindIncludingDeleted(ctx, spec)
+	r.observe("FindIncludingDeleted", start, err)
+	return ms, err
+}
+
+func (r *InstrumentedRepository[T, ID]) Purge(ctx context.Context, olderThan time.Duration) (int64, error) {
+	start := time.Now()
+	n, err := r.repo.Purge(ctx, olderThan)
+	r.observe("Purge", start, err)
+	return n, err
+}
+
+// InTransaction records the outcome of the transaction, a panic in fn counting as a rollback.
+func (r *InstrumentedRepository[T, ID]) InTransaction(ctx context.Context, fn func(context.Context) error) error {
+	return r.transaction(func() error {
+		return r.repo.InTransaction(ctx, fn)
+	})
+}
+
+func (r *InstrumentedRepository[T, ID]) InTransactionWithOptions(ctx context.Context, opts models.TxOptions, fn func(context.Context) error) error {
+	return r.transaction(func() error {
+		return r.repo.InTransactionWithOptions(ctx, opts, fn)
+	})
+}
+
+func (r *InstrumentedRepository[T, ID]) transaction(run func() error) error {
+	start := time.Now()
+	outcome := OutcomeRollback
+	defer func() {
+		labels := metrics.Labels{"repository": r.name, "outcome": outcome}
+		r.metrics.Inc(TransactionsMetric, labels)
+		r.metrics.Observe(TransactionDurationMetric, labels, time.Since(start).Seconds())
+	}()
+
+	err := run()
+	var txErr *models.TxError
+	switch {
+	case err == nil:
+		outcome = OutcomeCommit
+	case errors.As(err, &txErr):
+		outcome = OutcomeRollback
+	default:
+		outcome = OutcomeError
+	}
+	return err
+}
+
+// InstrumentedPostRepository records the metrics of a models.PostRepository, see InstrumentedRepository.
+type InstrumentedPostRepository struct {
+	*InstrumentedRepository[models.Post, int]
+	posts models.PostRepository
+}
+
+func NewInstrumentedPostRepository(repo models.PostRepository, m metrics.Metrics) *InstrumentedPostRepository {
+	return &InstrumentedPostRepository{
+		InstrumentedRepository: NewInstrumentedRepository[models.Post, int](repo, "posts", m),
+		posts:                  repo,
+	}
+}
+
+func (r *InstrumentedPostRepository) DeleteCascade(ctx context.Context, id int) (int64, error) {
+	start := time.Now()
+	n, err := r.posts.DeleteCascade(ctx, id)
+	r.observe("DeleteCascade", start, err)
+	return n, err
+}
+
+// InstrumentedCommentRepository records the metrics of a models.CommentRepository, see InstrumentedRepository.
+type InstrumentedCommentRepository struct {
+	*InstrumentedRepository[models.Comment, int]
+	comments models.CommentRepository
+}
+
+func NewInstrumentedCommentRepository(repo models.CommentRepository, m metrics.Metrics) *InstrumentedCommentRepository {
+	return &InstrumentedCommentRepository{
+		InstrumentedRepository: NewInstrumentedRepository[models.Comment, int](repo, "comments", m),
+		comments:               repo,
+	}
+}
+
+func (r *InstrumentedCommentRepository) FindByPostID(ctx context.Context, postID int) ([]*models.Comment, error) {
+	start := time.Now()
+	comments, err := r.comments.FindByPostID(ctx, postID)
+	r.observe("FindByPostID", start, err)
+	return comments, err
+}
+
+func (r *InstrumentedCommentRepository) FindPageByPostID(ctx context.Context, postID int, req models.PageRequest) (*models.Page[models.Comment], error) {
+	start := time.Now()
+	page, err := r.comments.FindPageByPostID(ctx, postID, req)
+	r.observe("FindPageByPostID", start, err)
+	return page, err
+}
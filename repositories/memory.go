@@ -0,0 +1,249 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"github.com/hendratommy/repository-pattern/memstore"
+	"github.com/hendratommy/repository-pattern/models"
+	"time"
+)
+
+type ctxMemoryTransactionKey struct{}
+
+var ErrInvalidMemoryTxType = errors.New("invalid tx type, tx type should be *memstore.Tx")
+
+func getMemoryDatabase(ctx context.Context, db *memstore.DB) (memstore.Database, error) {
+	txv := ctx.Value(ctxMemoryTransactionKey{})
+	if txv == nil {
+		return db, nil
+	}
+	if tx, ok := txv.(*memstore.Tx); ok {
+		return tx, nil
+	}
+	return nil, ErrInvalidMemoryTxType
+}
+
+// inMemoryTransaction runs fn in a new transaction, only the timeout of txOpts applies, the transaction is rolled back
+// when it elapsed by the end of fn. A commit failing with memstore.ErrTxConflict is retried.
+func inMemoryTransaction(ctx context.Context, db *memstore.DB, retry RetryPolicy, txOpts models.TxOptions, fn func(context.Context) error) error {
+	ctx, cancel := withTimeout(ctx, txOpts)
+	defer cancel()
+	retryable := func(err error) bool { return errors.Is(err, memstore.ErrTxConflict) }
+	return retry.run(ctx, retryable, func() error {
+		tx := db.Begin()
+		trxCtx := context.WithValue(ctx, ctxMemoryTransactionKey{}, tx)
+		return runTransaction(trxCtx, func(ctx context.Context) error {
+			if err := fn(ctx); err != nil {
+				return err
+			}
+			return ctx.Err()
+		}, tx.Commit, tx.Rollback)
+	})
+}
+
+// ensureMemoryTransaction runs fn in the transaction carried by ctx, or in a new one when there is none.
+func ensureMemoryTransaction(ctx context.Context, db *memstore.DB, retry RetryPolicy, fn func(context.Context) error) error {
+	if ctx.Value(ctxMemoryTransactionKey{}) != nil {
+		return fn(ctx)
+	}
+	return inMemoryTransaction(ctx, db, retry, models.TxOptions{}, fn)
+}
+
+// MemoryRepository implements models.Repository for any model mapped by a memstore.Table.
+type MemoryRepository[T any, ID comparable] struct {
+	db    *memstore.DB
+	table *memstore.Table[T, ID]
+	opts  options
+}
+
+func NewMemoryRepository[T any, ID comparable](db *memstore.DB, table *memstore.Table[T, ID], opts ...Option) *MemoryRepository[T, ID] {
+	o := newOptions(opts)
+	if o.softDelete {
+		table = table.SoftDelete()
+	}
+	if o.now != nil {
+		table = table.WithClock(o.now)
+	}
+	return &MemoryRepository[T, ID]{db: db, table: table, opts: o}
+}
+
+func (r *MemoryRepository[T, ID]) FindByID(ctx context.Context, id ID) (*T, error) {
+	db, err := getMemoryDatabase(ctx, r.db)
+	if err != nil {
+		return nil, err
+	}
+	return r.table.FindByID(ctx, db, id)
+}
+
+func (r *MemoryRepository[T, ID]) Count(ctx context.Context, spec models.Spec) (int64, error) {
+	db, err := getMemoryDatabase(ctx, r.db)
+	if err != nil {
+		return 0, err
+	}
+	return r.table.Count(ctx, db, spec)
+}
+
+func (r *MemoryRepository[T, ID]) Exists(ctx context.Context, id ID) (bool, error) {
+	db, err := getMemoryDatabase(ctx, r.db)
+	if err != nil {
+		return false, err
+	}
+	return r.table.Exists(ctx, db, id)
+}
+
+func (r *MemoryRepository[T, ID]) FindAll(ctx context.Context) ([]*T, error) {
+	db, err := getMemoryDatabase(ctx, r.db)
+	if err != nil {
+		return nil, err
+	}
+	return r.table.FindAll(ctx, db)
+}
+
+func (r *MemoryRepository[T, ID]) FindBy(ctx context.Context, spec models.Spec) ([]*T, error) {
+	db, err := getMemoryDatabase(ctx, r.db)
+	if err != nil {
+		return nil, err
+	}
+	return r.table.Find(ctx, db, spec)
+}
+
+func (r *MemoryRepository[T, ID]) FindPage(ctx context.Context, req models.PageRequest) (*models.Page[T], error) {
+	db, err := getMemoryDatabase(ctx, r.db)
+	if err != nil {
+		return nil, err
+	}
+	return r.table.FindPage(ctx, db, req)
+}
+
+func (r *MemoryRepository[T, ID]) Save(ctx context.Context, m *T) error {
+	db, err := getMemoryDatabase(ctx, r.db)
+	if err != nil {
+		return err
+	}
+	return r.table.Save(ctx, db, m)
+}
+
+func (r *MemoryRepository[T, ID]) SaveAll(ctx context.Context, ms []*T) error {
+	return ensureMemoryTransaction(ctx, r.db, r.opts.retry, func(ctx context.Context) error {
+		db, err := getMemoryDatabase(ctx, r.db)
+		if err != nil {
+			return err
+		}
+		return r.table.SaveAll(ctx, db, ms)
+	})
+}
+
+func (r *MemoryRepository[T, ID]) Insert(ctx context.Context, m *T) error {
+	db, err := getMemoryDatabase(ctx, r.db)
+	if err != nil {
+		return err
+	}
+	return r.table.Insert(ctx, db, m)
+}
+
+func (r *MemoryRepository[T, ID]) Update(ctx context.Context, m *T) error {
+	db, err := getMemoryDatabase(ctx, r.db)
+	if err != nil {
+		return err
+	}
+	return r.table.Update(ctx, db, m)
+}
+
+func (r *MemoryRepository[T, ID]) Delete(ctx context.Context, id ID) error {
+	db, err := getMemoryDatabase(ctx, r.db)
+	if err != nil {
+		return err
+	}
+	return r.table.Delete(ctx, db, id)
+}
+
+func (r *MemoryRepository[T, ID]) Restore(ctx context.Context, id ID) error {
+	db, err := getMemoryDatabase(ctx, r.db)
+	if err != nil {
+		return err
+	}
+	return r.table.Restore(ctx, db, id)
+}
+
+func (r *MemoryRepository[T, ID]) FindIncludingDeleted(ctx context.Context, spec models.Spec) ([]*T, error) {
+	db, err := getMemoryDatabase(ctx, r.db)
+	if err != nil {
+		return nil, err
+	}
+	return r.table.FindIncludingDeleted(ctx, db, spec)
+}
+
+func (r *MemoryRepository[T, ID]) Purge(ctx context.Context, olderThan time.Duration) (int64, error) {
+	db, err := getMemoryDatabase(ctx, r.db)
+	if err != nil {
+		return 0, err
+	}
+	return r.table.Purge(ctx, db, olderThan)
+}
+
+func (r *MemoryRepository[T, ID]) InTransaction(ctx context.Context, fn func(context.Context) error) error {
+	return inMemoryTransaction(ctx, r.db, r.opts.retry, models.TxOptions{}, fn)
+}
+
+func (r *MemoryRepository[T, ID]) InTransactionWithOptions(ctx context.Context, opts models.TxOptions, fn func(context.Context) error) error {
+	return inMemoryTransaction(ctx, r.db, r.opts.retry, opts, fn)
+}
+
+type MemoryPostRepository struct {
+	*MemoryRepository[models.Post, int]
+	// comments are soft deleted and stamped like the posts by DeleteCascade
+	comments *memstore.Table[models.Comment, int]
+}
+
+func NewMemoryPostRepository(db *memstore.DB, opts ...Option) *MemoryPostRepository {
+	return &MemoryPostRepository{
+		MemoryRepository: NewMemoryRepository(db, memstore.Posts, opts...),
+		comments:         NewMemoryRepository(db, memstore.Comments, opts...).table,
+	}
+}
+
+// Delete refuses to delete a post that still has comments with models.ErrInvalidReference, a soft delete only hides
+// the post.
+func (r *MemoryPostRepository) Delete(ctx context.Context, id int) error {
+	if r.opts.softDelete {
+		return r.MemoryRepository.Delete(ctx, id)
+	}
+	db, err := getMemoryDatabase(ctx, r.db)
+	if err != nil {
+		return err
+	}
+	return memstore.DeletePost(ctx, db, id)
+}
+
+func (r *MemoryPostRepository) DeleteCascade(ctx context.Context, id int) (int64, error) {
+	var n int64
+	err := ensureMemoryTransaction(ctx, r.db, r.opts.retry, func(ctx context.Context) error {
+		db, err := getMemoryDatabase(ctx, r.db)
+		if err != nil {
+			return err
+		}
+		n, err = memstore.DeletePostCascadeFrom(ctx, db, r.table, r.comments, id)
+		return err
+	})
+	return n, err
+}
+
+type MemoryCommentRepository struct {
+	*MemoryRepository[models.Comment, int]
+}
+
+func NewMemoryCommentRepository(db *memstore.DB, opts ...Option) *MemoryCommentRepository {
+	return &MemoryCommentRepository{NewMemoryRepository(db, memstore.Comments, opts...)}
+}
+
+func (r *MemoryCommentRepository) FindByPostID(ctx context.Context, postID int) ([]*models.Comment, error) {
+	return r.FindBy(ctx, models.Where(models.Eq("PostID", postID)))
+}
+
+func (r *MemoryCommentRepository) FindPageByPostID(ctx context.Context, postID int, req models.PageRequest) (*models.Page[models.Comment], error) {
+	db, err := getMemoryDatabase(ctx, r.db)
+	if err != nil {
+		return nil, err
+	}
+	return r.table.FindPageBy(ctx, db, models.Where(models.Eq("PostID", postID)), req)
+}
@@ -7,13 +7,17 @@ import (
 	"github.com/hendratommy/repository-pattern/models"
 	"github.com/hendratommy/repository-pattern/mongostore"
 	"go.mongodb.org/mongo-driver/mongo"
+	mongooptions "go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readconcern"
+	"go.mongodb.org/mongo-driver/mongo/writeconcern"
+	"time"
 )
 
-type MongoPostRepository struct {
-	db *mongo.Database
-}
-
-func inMongoTransaction(ctx context.Context, db *mongo.Database, fn func(context.Context) error) error {
+// inMongoTransaction runs fn in a transaction of a new session tuned by txOpts. As long as retry allows, the whole
+// transaction runs again when it fails on a TransientTransactionError, and the commit alone when its result is unknown.
+func inMongoTransaction(ctx context.Context, db *mongo.Database, retry RetryPolicy, txOpts models.TxOptions, fn func(context.Context) error) error {
+	ctx, cancel := withTimeout(ctx, txOpts)
+	defer cancel()
 	sess, err := db.Client().StartSession()
 	if err != nil {
 		return err
@@ -22,48 +26,176 @@ func inMongoTransaction(ctx context.Context, db *mongo.Database, fn func(context
 	return mongo.WithSession(ctx, sess, func(sc mongo.SessionContext) error {
 		defer sess.EndSession(context.Background())
 
-		if err := sc.StartTransaction(); err != nil {
-			return err
-		}
-		if err := fn(sc); err != nil {
-			return sc.AbortTransaction(sc)
-		}
-		return sc.CommitTransaction(sc)
+		return retry.run(sc, mongostore.IsTransientTransactionError, func() error {
+			if err := sc.StartTransaction(mongoTxOptions(txOpts)); err != nil {
+				return err
+			}
+			return runTransaction(sc, fn, func() error {
+				return retry.runWith(sc, mongostore.IsUnknownTransactionCommitResult, func() error {
+					return sc.CommitTransaction(sc)
+				})
+			}, func() error {
+				return sc.AbortTransaction(sc)
+			})
+		})
+	})
+}
+
+// ensureMongoTransaction runs fn in the session carried by ctx, or in a new transaction when there is none.
+func ensureMongoTransaction(ctx context.Context, db *mongo.Database, retry RetryPolicy, fn func(context.Context) error) error {
+	if mongo.SessionFromContext(ctx) != nil {
+		return fn(ctx)
+	}
+	return inMongoTransaction(ctx, db, retry, models.TxOptions{}, fn)
+}
+
+// mongoTxOptions maps opts onto a read and write concern, read committed reads what a majority acknowledged and the
+// stricter levels read from a snapshot.
+func mongoTxOptions(opts models.TxOptions) *mongooptions.TransactionOptions {
+	o := mongooptions.Transaction()
+	switch opts.Isolation {
+	case models.IsolationReadCommitted:
+		o.SetReadConcern(readconcern.Majority())
+	case models.IsolationRepeatableRead, models.IsolationSnapshot, models.IsolationSerializable:
+		o.SetReadConcern(readconcern.Snapshot())
+	}
+	if opts.DurableCommit {
+		o.SetWriteConcern(writeconcern.New(writeconcern.WMajority()))
+	}
+	return o
+}
+
+// MongoRepository implements models.Repository for any model mapped by a mongostore.Collection.
+type MongoRepository[T any, ID comparable] struct {
+	db   *mongo.Database
+	coll *mongostore.Collection[T, ID]
+	opts options
+}
+
+func NewMongoRepository[T any, ID comparable](db *mongo.Database, coll *mongostore.Collection[T, ID], opts ...Option) *MongoRepository[T, ID] {
+	o := newOptions(opts)
+	if o.softDelete {
+		coll = coll.SoftDelete()
+	}
+	if o.now != nil {
+		coll = coll.WithClock(o.now)
+	}
+	if o.batchSize > 0 {
+		coll = coll.WithBatchSize(o.batchSize)
+	}
+	return &MongoRepository[T, ID]{db: db, coll: coll, opts: o}
+}
+
+func (r *MongoRepository[T, ID]) FindByID(ctx context.Context, id ID) (*T, error) {
+	return r.coll.FindByID(ctx, r.db, id)
+}
+
+func (r *MongoRepository[T, ID]) Count(ctx context.Context, spec models.Spec) (int64, error) {
+	return r.coll.Count(ctx, r.db, spec)
+}
+
+func (r *MongoRepository[T, ID]) Exists(ctx context.Context, id ID) (bool, error) {
+	return r.coll.Exists(ctx, r.db, id)
+}
+
+func (r *MongoRepository[T, ID]) FindAll(ctx context.Context) ([]*T, error) {
+	return r.coll.FindAll(ctx, r.db)
+}
+
+func (r *MongoRepository[T, ID]) FindBy(ctx context.Context, spec models.Spec) ([]*T, error) {
+	return r.coll.Find(ctx, r.db, spec)
+}
+
+func (r *MongoRepository[T, ID]) FindPage(ctx context.Context, req models.PageRequest) (*models.Page[T], error) {
+	return r.coll.FindPage(ctx, r.db, req)
+}
+
+func (r *MongoRepository[T, ID]) Save(ctx context.Context, m *T) error {
+	return r.coll.Save(ctx, r.db, m)
+}
+
+func (r *MongoRepository[T, ID]) SaveAll(ctx context.Context, ms []*T) error {
+	return ensureMongoTransaction(ctx, r.db, r.opts.retry, func(ctx context.Context) error {
+		return r.coll.SaveAll(ctx, r.db, ms)
 	})
 }
 
-func NewMongoPostRepository(db *mongo.Database) *MongoPostRepository {
-	return &MongoPostRepository{db: db}
+func (r *MongoRepository[T, ID]) Insert(ctx context.Context, m *T) error {
+	return r.coll.Insert(ctx, r.db, m)
+}
+
+func (r *MongoRepository[T, ID]) Update(ctx context.Context, m *T) error {
+	return r.coll.Update(ctx, r.db, m)
+}
+
+func (r *MongoRepository[T, ID]) Delete(ctx context.Context, id ID) error {
+	return r.coll.Delete(ctx, r.db, id)
+}
+
+func (r *MongoRepository[T, ID]) Restore(ctx context.Context, id ID) error {
+	return r.coll.Restore(ctx, r.db, id)
+}
+
+func (r *MongoRepository[T, ID]) FindIncludingDeleted(ctx context.Context, spec models.Spec) ([]*T, error) {
+	return r.coll.FindIncludingDeleted(ctx, r.db, spec)
 }
 
-func (r *MongoPostRepository) FindByID(ctx context.Context, id int) (*models.Post, error) {
-	return mongostore.FindPostByID(ctx, r.db, id)
+func (r *MongoRepository[T, ID]) Purge(ctx context.Context, olderThan time.Duration) (int64, error) {
+	return r.coll.Purge(ctx, r.db, olderThan)
 }
 
-func (r *MongoPostRepository) Save(ctx context.Context, m *models.Post) error {
-	return mongostore.SavePost(ctx, r.db, m)
+func (r *MongoRepository[T, ID]) InTransaction(ctx context.Context, fn func(context.Context) error) error {
+	return inMongoTransaction(ctx, r.db, r.opts.retry, models.TxOptions{}, fn)
 }
 
-func (r *MongoPostRepository) InTransaction(ctx context.Context, fn func(context.Context) error) error {
-	return inMongoTransaction(ctx, r.db, fn)
+func (r *MongoRepository[T, ID]) InTransactionWithOptions(ctx context.Context, opts models.TxOptions, fn func(context.Context) error) error {
+	return inMongoTransaction(ctx, r.db, r.opts.retry, opts, fn)
+}
+
+type MongoPostRepository struct {
+	*MongoRepository[models.Post, int]
+	// comments are soft deleted and stamped like the posts by DeleteCascade
+	comments *mongostore.Collection[models.Comment, int]
+}
+
+func NewMongoPostRepository(db *mongo.Database, opts ...Option) *MongoPostRepository {
+	return &MongoPostRepository{
+		MongoRepository: NewMongoRepository(db, mongostore.Posts, opts...),
+		comments:        NewMongoRepository(db, mongostore.Comments, opts...).coll,
+	}
+}
+
+// Delete refuses to delete a post that still has comments with models.ErrInvalidReference, a soft delete only hides
+// the post.
+func (r *MongoPostRepository) Delete(ctx context.Context, id int) error {
+	if r.opts.softDelete {
+		return r.MongoRepository.Delete(ctx, id)
+	}
+	return mongostore.DeletePost(ctx, r.db, id)
+}
+
+func (r *MongoPostRepository) DeleteCascade(ctx context.Context, id int) (int64, error) {
+	var n int64
+	err := ensureMongoTransaction(ctx, r.db, r.opts.retry, func(ctx context.Context) error {
+		var err error
+		n, err = mongostore.DeletePostCascadeFrom(ctx, r.db, r.coll, r.comments, id)
+		return err
+	})
+	return n, err
 }
 
 type MongoCommentRepository struct {
-	db *mongo.Database
+	*MongoRepository[models.Comment, int]
 }
 
-func NewMongoCommentRepository(db *mongo.Database) *MongoCommentRepository {
-	return &MongoCommentRepository{db: db}
+func NewMongoCommentRepository(db *mongo.Database, opts ...Option) *MongoCommentRepository {
+	return &MongoCommentRepository{NewMongoRepository(db, mongostore.Comments, opts...)}
 }
 
 func (r *MongoCommentRepository) FindByPostID(ctx context.Context, postId int) ([]*models.Comment, error) {
-	return mongostore.FindCommentsByPostID(ctx, r.db, postId)
+	return r.FindBy(ctx, models.Where(models.Eq("PostID", postId)))
 }
 
-func (r *MongoCommentRepository) Save(ctx context.Context, m *models.Comment) error {
-	return mongostore.SaveComment(ctx, r.db, m)
+func (r *MongoCommentRepository) FindPageByPostID(ctx context.Context, postId int, req models.PageRequest) (*models.Page[models.Comment], error) {
+	return r.coll.FindPageBy(ctx, r.db, models.Where(models.Eq("PostID", postId)), req)
 }
-
-func (r *MongoCommentRepository) InTransaction(ctx context.Context, fn func(context.Context) error) error {
-	return inMongoTransaction(ctx, r.db, fn)
-}
\ No newline at end of file
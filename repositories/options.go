@@ -0,0 +1,79 @@
+package repositories
+
+import (
+	"github.com/hendratommy/repository-pattern/querylog"
+	"time"
+)
+
+// Option configures a repository when it is created.
+type Option func(*options)
+
+type options struct {
+	softDelete bool
+	now        func() time.Time
+	cacheTTL   time.Duration
+	cacheSize  int
+	queryLog   *querylog.Logger
+	retry      RetryPolicy
+	batchSize  int
+}
+
+// Caches of the caching repositories keep DefaultCacheSize entries for DefaultCacheTTL unless told otherwise.
+const (
+	DefaultCacheTTL  = time.Minute
+	DefaultCacheSize = 10000
+)
+
+func newOptions(opts []Option) options {
+	o := options{cacheTTL: DefaultCacheTTL, cacheSize: DefaultCacheSize}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// WithSoftDelete makes Delete set the deleted_at of an entity instead of removing it, the finders then leave it out
+// until it is restored. The entity needs a DeletedAt *time.Time field tagged `db:"deleted_at" bson:"deleted_at"`.
+func WithSoftDelete() Option {
+	return func(o *options) {
+		o.softDelete = true
+	}
+}
+
+// WithClock makes the repository take the CreatedAt and UpdatedAt of its entities, or a caching repository the age of
+// its entries, from now instead of time.Now.
+func WithClock(now func() time.Time) Option {
+	return func(o *options) {
+		o.now = now
+	}
+}
+
+// WithBatchSize makes SaveAll of a sql or mongo repository insert at most size entities per statement or call, see
+// sqlstore.DefaultBatchSize and mongostore.DefaultBatchSize.
+func WithBatchSize(size int) Option {
+	return func(o *options) {
+		o.batchSize = size
+	}
+}
+
+// WithCacheTTL makes a caching repository load an entry again once it is older than ttl.
+func WithCacheTTL(ttl time.Duration) Option {
+	return func(o *options) {
+		o.cacheTTL = ttl
+	}
+}
+
+// WithCacheSize makes a caching repository keep at most size entries per cache, dropping the least recently used.
+func WithCacheSize(size int) Option {
+	return func(o *options) {
+		o.cacheSize = size
+	}
+}
+
+// WithQueryLog makes a sql repository log its statements to l. Mongo commands are logged by the client instead, see
+// mongostore.LoggingMonitor.
+func WithQueryLog(l *querylog.Logger) Option {
+	return func(o *options) {
+		o.queryLog = l
+	}
+}
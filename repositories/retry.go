@@ -0,0 +1,70 @@
+package repositories
+
+import (
+	"context"
+	"math"
+	"math/rand"
+	"time"
+)
+
+// RetryPolicy makes InTransaction run a transaction again when it fails on a transient error, like a serialization
+// failure, a deadlock or a mongo TransientTransactionError. Every attempt runs fn from scratch in a new transaction,
+// so fn must not carry state from one attempt to the next. The zero value never retries.
+type RetryPolicy struct {
+	// MaxAttempts bounds the runs of a transaction, the first one included.
+	MaxAttempts int
+	// Backoff is the wait before the second attempt, doubled before every next one up to MaxBackoff when set. Each
+	// wait is jittered, it lasts between half and all of the backoff.
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+	// Retryable tells the errors worth another attempt, the transient errors of the backend when nil.
+	Retryable func(error) bool
+}
+
+// DefaultRetryPolicy suits transactions contending on a few rows, they get 5 attempts within about a second.
+var DefaultRetryPolicy = RetryPolicy{MaxAttempts: 5, Backoff: 20 * time.Millisecond, MaxBackoff: 500 * time.Millisecond}
+
+// WithRetry makes InTransaction, and the operations running their own transaction like SaveAll, retry as told by p.
+func WithRetry(p RetryPolicy) Option {
+	return func(o *options) {
+		o.retry = p
+	}
+}
+
+// run calls attempt until it succeeds, fails with an error not retryable or runs out of attempts, waiting in between.
+// retryable is used unless the policy has its own. It gives up early, with the last error, when ctx is done.
+func (p RetryPolicy) run(ctx context.Context, retryable func(error) bool, attempt func() error) error {
+	if p.Retryable != nil {
+		retryable = p.Retryable
+	}
+	return p.runWith(ctx, retryable, attempt)
+}
+
+// runWith is run with retryable whatever the policy says, for retries the backend requires like mongo commits.
+func (p RetryPolicy) runWith(ctx context.Context, retryable func(error) bool, attempt func() error) error {
+	backoff := p.Backoff
+	if backoff < 0 {
+		backoff = 0
+	}
+	for n := 1; ; n++ {
+		err := attempt()
+		if err == nil || n >= p.MaxAttempts || !retryable(err) {
+			return err
+		}
+		wait := backoff/2 + time.Duration(rand.Int63n(int64(backoff-backoff/2)+1))
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+		// doubling stops short of overflowing into a negative backoff
+		if backoff <= math.MaxInt64/2 {
+			backoff *= 2
+		}
+		if p.MaxBackoff > 0 && backoff > p.MaxBackoff {
+			backoff = p.MaxBackoff
+		}
+	}
+}
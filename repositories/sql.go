@@ -2,105 +2,287 @@ package repositories
 
 import (
 	"context"
+	"database/sql"
 	"errors"
 	"github.com/hendratommy/repository-pattern/models"
+	"github.com/hendratommy/repository-pattern/querylog"
 	"github.com/hendratommy/repository-pattern/sqlstore"
+	"github.com/hendratommy/repository-pattern/tracing"
 	"github.com/jmoiron/sqlx"
+	"time"
 )
 
 type ctxTransactionKey struct{}
 
-type SqlPostRepository struct {
-	db *sqlx.DB
-}
-
 type sqlRepository interface {
 	getDB() *sqlx.DB
+	getOptions() options
 }
 
 var ErrInvalidTxType = errors.New("invalid tx type, tx type should be *sqlx.Tx")
 
+// getSqlxDatabase returns the transaction carried by ctx, or the database when there is none. The statements are
+// logged when the repository has a query log, and traced as children of the span carried by ctx if any.
 func getSqlxDatabase(ctx context.Context, r sqlRepository) (sqlstore.SqlxDatabase, error) {
-	txv := ctx.Value(ctxTransactionKey{})
-	if txv == nil {
-		return r.getDB(), nil
+	var db sqlstore.SqlxDatabase = r.getDB()
+	if txv := ctx.Value(ctxTransactionKey{}); txv != nil {
+		tx, ok := txv.(*sqlx.Tx)
+		if !ok {
+			return nil, ErrInvalidTxType
+		}
+		db = tx
+	}
+	if l := r.getOptions().queryLog; l != nil {
+		db = sqlstore.Logged(db, l)
+	}
+	if tracing.SpanFromContext(ctx) != nil {
+		db = sqlstore.Traced(db)
+	}
+	return db, nil
+}
+
+// inSqlTransaction runs fn in a new transaction tuned by txOpts, again in a new one as long as the retry policy of r
+// allows when it fails on a transient error of the dialect.
+func inSqlTransaction(ctx context.Context, r sqlRepository, txOpts models.TxOptions, fn func(context.Context) error) error {
+	ctx, cancel := withTimeout(ctx, txOpts)
+	defer cancel()
+	db := r.getDB()
+	return r.getOptions().retry.run(ctx, sqlstore.DialectOf(db).Retryable, func() error {
+		tx, err := db.BeginTxx(ctx, sqlTxOptions(txOpts))
+		if err != nil {
+			return err
+		}
+		trxCtx := context.WithValue(ctx, ctxTransactionKey{}, tx)
+		trxCtx = querylog.WithTxID(trxCtx, querylog.NewTxID())
+		return runTransaction(trxCtx, fn, tx.Commit, tx.Rollback)
+	})
+}
+
+// ensureSqlTransaction runs fn in the transaction carried by ctx, or in a new one when there is none.
+func ensureSqlTransaction(ctx context.Context, r sqlRepository, fn func(context.Context) error) error {
+	if ctx.Value(ctxTransactionKey{}) != nil {
+		return fn(ctx)
+	}
+	return inSqlTransaction(ctx, r, models.TxOptions{}, fn)
+}
+
+// sqlTxOptions maps opts onto database/sql, snapshot is repeatable read which postgres and mysql implement with one.
+func sqlTxOptions(opts models.TxOptions) *sql.TxOptions {
+	levels := map[models.IsolationLevel]sql.IsolationLevel{
+		models.IsolationReadCommitted:  sql.LevelReadCommitted,
+		models.IsolationRepeatableRead: sql.LevelRepeatableRead,
+		models.IsolationSnapshot:       sql.LevelRepeatableRead,
+		models.IsolationSerializable:   sql.LevelSerializable,
+	}
+	return &sql.TxOptions{Isolation: levels[opts.Isolation], ReadOnly: opts.ReadOnly}
+}
+
+// SqlRepository implements models.Repository for any model mapped by a sqlstore.Table.
+type SqlRepository[T any, ID comparable] struct {
+	db    *sqlx.DB
+	table *sqlstore.Table[T, ID]
+	opts  options
+}
+
+func NewSqlRepository[T any, ID comparable](db *sqlx.DB, table *sqlstore.Table[T, ID], opts ...Option) *SqlRepository[T, ID] {
+	o := newOptions(opts)
+	if o.softDelete {
+		table = table.SoftDelete()
+	}
+	if o.now != nil {
+		table = table.WithClock(o.now)
+	}
+	if o.batchSize > 0 {
+		table = table.WithBatchSize(o.batchSize)
+	}
+	return &SqlRepository[T, ID]{db: db, table: table, opts: o}
+}
+
+func (r *SqlRepository[T, ID]) getDB() *sqlx.DB {
+	return r.db
+}
+
+func (r *SqlRepository[T, ID]) getOptions() options {
+	return r.opts
+}
+
+func (r *SqlRepository[T, ID]) FindByID(ctx context.Context, id ID) (*T, error) {
+	db, err := getSqlxDatabase(ctx, r)
+	if err != nil {
+		return nil, err
+	}
+	return r.table.FindByID(ctx, db, id)
+}
+
+func (r *SqlRepository[T, ID]) Count(ctx context.Context, spec models.Spec) (int64, error) {
+	db, err := getSqlxDatabase(ctx, r)
+	if err != nil {
+		return 0, err
 	}
-	if tx, ok := txv.(*sqlx.Tx); ok {
-		return tx, nil
+	return r.table.Count(ctx, db, spec)
+}
+
+func (r *SqlRepository[T, ID]) Exists(ctx context.Context, id ID) (bool, error) {
+	db, err := getSqlxDatabase(ctx, r)
+	if err != nil {
+		return false, err
+	}
+	return r.table.Exists(ctx, db, id)
+}
+
+func (r *SqlRepository[T, ID]) FindAll(ctx context.Context) ([]*T, error) {
+	db, err := getSqlxDatabase(ctx, r)
+	if err != nil {
+		return nil, err
 	}
-	return nil, ErrInvalidTxType
+	return r.table.FindAll(ctx, db)
 }
 
-func inSqlTransaction(ctx context.Context, r sqlRepository, fn func(context.Context) error) error {
-	tx, err := r.getDB().BeginTxx(ctx, nil)
+func (r *SqlRepository[T, ID]) FindBy(ctx context.Context, spec models.Spec) ([]*T, error) {
+	db, err := getSqlxDatabase(ctx, r)
+	if err != nil {
+		return nil, err
+	}
+	return r.table.Find(ctx, db, spec)
+}
+
+func (r *SqlRepository[T, ID]) FindPage(ctx context.Context, req models.PageRequest) (*models.Page[T], error) {
+	db, err := getSqlxDatabase(ctx, r)
+	if err != nil {
+		return nil, err
+	}
+	return r.table.FindPage(ctx, db, req)
+}
+
+func (r *SqlRepository[T, ID]) Save(ctx context.Context, m *T) error {
+	db, err := getSqlxDatabase(ctx, r)
 	if err != nil {
 		return err
 	}
-	trxCtx := context.WithValue(ctx, ctxTransactionKey{}, tx)
+	return r.table.Save(ctx, db, m)
+}
 
-	err = fn(trxCtx)
+func (r *SqlRepository[T, ID]) SaveAll(ctx context.Context, ms []*T) error {
+	return ensureSqlTransaction(ctx, r, func(ctx context.Context) error {
+		db, err := getSqlxDatabase(ctx, r)
+		if err != nil {
+			return err
+		}
+		return r.table.SaveAll(ctx, db, ms)
+	})
+}
+
+func (r *SqlRepository[T, ID]) Insert(ctx context.Context, m *T) error {
+	db, err := getSqlxDatabase(ctx, r)
 	if err != nil {
-		return tx.Rollback()
+		return err
 	}
-	return tx.Commit()
+	return r.table.Insert(ctx, db, m)
 }
 
-func NewSqlPostRepository(db *sqlx.DB) *SqlPostRepository {
-	return &SqlPostRepository{db: db}
+func (r *SqlRepository[T, ID]) Update(ctx context.Context, m *T) error {
+	db, err := getSqlxDatabase(ctx, r)
+	if err != nil {
+		return err
+	}
+	return r.table.Update(ctx, db, m)
 }
 
-func (r *SqlPostRepository) getDB() *sqlx.DB {
-	return r.db
+func (r *SqlRepository[T, ID]) Delete(ctx context.Context, id ID) error {
+	db, err := getSqlxDatabase(ctx, r)
+	if err != nil {
+		return err
+	}
+	return r.table.Delete(ctx, db, id)
 }
 
-func (r *SqlPostRepository) Save(ctx context.Context, p *models.Post) error {
+func (r *SqlRepository[T, ID]) Restore(ctx context.Context, id ID) error {
 	db, err := getSqlxDatabase(ctx, r)
 	if err != nil {
 		return err
 	}
-	return sqlstore.SavePost(ctx, db, p)
+	return r.table.Restore(ctx, db, id)
 }
 
-func (r *SqlPostRepository) FindByID(ctx context.Context, id int) (*models.Post, error) {
+func (r *SqlRepository[T, ID]) FindIncludingDeleted(ctx context.Context, spec models.Spec) ([]*T, error) {
 	db, err := getSqlxDatabase(ctx, r)
 	if err != nil {
 		return nil, err
 	}
-	return sqlstore.FindPostByID(ctx, db, id)
+	return r.table.FindIncludingDeleted(ctx, db, spec)
 }
 
-func (r *SqlPostRepository) InTransaction(ctx context.Context, fn func(context.Context) error) error {
-	return inSqlTransaction(ctx, r, fn)
+func (r *SqlRepository[T, ID]) Purge(ctx context.Context, olderThan time.Duration) (int64, error) {
+	db, err := getSqlxDatabase(ctx, r)
+	if err != nil {
+		return 0, err
+	}
+	return r.table.Purge(ctx, db, olderThan)
 }
 
-type SqlCommentRepository struct {
-	db *sqlx.DB
+func (r *SqlRepository[T, ID]) InTransaction(ctx context.Context, fn func(context.Context) error) error {
+	return inSqlTransaction(ctx, r, models.TxOptions{}, fn)
 }
 
-func NewSqlCommentRepository(db *sqlx.DB) *SqlCommentRepository {
-	return &SqlCommentRepository{db: db}
+func (r *SqlRepository[T, ID]) InTransactionWithOptions(ctx context.Context, opts models.TxOptions, fn func(context.Context) error) error {
+	return inSqlTransaction(ctx, r, opts, fn)
 }
 
-func (r *SqlCommentRepository) getDB() *sqlx.DB {
-	return r.db
+type SqlPostRepository struct {
+	*SqlRepository[models.Post, int]
+	// comments are soft deleted and stamped like the posts by DeleteCascade
+	comments *sqlstore.Table[models.Comment, int]
+}
+
+func NewSqlPostRepository(db *sqlx.DB, opts ...Option) *SqlPostRepository {
+	return &SqlPostRepository{
+		SqlRepository: NewSqlRepository(db, sqlstore.Posts, opts...),
+		comments:      NewSqlRepository(db, sqlstore.Comments, opts...).table,
+	}
 }
 
-func (r *SqlCommentRepository) Save(ctx context.Context, c *models.Comment) error {
+// Delete refuses to delete a post that still has comments with models.ErrInvalidReference, a soft delete only hides
+// the post.
+func (r *SqlPostRepository) Delete(ctx context.Context, id int) error {
+	if r.opts.softDelete {
+		return r.SqlRepository.Delete(ctx, id)
+	}
 	db, err := getSqlxDatabase(ctx, r)
 	if err != nil {
 		return err
 	}
-	return sqlstore.SaveComment(ctx, db, c)
+	return sqlstore.DeletePost(ctx, db, id)
+}
+
+func (r *SqlPostRepository) DeleteCascade(ctx context.Context, id int) (int64, error) {
+	var n int64
+	err := ensureSqlTransaction(ctx, r, func(ctx context.Context) error {
+		db, err := getSqlxDatabase(ctx, r)
+		if err != nil {
+			return err
+		}
+		n, err = sqlstore.DeletePostCascadeFrom(ctx, db, r.table, r.comments, id)
+		return err
+	})
+	return n, err
+}
+
+type SqlCommentRepository struct {
+	*SqlRepository[models.Comment, int]
+}
+
+func NewSqlCommentRepository(db *sqlx.DB, opts ...Option) *SqlCommentRepository {
+	return &SqlCommentRepository{NewSqlRepository(db, sqlstore.Comments, opts...)}
 }
 
 func (r *SqlCommentRepository) FindByPostID(ctx context.Context, postID int) ([]*models.Comment, error) {
+	return r.FindBy(ctx, models.Where(models.Eq("PostID", postID)))
+}
+
+func (r *SqlCommentRepository) FindPageByPostID(ctx context.Context, postID int, req models.PageRequest) (*models.Page[models.Comment], error) {
 	db, err := getSqlxDatabase(ctx, r)
 	if err != nil {
 		return nil, err
 	}
-	return sqlstore.FindCommentsByPostID(ctx, db, postID)
-}
-
-func (r *SqlCommentRepository) InTransaction(ctx context.Context, fn func(context.Context) error) error {
-	return inSqlTransaction(ctx, r, fn)
+	return r.table.FindPageBy(ctx, db, models.Where(models.Eq("PostID", postID)), req)
 }
@@ -0,0 +1,16 @@
+package repositories
+
+import (
+	"github.com/jmoiron/sqlx"
+)
+
+// SQLite shares the sql repositories, queries follow the sqlstore.Dialect of the driver db was opened with,
+// db should come from sqlstore.ConnectSqlite.
+
+func NewSqlitePostRepository(db *sqlx.DB, opts ...Option) *SqlPostRepository {
+	return NewSqlPostRepository(db, opts...)
+}
+
+func NewSqliteCommentRepository(db *sqlx.DB, opts ...Option) *SqlCommentRepository {
+	return NewSqlCommentRepository(db, opts...)
+}
@@ -0,0 +1,241 @@
+package repositories
+
+import (
+	"context"
+	"github.com/hendratommy/repository-pattern/models"
+	"github.com/hendratommy/repository-pattern/sqlstore"
+	"github.com/hendratommy/repository-pattern/tracing"
+	"time"
+)
+
+// describer is implemented by the repositories of this package, it names their backend and table or collection.
+type describer interface {
+	describe() (backend, table string)
+}
+
+func (r *SqlRepository[T, ID]) describe() (string, string) {
+	return sqlstore.DialectOf(r.db).Name(), r.table.Name
+}
+
+func (r *MongoRepository[T, ID]) describe() (string, string) {
+	return "mongodb", r.coll.Name
+}
+
+func (r *MemoryRepository[T, ID]) describe() (string, string) {
+	return "memory", r.table.Name
+}
+
+// TracedRepository decorates a models.Repository recording a span per operation, named after the repository and the
+// operation like posts.FindByID, and a parent span per transaction for the operations of fn. The spans hold the
+// backend, the table or collection and how many rows were returned or changed. The span travels in the ctx passed
+// down, so the sql statements and, with mongostore.TracingMonitor, the mongo commands are traced as its children.
+type TracedRepository[T any, ID comparable] struct {
+	repo   models.Repository[T, ID]
+	name   string
+	tracer *tracing.Tracer
+	attrs  tracing.Attributes
+}
+
+// NewTracedRepository wraps repo, name prefixes the names of its spans.
+func NewTracedRepository[T any, ID comparable](repo models.Repository[T, ID], name string, tracer *tracing.Tracer) *TracedRepository[T, ID] {
+	attrs := tracing.Attributes{}
+	if d, ok := repo.(describer); ok {
+		backend, table := d.describe()
+		attrs["db.system"] = backend
+		attrs["db.table"] = table
+	}
+	return &TracedRepository[T, ID]{repo: repo, name: name, tracer: tracer, attrs: attrs}
+}
+
+func (r *TracedRepository[T, ID]) start(ctx context.Context, operation string) (context.Context, *tracing.Span) {
+	ctx, span := r.tracer.Start(ctx, r.name+"."+operation)
+	for k, v := range r.attrs {
+		span.SetAttribute(k, v)
+	}
+	return ctx, span
+}
+
+// endSpan ends span with err, rows is only recorded when the operation succeeded.
+func endSpan(span *tracing.Span, err error, rows int64) {
+	if err != nil {
+		span.RecordError(err)
+	} else if rows >= 0 {
+		span.SetAttribute("db.rows", rows)
+	}
+	span.End()
+}
+
+func (r *TracedRepository[T, ID]) FindByID(ctx context.Context, id ID) (*T, error) {
+	ctx, span := r.start(ctx, "FindByID")
+	m, err := r.repo.FindByID(ctx, id)
+	endSpan(span, err, 1)
+	return m, err
+}
+
+func (r *TracedRepository[T, ID]) FindAll(ctx context.Context) ([]*T, error) {
+	ctx, span := r.start(ctx, "FindAll")
+	ms, err := r.repo.FindAll(ctx)
+	endSpan(span, err, int64(len(ms)))
+	return ms, err
+}
+
+func (r *TracedRepository[T, ID]) FindBy(ctx context.Context, spec models.Spec) ([]*T, error) {
+	ctx, span := r.start(ctx, "FindBy")
+	ms, err := r.repo.FindBy(ctx, spec)
+	endSpan(span, err, int64(len(ms)))
+	return ms, err
+}
+
+func (r *TracedRepository[T, ID]) Count(ctx context.Context, spec models.Spec) (int64, error) {
+	ctx, span := r.start(ctx, "Count")
+	n, err := r.repo.Count(ctx, spec)
+	endSpan(span, err, -1)
+	return n, err
+}
+
+func (r *TracedRepository[T, ID]) Exists(ctx context.Context, id ID) (bool, error) {
+	ctx, span := r.start(ctx, "Exists")
+	ok, err := r.repo.Exists(ctx, id)
+	endSpan(span, err, -1)
+	return ok, err
+}
+
+func (r *TracedRepository[T, ID]) FindPage(ctx context.Context, req models.PageRequest) (*models.Page[T], error) {
+	ctx, span := r.start(ctx, "FindPage")
+	page, err := r.repo.FindPage(ctx, req)
+	endSpan(span, err, pageRows(page))
+	return page, err
+}
+
+func (r *TracedRepository[T, ID]) Save(ctx context.Context, m *T) error {
+	ctx, span := r.start(ctx, "Save")
+	err := r.repo.Save(ctx, m)
+	endSpan(span, err, 1)
+	return err
+}
+
+func (r *TracedRepository[T, ID]) SaveAll(ctx context.Context, ms []*T) error {
+	ctx, span := r.start(ctx, "SaveAll")
+	err := r.repo.SaveAll(ctx, ms)
+	endSpan(span, err, int64(len(ms)))
+	return err
+}
+
+func (r *TracedRepository[T, ID]) Insert(ctx context.Context, m *T) error {
+	ctx, span := r.start(ctx, "Insert")
+	err := r.repo.Insert(ctx, m)
+	endSpan(span, err, 1)
+	return err
+}
+
+func (r *TracedRepository[T, ID]) Update(ctx context.Context, m *T) error {
+	ctx, span := r.start(ctx, "Update")
+	err := r.repo.Update(ctx, m)
+	endSpan(span, err, 1)
+	return err
+}
+
+func (r *TracedRepository[T, ID]) Delete(ctx context.Context, id ID) error {
+	ctx, span := r.start(ctx, "Delete")
+	err := r.repo.Delete(ctx, id)
+	endSpan(span, err, 1)
+	return err
+}
+
+func (r *TracedRepository[T, ID]) Restore(ctx context.Context, id ID) error {
+	ctx, span := r.start(ctx, "Restore")
+	err := r.repo.Restore(ctx, id)
+	endSpan(span, err, 1)
+	return err
+}
+
+func (r *TracedRepository[T, ID]) FindIncludingDeleted(ctx context.Context, spec models.Spec) ([]*T, error) {
+	ctx, span := r.start(ctx, "FindIncludingDeleted")
+	ms, err := r.repo.FindIncludingDeleted(ctx, spec)
+	endSpan(span, err, int64(len(ms)))
+	return ms, err
+}
+
+func (r *TracedRepository[T, ID]) Purge(ctx context.Context, olderThan time.Duration) (int64, error) {
+	ctx, span := r.start(ctx, "Purge")
+	n, err := r.repo.Purge(ctx, olderThan)
+	endSpan(span, err, n)
+	return n, err
+}
+
+// InTransaction records a span for the whole transaction, parent of the spans of fn, failed when it rolled back.
+func (r *TracedRepository[T, ID]) InTransaction(ctx context.Context, fn func(context.Context) error) error {
+	ctx, span := r.start(ctx, "InTransaction")
+	defer span.End()
+	err := r.repo.InTransaction(ctx, fn)
+	span.RecordError(err)
+	return err
+}
+
+// InTransactionWithOptions is InTransaction with the options of the transaction on its span.
+func (r *TracedRepository[T, ID]) InTransactionWithOptions(ctx context.Context, opts models.TxOptions, fn func(context.Context) error) error {
+	ctx, span := r.start(ctx, "InTransaction")
+	defer span.End()
+	span.SetAttribute("db.tx.isolation", opts.Isolation.String())
+	span.SetAttribute("db.tx.read_only", opts.ReadOnly)
+	if opts.Timeout > 0 {
+		span.SetAttribute("db.tx.timeout", opts.Timeout.String())
+	}
+	err := r.repo.InTransactionWithOptions(ctx, opts, fn)
+	span.RecordError(err)
+	return err
+}
+
+func pageRows[T any](page *models.Page[T]) int64 {
+	if page == nil {
+		return 0
+	}
+	return int64(len(page.Items))
+}
+
+// TracedPostRepository traces a models.PostRepository, see TracedRepository.
+type TracedPostRepository struct {
+	*TracedRepository[models.Post, int]
+	posts models.PostRepository
+}
+
+func NewTracedPostRepository(repo models.PostRepository, tracer *tracing.Tracer) *TracedPostRepository {
+	return &TracedPostRepository{
+		TracedRepository: NewTracedRepository[models.Post, int](repo, "posts", tracer),
+		posts:            repo,
+	}
+}
+
+func (r *TracedPostRepository) DeleteCascade(ctx context.Context, id int) (int64, error) {
+	ctx, span := r.start(ctx, "DeleteCascade")
+	n, err := r.posts.DeleteCascade(ctx, id)
+	endSpan(span, err, n)
+	return n, err
+}
+
+// TracedCommentRepository traces a models.CommentRepository, see TracedRepository.
+type TracedCommentRepository struct {
+	*TracedRepository[models.Comment, int]
+	comments models.CommentRepository
+}
+
+func NewTracedCommentRepository(repo models.CommentRepository, tracer *tracing.Tracer) *TracedCommentRepository {
+	return &TracedCommentRepository{
+		TracedRepository: NewTracedRepository[models.Comment, int](repo, "comments", tracer),
+		comments:         repo,
+	}
+}
+
+func (r *TracedCommentRepository) FindByPostID(ctx context.Context, postID int) ([]*models.Comment, error) {
+	ctx, span := r.start(ctx, "FindByPostID")
+	comments, err := r.comments.FindByPostID(ctx, postID)
+	endSpan(span, err, int64(len(comments)))
+	return comments, err
+}
+
+func (r *TracedCommentRepository) FindPageByPostID(ctx context.Context, postID int, req models.PageRequest) (*models.Page[models.Comment], error) {
+	ctx, span := r.start(ctx, "FindPageByPostID")
+	page, err := r.comments.FindPageByPostID(ctx, postID, req)
+	endSpan(span, err, pageRows(page))
+	return page, err
+}
@@ -0,0 +1,30 @@
+package repositories
+
+import (
+	"context"
+	"github.com/hendratommy/repository-pattern/models"
+)
+
+// withTimeout returns ctx bounded by the timeout of opts, if any.
+func withTimeout(ctx context.Context, opts models.TxOptions) (context.Context, context.CancelFunc) {
+	if opts.Timeout > 0 {
+		return context.WithTimeout(ctx, opts.Timeout)
+	}
+	return context.WithCancel(ctx)
+}
+
+// runTransaction runs fn then commits, when fn fails the transaction is rolled back and a *models.TxError returned,
+// when fn panics the transaction is rolled back and the panic propagated.
+func runTransaction(ctx context.Context, fn func(context.Context) error, commit, rollback func() error) error {
+	defer func() {
+		if p := recover(); p != nil {
+			rollback()
+			panic(p)
+		}
+	}()
+
+	if err := fn(ctx); err != nil {
+		return &models.TxError{Err: err, RollbackErr: rollback()}
+	}
+	return commit()
+}
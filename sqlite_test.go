@@ -0,0 +1,1026 @@
+package repository_pattern
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/hendratommy/repository-pattern/models"
+	"github.com/hendratommy/repository-pattern/querylog"
+	"github.com/hendratommy/repository-pattern/repositories"
+	"github.com/hendratommy/repository-pattern/sqlstore"
+	"github.com/hendratommy/repository-pattern/tracing"
+	"github.com/jmoiron/sqlx"
+	. "github.com/smartystreets/goconvey/convey"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+)
+
+func prepareSqliteEnvironment(db *sqlx.DB) {
+	m, err := sqlstore.NewMigrator(db)
+	try(err)
+	_, err = m.Down(context.Background(), 0)
+	try(err)
+	try(sqlstore.Migrate(context.Background(), db))
+}
+
+func TestSqliteRepository(t *testing.T) {
+	db, err := sqlstore.ConnectSqlite(":memory:")
+	if err != nil {
+		panic(err)
+	}
+	defer db.Close()
+
+	Convey("Test sqlite repository", t, func() {
+		prepareSqliteEnvironment(db)
+
+		postRepo := repositories.NewSqlitePostRepository(db)
+		commentRepo := repositories.NewSqliteCommentRepository(db)
+
+		Convey("Test transaction commit", func() {
+			var p *models.Post
+			err := postRepo.InTransaction(context.Background(), func(ctx context.Context) error {
+				p = &models.Post{
+					Title: "implement repository pattern in go",
+				}
+				if err := postRepo.Save(ctx, p); err != nil {
+					return err
+				}
+
+				c1 := &models.Comment{
+					PostID: p.ID,
+					Review: "yayy",
+				}
+				c2 := &models.Comment{
+					PostID: p.ID,
+					Review: "nayy",
+				}
+				if err := commentRepo.Save(ctx, c1); err != nil {
+					return err
+				}
+				return commentRepo.Save(ctx, c2)
+			})
+
+			Convey("Should commit successfully", func() {
+				So(err, ShouldBeNil)
+
+				var posts []*models.Post
+				try(db.Select(&posts, `SELECT * FROM `+sqlstore.PostTable))
+
+				So(len(posts), ShouldEqual, 1)
+				So(posts[0].ID, ShouldEqual, p.ID)
+
+				comments, err := commentRepo.FindByPostID(context.Background(), p.ID)
+				So(err, ShouldBeNil)
+				So(len(comments), ShouldEqual, 2)
+				So(comments[0].Review, ShouldEqual, "yayy")
+				So(comments[1].Review, ShouldEqual, "nayy")
+			})
+		})
+
+		Convey("Test transaction rollback", func() {
+			err := postRepo.InTransaction(context.Background(), func(ctx context.Context) error {
+				p := &models.Post{
+					Title: "this should not persisted",
+				}
+				if err := postRepo.Save(ctx, p); err != nil {
+					return err
+				}
+
+				c1 := &models.Comment{
+					PostID: p.ID,
+					Review: "yayy",
+				}
+				if err := commentRepo.Save(ctx, c1); err != nil {
+					return err
+				}
+
+				return errors.New("should rollback")
+			})
+
+			Convey("Should rollback successfully", func() {
+				var txErr *models.TxError
+				So(errors.As(err, &txErr), ShouldBeTrue)
+				So(txErr.Err.Error(), ShouldEqual, "should rollback")
+				So(txErr.RollbackErr, ShouldBeNil)
+
+				var posts []*models.Post
+				try(db.Select(&posts, `SELECT * FROM `+sqlstore.PostTable))
+
+				So(len(posts), ShouldEqual, 0)
+
+				var comments []*models.Comment
+				try(db.Select(&comments, `SELECT * FROM `+sqlstore.CommentTable))
+
+				So(len(comments), ShouldEqual, 0)
+			})
+		})
+
+		Convey("Test transaction panic", func() {
+			So(func() {
+				postRepo.InTransaction(context.Background(), func(ctx context.Context) error {
+					if err := postRepo.Save(ctx, &models.Post{Title: "this should not persisted"}); err != nil {
+						return err
+					}
+					panic("should rollback")
+				})
+			}, ShouldPanicWith, "should rollback")
+
+			Convey("Should rollback before propagating the panic", func() {
+				var posts []*models.Post
+				try(db.Select(&posts, `SELECT * FROM `+sqlstore.PostTable))
+
+				So(len(posts), ShouldEqual, 0)
+			})
+		})
+
+		Convey("Test delete", func() {
+			p := &models.Post{Title: "implement repository pattern in go"}
+			try(postRepo.Save(context.Background(), p))
+			c := &models.Comment{PostID: p.ID, Review: "yayy"}
+			try(commentRepo.Save(context.Background(), c))
+
+			Convey("Should refuse to delete a post with comments", func() {
+				err := postRepo.Delete(context.Background(), p.ID)
+				So(errors.Is(err, models.ErrInvalidReference), ShouldBeTrue)
+			})
+
+			Convey("Should return not found when nothing is deleted", func() {
+				err := commentRepo.Delete(context.Background(), c.ID+1)
+				So(errors.Is(err, models.ErrNotFound), ShouldBeTrue)
+			})
+
+			Convey("Should join the transaction in ctx", func() {
+				err := postRepo.InTransaction(context.Background(), func(ctx context.Context) error {
+					if err := commentRepo.Delete(ctx, c.ID); err != nil {
+						return err
+					}
+					if err := postRepo.Delete(ctx, p.ID); err != nil {
+						return err
+					}
+					return errors.New("should rollback")
+				})
+				So(err.Error(), ShouldEqual, "should rollback")
+
+				_, err = commentRepo.FindByID(context.Background(), c.ID)
+				So(err, ShouldBeNil)
+
+				try(commentRepo.Delete(context.Background(), c.ID))
+				try(postRepo.Delete(context.Background(), p.ID))
+
+				_, err = postRepo.FindByID(context.Background(), p.ID)
+				So(errors.Is(err, models.ErrNotFound), ShouldBeTrue)
+			})
+		})
+
+		Convey("Test delete cascade", func() {
+			p := &models.Post{Title: "implement repository pattern in go"}
+			try(postRepo.Save(context.Background(), p))
+			try(commentRepo.Save(context.Background(), &models.Comment{PostID: p.ID, Review: "yayy"}))
+			try(commentRepo.Save(context.Background(), &models.Comment{PostID: p.ID, Review: "nayy"}))
+
+			Convey("Should delete the post and its comments", func() {
+				n, err := postRepo.DeleteCascade(context.Background(), p.ID)
+				So(err, ShouldBeNil)
+				So(n, ShouldEqual, 2)
+
+				_, err = postRepo.FindByID(context.Background(), p.ID)
+				So(errors.Is(err, models.ErrNotFound), ShouldBeTrue)
+				comments, err := commentRepo.FindByPostID(context.Background(), p.ID)
+				So(err, ShouldBeNil)
+				So(len(comments), ShouldEqual, 0)
+			})
+
+			Convey("Should return not found for unknown post", func() {
+				_, err := postRepo.DeleteCascade(context.Background(), p.ID+1)
+				So(errors.Is(err, models.ErrNotFound), ShouldBeTrue)
+			})
+
+			Convey("Should keep everything when the transaction rolls back", func() {
+				err := postRepo.InTransaction(context.Background(), func(ctx context.Context) error {
+					if _, err := postRepo.DeleteCascade(ctx, p.ID); err != nil {
+						return err
+					}
+					return errors.New("should rollback")
+				})
+				So(err.Error(), ShouldEqual, "should rollback")
+
+				comments, err := commentRepo.FindByPostID(context.Background(), p.ID)
+				So(err, ShouldBeNil)
+				So(len(comments), ShouldEqual, 2)
+			})
+		})
+
+		Convey("Test save existing id", func() {
+			p := &models.Post{Title: "implement repository pattern in go"}
+			try(postRepo.Save(context.Background(), p))
+			id := p.ID
+
+			p.Title = "implement repository pattern in go, revised"
+			try(postRepo.Save(context.Background(), p))
+
+			Convey("Should update instead of inserting", func() {
+				So(p.ID, ShouldEqual, id)
+
+				posts, err := postRepo.FindAll(context.Background())
+				So(err, ShouldBeNil)
+				So(len(posts), ShouldEqual, 1)
+				So(posts[0].Title, ShouldEqual, "implement repository pattern in go, revised")
+			})
+
+			Convey("Should insert with the given id and keep generating after it", func() {
+				explicit := &models.Post{ID: id + 10, Title: "explicit id"}
+				try(postRepo.Save(context.Background(), explicit))
+				So(explicit.ID, ShouldEqual, id+10)
+
+				generated := &models.Post{Title: "generated id"}
+				try(postRepo.Save(context.Background(), generated))
+				So(generated.ID, ShouldBeGreaterThan, id+10)
+			})
+
+			Convey("Should fail to insert a taken id", func() {
+				err := postRepo.Insert(context.Background(), &models.Post{ID: id, Title: "duplicate"})
+				So(errors.Is(err, models.ErrConflict), ShouldBeTrue)
+			})
+
+			Convey("Should fail to update a missing id", func() {
+				err := postRepo.Update(context.Background(), &models.Post{ID: id + 1, Title: "missing"})
+				So(errors.Is(err, models.ErrNotFound), ShouldBeTrue)
+
+				p.Title = "updated"
+				try(postRepo.Update(context.Background(), p))
+				found, err := postRepo.FindByID(context.Background(), id)
+				So(err, ShouldBeNil)
+				So(found.Title, ShouldEqual, "updated")
+			})
+		})
+
+		Convey("Test optimistic locking", func() {
+			p := &models.Post{Title: "implement repository pattern in go"}
+			try(postRepo.Save(context.Background(), p))
+			stale, err := postRepo.FindByID(context.Background(), p.ID)
+			try(err)
+
+			Convey("Should start at version 1 and increment on update", func() {
+				So(p.Version, ShouldEqual, 1)
+
+				p.Title = "implement repository pattern in go, revised"
+				try(postRepo.Update(context.Background(), p))
+				So(p.Version, ShouldEqual, 2)
+				try(postRepo.Save(context.Background(), p))
+				So(p.Version, ShouldEqual, 3)
+
+				found, err := postRepo.FindByID(context.Background(), p.ID)
+				So(err, ShouldBeNil)
+				So(found.Version, ShouldEqual, 3)
+			})
+
+			Convey("Should insert an explicit unknown id at version 1 whatever its version", func() {
+				explicit := &models.Post{ID: p.ID + 100, Title: "explicit id", Version: 7}
+				try(postRepo.Save(context.Background(), explicit))
+				So(explicit.Version, ShouldEqual, 1)
+
+				found, err := postRepo.FindByID(context.Background(), explicit.ID)
+				So(err, ShouldBeNil)
+				So(found.Version, ShouldEqual, 1)
+			})
+
+			Convey("Should report a conflict saving over a deleted entity", func() {
+				softPostRepo := repositories.NewSqlitePostRepository(db, repositories.WithSoftDelete())
+				try(softPostRepo.Delete(context.Background(), p.ID))
+				err := softPostRepo.Save(context.Background(), p)
+				So(errors.Is(err, models.ErrConflict), ShouldBeTrue)
+				So(errors.Is(err, models.ErrStaleVersion), ShouldBeFalse)
+			})
+
+			Convey("Should refuse to overwrite a newer version", func() {
+				p.Title = "first writer"
+				try(postRepo.Update(context.Background(), p))
+
+				stale.Title = "second writer"
+				err := postRepo.Update(context.Background(), stale)
+				So(errors.Is(err, models.ErrStaleVersion), ShouldBeTrue)
+				So(errors.Is(err, models.ErrConflict), ShouldBeTrue)
+				So(stale.Version, ShouldEqual, 1)
+
+				err = postRepo.Save(context.Background(), stale)
+				So(errors.Is(err, models.ErrStaleVersion), ShouldBeTrue)
+
+				found, err := postRepo.FindByID(context.Background(), p.ID)
+				So(err, ShouldBeNil)
+				So(found.Title, ShouldEqual, "first writer")
+			})
+		})
+
+		Convey("Test pagination", func() {
+			p := &models.Post{Title: "implement repository pattern in go"}
+			try(postRepo.Save(context.Background(), p))
+			for i := 0; i < 5; i++ {
+				try(postRepo.Save(context.Background(), &models.Post{Title: "filler"}))
+			}
+			for i := 0; i < 5; i++ {
+				try(commentRepo.Save(context.Background(), &models.Comment{PostID: p.ID, Review: "yayy"}))
+			}
+
+			Convey("Should walk every page with the cursor", func() {
+				var ids []int
+				req := models.PageRequest{Limit: 2}
+				for {
+					page, err := commentRepo.FindPageByPostID(context.Background(), p.ID, req)
+					So(err, ShouldBeNil)
+					for _, c := range page.Items {
+						ids = append(ids, c.ID)
+					}
+					if !page.HasMore {
+						So(page.NextCursor, ShouldBeEmpty)
+						break
+					}
+					req.Cursor = page.NextCursor
+				}
+				So(len(ids), ShouldEqual, 5)
+				for i := 1; i < len(ids); i++ {
+					So(ids[i], ShouldBeGreaterThan, ids[i-1])
+				}
+			})
+
+			Convey("Should skip with offset", func() {
+				page, err := postRepo.FindPage(context.Background(), models.PageRequest{Limit: 4, Offset: 4})
+				So(err, ShouldBeNil)
+				So(len(page.Items), ShouldEqual, 2)
+				So(page.HasMore, ShouldBeFalse)
+
+				page, err = postRepo.FindPage(context.Background(), models.PageRequest{Limit: 4, Offset: 1})
+				So(err, ShouldBeNil)
+				So(len(page.Items), ShouldEqual, 4)
+				So(page.HasMore, ShouldBeTrue)
+				So(page.Items[0].ID, ShouldBeGreaterThan, p.ID)
+			})
+
+			Convey("Should reject an invalid cursor", func() {
+				_, err := postRepo.FindPage(context.Background(), models.PageRequest{Cursor: "not a cursor"})
+				So(errors.Is(err, models.ErrInvalidCursor), ShouldBeTrue)
+			})
+		})
+
+		Convey("Test find by spec", func() {
+			p1 := &models.Post{Title: "implement repository pattern in go"}
+			try(postRepo.Save(context.Background(), p1))
+			p2 := &models.Post{Title: "implement unit of work in go"}
+			try(postRepo.Save(context.Background(), p2))
+			p3 := &models.Post{Title: "hello world"}
+			try(postRepo.Save(context.Background(), p3))
+			try(commentRepo.Save(context.Background(), &models.Comment{PostID: p1.ID, Review: "yayy"}))
+			try(commentRepo.Save(context.Background(), &models.Comment{PostID: p2.ID, Review: "nayy"}))
+			try(commentRepo.Save(context.Background(), &models.Comment{PostID: p2.ID, Review: "yayy"}))
+
+			Convey("Should filter with every operator", func() {
+				posts, err := postRepo.FindBy(context.Background(), models.Where(models.Like("Title", "implement%")))
+				So(err, ShouldBeNil)
+				So(len(posts), ShouldEqual, 2)
+
+				posts, err = postRepo.FindBy(context.Background(), models.Where(models.In("ID", p1.ID, p3.ID)))
+				So(err, ShouldBeNil)
+				So(len(posts), ShouldEqual, 2)
+				So(posts[1].ID, ShouldEqual, p3.ID)
+
+				posts, err = postRepo.FindBy(context.Background(), models.Where(models.Range("ID", p2.ID, nil)))
+				So(err, ShouldBeNil)
+				So(len(posts), ShouldEqual, 2)
+
+				comments, err := commentRepo.FindBy(context.Background(), models.Where(models.And(
+					models.Eq("PostID", p2.ID),
+					models.Or(models.Eq("Review", "yayy"), models.Eq("Review", "meh")),
+				)))
+				So(err, ShouldBeNil)
+				So(len(comments), ShouldEqual, 1)
+				So(comments[0].PostID, ShouldEqual, p2.ID)
+			})
+
+			Convey("Should order by the given fields then id", func() {
+				comments, err := commentRepo.FindBy(context.Background(), models.All().OrderBy(models.Asc("Review"), models.Desc("PostID")))
+				So(err, ShouldBeNil)
+				So(len(comments), ShouldEqual, 3)
+				So(comments[0].Review, ShouldEqual, "nayy")
+				So(comments[1].PostID, ShouldEqual, p2.ID)
+				So(comments[2].PostID, ShouldEqual, p1.ID)
+			})
+
+			Convey("Should treat values as data", func() {
+				posts, err := postRepo.FindBy(context.Background(), models.Where(models.Eq("Title", "x' OR '1'='1")))
+				So(err, ShouldBeNil)
+				So(len(posts), ShouldEqual, 0)
+			})
+
+			Convey("Should reject unknown fields", func() {
+				_, err := postRepo.FindBy(context.Background(), models.Where(models.Eq("title; DROP TABLE posts", 1)))
+				So(errors.Is(err, models.ErrInvalidSpec), ShouldBeTrue)
+			})
+		})
+
+		Convey("Test count and exists", func() {
+			p := &models.Post{Title: "implement repository pattern in go"}
+			try(postRepo.Save(context.Background(), p))
+			try(commentRepo.Save(context.Background(), &models.Comment{PostID: p.ID, Review: "yayy"}))
+			try(commentRepo.Save(context.Background(), &models.Comment{PostID: p.ID, Review: "nayy"}))
+
+			Convey("Should count matching entities", func() {
+				n, err := commentRepo.Count(context.Background(), models.Where(models.Eq("PostID", p.ID)))
+				So(err, ShouldBeNil)
+				So(n, ShouldEqual, 2)
+
+				n, err = commentRepo.Count(context.Background(), models.Where(models.Eq("PostID", p.ID+1)))
+				So(err, ShouldBeNil)
+				So(n, ShouldEqual, 0)
+
+				n, err = postRepo.Count(context.Background(), models.All())
+				So(err, ShouldBeNil)
+				So(n, ShouldEqual, 1)
+			})
+
+			Convey("Should tell whether an id exists", func() {
+				ok, err := postRepo.Exists(context.Background(), p.ID)
+				So(err, ShouldBeNil)
+				So(ok, ShouldBeTrue)
+
+				ok, err = postRepo.Exists(context.Background(), p.ID+1)
+				So(err, ShouldBeNil)
+				So(ok, ShouldBeFalse)
+			})
+
+			Convey("Should see the writes of the transaction in ctx", func() {
+				err := postRepo.InTransaction(context.Background(), func(ctx context.Context) error {
+					try(commentRepo.Save(ctx, &models.Comment{PostID: p.ID, Review: "meh"}))
+					n, err := commentRepo.Count(ctx, models.Where(models.Eq("PostID", p.ID)))
+					So(err, ShouldBeNil)
+					So(n, ShouldEqual, 3)
+					return errors.New("should rollback")
+				})
+				So(err, ShouldNotBeNil)
+
+				n, err := commentRepo.Count(context.Background(), models.Where(models.Eq("PostID", p.ID)))
+				So(err, ShouldBeNil)
+				So(n, ShouldEqual, 2)
+			})
+		})
+
+		Convey("Test save all", func() {
+			p := &models.Post{Title: "implement repository pattern in go"}
+			try(postRepo.Save(context.Background(), p))
+
+			Convey("Should insert in batches and assign the ids", func() {
+				comments := make([]*models.Comment, 2500)
+				for i := range comments {
+					comments[i] = &models.Comment{PostID: p.ID, Review: fmt.Sprintf("review %d", i)}
+				}
+				try(commentRepo.SaveAll(context.Background(), comments))
+
+				ids := map[int]bool{}
+				for _, c := range comments {
+					So(c.Version, ShouldEqual, 1)
+					ids[c.ID] = true
+				}
+				So(len(ids), ShouldEqual, len(comments))
+
+				n, err := commentRepo.Count(context.Background(), models.Where(models.Eq("PostID", p.ID)))
+				So(err, ShouldBeNil)
+				So(n, ShouldEqual, len(comments))
+
+				found, err := commentRepo.FindByID(context.Background(), comments[1234].ID)
+				So(err, ShouldBeNil)
+				So(found.Review, ShouldEqual, "review 1234")
+			})
+
+			Convey("Should insert in batches of the configured size", func() {
+				batchedCommentRepo := repositories.NewSqliteCommentRepository(db, repositories.WithBatchSize(7))
+				comments := make([]*models.Comment, 50)
+				for i := range comments {
+					comments[i] = &models.Comment{PostID: p.ID, Review: fmt.Sprintf("review %d", i)}
+				}
+				try(batchedCommentRepo.SaveAll(context.Background(), comments))
+
+				for _, c := range comments {
+					found, err := commentRepo.FindByID(context.Background(), c.ID)
+					So(err, ShouldBeNil)
+					So(found.Review, ShouldEqual, c.Review)
+				}
+			})
+
+			Convey("Should refuse to insert in batches a model with only an id", func() {
+				type idOnly struct {
+					ID int `db:"id"`
+				}
+				err := sqlstore.NewTable[idOnly, int](sqlstore.PostTable).InsertAll(context.Background(), db, []*idOnly{{}})
+				So(err, ShouldNotBeNil)
+			})
+
+			Convey("Should save nothing when one entity fails", func() {
+				stale := *p
+				p.Title = "first writer"
+				try(postRepo.Update(context.Background(), p))
+
+				fresh := &models.Post{ID: p.ID, Title: "second writer", Version: p.Version}
+				err := postRepo.SaveAll(context.Background(), []*models.Post{fresh, &stale, {Title: "new"}})
+				So(errors.Is(err, models.ErrStaleVersion), ShouldBeTrue)
+
+				posts, err := postRepo.FindAll(context.Background())
+				So(err, ShouldBeNil)
+				So(len(posts), ShouldEqual, 1)
+				So(posts[0].Title, ShouldEqual, "first writer")
+			})
+		})
+
+		Convey("Test soft delete", func() {
+			softPostRepo := repositories.NewSqlitePostRepository(db, repositories.WithSoftDelete())
+			softCommentRepo := repositories.NewSqliteCommentRepository(db, repositories.WithSoftDelete())
+
+			p := &models.Post{Title: "implement repository pattern in go"}
+			try(softPostRepo.Save(context.Background(), p))
+			c := &models.Comment{PostID: p.ID, Review: "yayy"}
+			try(softCommentRepo.Save(context.Background(), c))
+			try(softCommentRepo.Delete(context.Background(), c.ID))
+
+			Convey("Should hide deleted entities from the finders", func() {
+				_, err := softCommentRepo.FindByID(context.Background(), c.ID)
+				So(errors.Is(err, models.ErrNotFound), ShouldBeTrue)
+				comments, err := softCommentRepo.FindByPostID(context.Background(), p.ID)
+				So(err, ShouldBeNil)
+				So(len(comments), ShouldEqual, 0)
+				n, err := softCommentRepo.Count(context.Background(), models.All())
+				So(err, ShouldBeNil)
+				So(n, ShouldEqual, 0)
+				ok, err := softCommentRepo.Exists(context.Background(), c.ID)
+				So(err, ShouldBeNil)
+				So(ok, ShouldBeFalse)
+
+				err = softCommentRepo.Delete(context.Background(), c.ID)
+				So(errors.Is(err, models.ErrNotFound), ShouldBeTrue)
+				err = softCommentRepo.Update(context.Background(), c)
+				So(errors.Is(err, models.ErrNotFound), ShouldBeTrue)
+			})
+
+			Convey("Should still find deleted entities on request", func() {
+				comments, err := softCommentRepo.FindIncludingDeleted(context.Background(), models.Where(models.Eq("PostID", p.ID)))
+				So(err, ShouldBeNil)
+				So(len(comments), ShouldEqual, 1)
+				So(comments[0].DeletedAt, ShouldNotBeNil)
+
+				found, err := commentRepo.FindByID(context.Background(), c.ID)
+				So(err, ShouldBeNil)
+				So(found.DeletedAt, ShouldNotBeNil)
+			})
+
+			Convey("Should restore deleted entities", func() {
+				try(softCommentRepo.Restore(context.Background(), c.ID))
+				found, err := softCommentRepo.FindByID(context.Background(), c.ID)
+				So(err, ShouldBeNil)
+				So(found.DeletedAt, ShouldBeNil)
+
+				err = softCommentRepo.Restore(context.Background(), c.ID)
+				So(errors.Is(err, models.ErrNotFound), ShouldBeTrue)
+			})
+
+			Convey("Should only purge entities deleted long enough ago", func() {
+				n, err := softCommentRepo.Purge(context.Background(), time.Hour)
+				So(err, ShouldBeNil)
+				So(n, ShouldEqual, 0)
+
+				n, err = softCommentRepo.Purge(context.Background(), -time.Hour)
+				So(err, ShouldBeNil)
+				So(n, ShouldEqual, 1)
+				comments, err := softCommentRepo.FindIncludingDeleted(context.Background(), models.All())
+				So(err, ShouldBeNil)
+				So(len(comments), ShouldEqual, 0)
+			})
+
+			Convey("Should hide a post with its comments", func() {
+				try(softCommentRepo.Restore(context.Background(), c.ID))
+				try(softPostRepo.Delete(context.Background(), p.ID))
+				_, err := softPostRepo.FindByID(context.Background(), p.ID)
+				So(errors.Is(err, models.ErrNotFound), ShouldBeTrue)
+				try(softPostRepo.Restore(context.Background(), p.ID))
+
+				n, err := softPostRepo.DeleteCascade(context.Background(), p.ID)
+				So(err, ShouldBeNil)
+				So(n, ShouldEqual, 1)
+				comments, err := softCommentRepo.FindIncludingDeleted(context.Background(), models.Where(models.Eq("PostID", p.ID)))
+				So(err, ShouldBeNil)
+				So(len(comments), ShouldEqual, 1)
+				So(comments[0].DeletedAt, ShouldNotBeNil)
+			})
+		})
+
+		Convey("Test timestamps", func() {
+			start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+			now := start
+			clock := func() time.Time {
+				now = now.Add(time.Minute)
+				return now
+			}
+			tsPostRepo := repositories.NewSqlitePostRepository(db, repositories.WithClock(clock))
+
+			p := &models.Post{Title: "implement repository pattern in go"}
+			try(tsPostRepo.Save(context.Background(), p))
+
+			Convey("Should set CreatedAt and UpdatedAt on insert", func() {
+				So(p.CreatedAt.Equal(start.Add(time.Minute)), ShouldBeTrue)
+				So(p.UpdatedAt.Equal(p.CreatedAt), ShouldBeTrue)
+
+				found, err := tsPostRepo.FindByID(context.Background(), p.ID)
+				So(err, ShouldBeNil)
+				So(found.CreatedAt.Equal(p.CreatedAt), ShouldBeTrue)
+				So(found.UpdatedAt.Equal(p.UpdatedAt), ShouldBeTrue)
+			})
+
+			Convey("Should only move UpdatedAt on update", func() {
+				created := p.CreatedAt
+				p.Title = "implement repository pattern in go, again"
+				p.CreatedAt = time.Time{}
+				try(tsPostRepo.Update(context.Background(), p))
+				So(p.UpdatedAt.After(created), ShouldBeTrue)
+
+				found, err := tsPostRepo.FindByID(context.Background(), p.ID)
+				So(err, ShouldBeNil)
+				So(found.CreatedAt.Equal(created), ShouldBeTrue)
+				So(found.UpdatedAt.Equal(p.UpdatedAt), ShouldBeTrue)
+
+				found.CreatedAt = time.Time{}
+				try(tsPostRepo.Save(context.Background(), found))
+				found, err = tsPostRepo.FindByID(context.Background(), p.ID)
+				So(err, ShouldBeNil)
+				So(found.CreatedAt.Equal(created), ShouldBeTrue)
+				So(found.UpdatedAt.After(p.UpdatedAt), ShouldBeTrue)
+			})
+
+			Convey("Should stamp a cascaded soft delete with the clock", func() {
+				softPostRepo := repositories.NewSqlitePostRepository(db, repositories.WithSoftDelete(), repositories.WithClock(clock))
+				c := &models.Comment{PostID: p.ID, Review: "stamped by the clock"}
+				try(commentRepo.Save(context.Background(), c))
+				before := now
+
+				n, err := softPostRepo.DeleteCascade(context.Background(), p.ID)
+				So(err, ShouldBeNil)
+				So(n, ShouldEqual, 1)
+				found, err := commentRepo.FindByID(context.Background(), c.ID)
+				So(err, ShouldBeNil)
+				So(found.DeletedAt, ShouldNotBeNil)
+				So(found.DeletedAt.After(before) && !found.DeletedAt.After(now), ShouldBeTrue)
+				posts, err := softPostRepo.FindIncludingDeleted(context.Background(), models.Where(models.Eq("ID", p.ID)))
+				So(err, ShouldBeNil)
+				So(len(posts), ShouldEqual, 1)
+				So(posts[0].DeletedAt.After(before) && !posts[0].DeletedAt.After(now), ShouldBeTrue)
+			})
+
+			Convey("Should order by timestamps", func() {
+				p2 := &models.Post{Title: "second"}
+				p3 := &models.Post{Title: "third"}
+				try(tsPostRepo.Save(context.Background(), p2))
+				try(tsPostRepo.Save(context.Background(), p3))
+
+				posts, err := tsPostRepo.FindBy(context.Background(), models.All().OrderBy(models.Desc("CreatedAt")))
+				So(err, ShouldBeNil)
+				So(len(posts), ShouldEqual, 3)
+				So(posts[0].ID, ShouldEqual, p3.ID)
+				So(posts[2].ID, ShouldEqual, p.ID)
+
+				req := models.PageRequest{Limit: 2, OrderBy: models.Desc("CreatedAt")}
+				page, err := tsPostRepo.FindPage(context.Background(), req)
+				So(err, ShouldBeNil)
+				So(len(page.Items), ShouldEqual, 2)
+				So(page.Items[0].ID, ShouldEqual, p3.ID)
+				So(page.Items[1].ID, ShouldEqual, p2.ID)
+				So(page.HasMore, ShouldBeTrue)
+
+				req.Cursor = page.NextCursor
+				page, err = tsPostRepo.FindPage(context.Background(), req)
+				So(err, ShouldBeNil)
+				So(len(page.Items), ShouldEqual, 1)
+				So(page.Items[0].ID, ShouldEqual, p.ID)
+				So(page.HasMore, ShouldBeFalse)
+
+				_, err = tsPostRepo.FindPage(context.Background(), models.PageRequest{OrderBy: models.Asc("Missing")})
+				So(errors.Is(err, models.ErrInvalidSpec), ShouldBeTrue)
+			})
+		})
+
+		Convey("Test migrations", func() {
+			m, err := sqlstore.NewMigrator(db)
+			try(err)
+
+			Convey("Should be at the latest version", func() {
+				version, err := m.Version(context.Background())
+				So(err, ShouldBeNil)
+				So(version, ShouldEqual, m.Migrations[len(m.Migrations)-1].Version)
+
+				done, err := m.Up(context.Background())
+				So(err, ShouldBeNil)
+				So(len(done), ShouldEqual, 0)
+			})
+
+			Convey("Should only list the migrations on a dry run", func() {
+				m.DryRun = true
+				done, err := m.Down(context.Background(), 0)
+				So(err, ShouldBeNil)
+				So(len(done), ShouldEqual, len(m.Migrations))
+
+				_, err = postRepo.FindAll(context.Background())
+				So(err, ShouldBeNil)
+			})
+
+			Convey("Should migrate down and up again", func() {
+				done, err := m.Down(context.Background(), 0)
+				So(err, ShouldBeNil)
+				So(len(done), ShouldEqual, len(m.Migrations))
+				_, err = postRepo.FindAll(context.Background())
+				So(err, ShouldNotBeNil)
+				version, err := m.Version(context.Background())
+				So(err, ShouldBeNil)
+				So(version, ShouldEqual, 0)
+
+				done, err = m.Up(context.Background())
+				So(err, ShouldBeNil)
+				So(len(done), ShouldEqual, len(m.Migrations))
+				try(postRepo.Save(context.Background(), &models.Post{Title: "implement repository pattern in go"}))
+			})
+
+			Convey("Should baseline a schema created before migrations", func() {
+				_, err := m.Down(context.Background(), 0)
+				try(err)
+				_, err = db.Exec(`CREATE TABLE posts (id integer not null primary key autoincrement, title varchar(250) not null)`)
+				try(err)
+				_, err = db.Exec(`CREATE TABLE comments (id integer not null primary key autoincrement, post_id integer not null references posts(id), review varchar(250) not null)`)
+				try(err)
+				_, err = db.Exec(`INSERT INTO posts(title) VALUES ('implement repository pattern in go')`)
+				try(err)
+
+				So(sqlstore.Migrate(context.Background(), db), ShouldBeNil)
+				version, err := m.Version(context.Background())
+				So(err, ShouldBeNil)
+				So(version, ShouldEqual, m.Migrations[len(m.Migrations)-1].Version)
+				posts, err := postRepo.FindAll(context.Background())
+				So(err, ShouldBeNil)
+				So(len(posts), ShouldEqual, 1)
+				So(posts[0].Version, ShouldEqual, 1)
+				So(posts[0].CreatedAt.IsZero(), ShouldBeFalse)
+				try(postRepo.Save(context.Background(), posts[0]))
+			})
+
+			Convey("Should refuse to run after an applied migration changed", func() {
+				m.Migrations[0].Up += "\n-- changed"
+				_, err := m.Up(context.Background())
+				So(errors.Is(err, models.ErrChecksumMismatch), ShouldBeTrue)
+			})
+		})
+
+		Convey("Test tracing", func() {
+			exporter := &tracing.InMemoryExporter{}
+			tracedPostRepo := repositories.NewTracedPostRepository(postRepo, tracing.NewTracer(exporter))
+
+			try(tracedPostRepo.InTransaction(context.Background(), func(ctx context.Context) error {
+				if err := tracedPostRepo.Save(ctx, &models.Post{Title: "implement repository pattern in go"}); err != nil {
+					return err
+				}
+				_, err := tracedPostRepo.FindAll(ctx)
+				return err
+			}))
+			spans := exporter.Spans()
+			byName := map[string]tracing.SpanData{}
+			for _, span := range spans {
+				byName[span.Name] = span
+			}
+
+			Convey("Should record the statements as children of the operations", func() {
+				tx, save, findAll, sel := byName["posts.InTransaction"], byName["posts.Save"], byName["posts.FindAll"], byName["sql SELECT"]
+				So(save.ParentID, ShouldEqual, tx.SpanID)
+				So(findAll.ParentID, ShouldEqual, tx.SpanID)
+				So(sel.ParentID, ShouldEqual, findAll.SpanID)
+				So(sel.Attributes["db.system"], ShouldEqual, "sqlite")
+				So(sel.Attributes["db.statement"], ShouldContainSubstring, "FROM posts")
+				So(sel.Attributes["db.rows"], ShouldEqual, 1)
+
+				var statements int
+				for _, span := range spans {
+					if span.ParentID == save.SpanID {
+						So(span.Name, ShouldStartWith, "sql ")
+						So(span.TraceID, ShouldEqual, tx.TraceID)
+						statements++
+					}
+				}
+				So(statements, ShouldBeGreaterThan, 0)
+			})
+
+			Convey("Should annotate the operations with the backend and the table", func() {
+				So(byName["posts.FindAll"].Attributes, ShouldResemble, tracing.Attributes{"db.system": "sqlite", "db.table": "posts", "db.rows": int64(1)})
+			})
+		})
+
+		Convey("Test query logging", func() {
+			var buf bytes.Buffer
+			logger := &querylog.Logger{
+				Logger: slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug})),
+				Redact: querylog.RedactStrings,
+			}
+			loggedPostRepo := repositories.NewSqlitePostRepository(db, repositories.WithQueryLog(logger))
+			records := func() []map[string]interface{} {
+				var records []map[string]interface{}
+				for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+					record := map[string]interface{}{}
+					try(json.Unmarshal([]byte(line), &record))
+					records = append(records, record)
+				}
+				buf.Reset()
+				return records
+			}
+
+			Convey("Should log the statements with redacted arguments and their transaction", func() {
+				p := &models.Post{Title: "implement repository pattern in go"}
+				try(loggedPostRepo.InTransaction(context.Background(), func(ctx context.Context) error {
+					if err := loggedPostRepo.Save(ctx, p); err != nil {
+						return err
+					}
+					_, err := loggedPostRepo.FindAll(ctx)
+					return err
+				}))
+
+				logged := records()
+				So(len(logged), ShouldBeGreaterThanOrEqualTo, 2)
+				insert, selectAll := logged[0], logged[len(logged)-1]
+				So(insert["level"], ShouldEqual, "DEBUG")
+				So(insert["db.system"], ShouldEqual, "sqlite")
+				So(insert["statement"], ShouldContainSubstring, "INSERT INTO posts")
+				So(insert["args"], ShouldContain, querylog.Redacted)
+				So(fmt.Sprint(insert["args"]), ShouldNotContainSubstring, p.Title)
+				So(insert["rows"], ShouldEqual, 1)
+				So(insert["tx"], ShouldNotBeEmpty)
+				So(selectAll["statement"], ShouldStartWith, "SELECT * FROM posts")
+				So(selectAll["rows"], ShouldEqual, 1)
+				So(selectAll["tx"], ShouldEqual, insert["tx"])
+			})
+
+			Convey("Should not log a transaction outside of one, nor a miss as a failure", func() {
+				_, err := loggedPostRepo.FindByID(context.Background(), 42)
+				So(errors.Is(err, models.ErrNotFound), ShouldBeTrue)
+
+				logged := records()
+				So(logged, ShouldHaveLength, 1)
+				So(logged[0]["level"], ShouldEqual, "DEBUG")
+				So(logged[0]["args"], ShouldResemble, []interface{}{float64(42)})
+				So(logged[0]["rows"], ShouldEqual, 0)
+				So(logged[0], ShouldNotContainKey, "tx")
+			})
+
+			Convey("Should warn about slow and failed queries", func() {
+				logger.SlowThreshold = time.Nanosecond
+				_, err := loggedPostRepo.FindAll(context.Background())
+				try(err)
+				logger.SlowThreshold = 0
+				err = repositories.NewSqliteCommentRepository(db, repositories.WithQueryLog(logger)).Save(context.Background(), &models.Comment{PostID: 42, Review: "orphan"})
+				So(err, ShouldNotBeNil)
+
+				logged := records()
+				So(logged[0]["level"], ShouldEqual, "WARN")
+				So(logged[0]["msg"], ShouldEqual, "slow query")
+				So(logged[len(logged)-1]["level"], ShouldEqual, "WARN")
+				So(logged[len(logged)-1]["msg"], ShouldEqual, "query failed")
+				So(logged[len(logged)-1]["error"], ShouldContainSubstring, "FOREIGN KEY")
+			})
+		})
+
+		Convey("Test transaction retry", func() {
+			errTransient := errors.New("transient")
+			policy := repositories.RetryPolicy{
+				MaxAttempts: 3,
+				Backoff:     time.Millisecond,
+				Retryable:   func(err error) bool { return errors.Is(err, errTransient) },
+			}
+			retryingPostRepo := repositories.NewSqlitePostRepository(db, repositories.WithRetry(policy))
+
+			Convey("Should run fn again from scratch until it succeeds", func() {
+				attempts := 0
+				err := retryingPostRepo.InTransaction(context.Background(), func(ctx context.Context) error {
+					attempts++
+					if err := retryingPostRepo.Save(ctx, &models.Post{Title: fmt.Sprint("attempt ", attempts)}); err != nil {
+						return err
+					}
+					if attempts < 3 {
+						return errTransient
+					}
+					return nil
+				})
+				So(err, ShouldBeNil)
+				So(attempts, ShouldEqual, 3)
+
+				posts, err := postRepo.FindAll(context.Background())
+				try(err)
+				So(posts, ShouldHaveLength, 1)
+				So(posts[0].Title, ShouldEqual, "attempt 3")
+			})
+
+			Convey("Should give up after the last attempt", func() {
+				attempts := 0
+				err := retryingPostRepo.InTransaction(context.Background(), func(ctx context.Context) error {
+					attempts++
+					return errTransient
+				})
+				So(errors.Is(err, errTransient), ShouldBeTrue)
+				So(attempts, ShouldEqual, 3)
+			})
+
+			Convey("Should not retry other errors", func() {
+				attempts := 0
+				err := retryingPostRepo.InTransaction(context.Background(), func(ctx context.Context) error {
+					attempts++
+					return errors.New("permanent")
+				})
+				So(err, ShouldNotBeNil)
+				So(attempts, ShouldEqual, 1)
+			})
+
+			Convey("Should retry right away with a negative backoff", func() {
+				policy.Backoff = -time.Second
+				attempts := 0
+				err := repositories.NewSqlitePostRepository(db, repositories.WithRetry(policy)).InTransaction(context.Background(), func(ctx context.Context) error {
+					attempts++
+					return errTransient
+				})
+				So(errors.Is(err, errTransient), ShouldBeTrue)
+				So(attempts, ShouldEqual, 3)
+			})
+
+			Convey("Should not retry without a policy", func() {
+				attempts := 0
+				err := postRepo.InTransaction(context.Background(), func(ctx context.Context) error {
+					attempts++
+					return errTransient
+				})
+				So(errors.Is(err, errTransient), ShouldBeTrue)
+				So(attempts, ShouldEqual, 1)
+			})
+
+			Convey("Should classify a busy database as retryable", func() {
+				file, err := sqlx.Connect(sqlstore.SqliteDriver, t.TempDir()+"/busy.db")
+				try(err)
+				defer file.Close()
+				conn1, err := file.Conn(context.Background())
+				try(err)
+				defer conn1.Close()
+				conn2, err := file.Conn(context.Background())
+				try(err)
+				defer conn2.Close()
+
+				_, err = conn1.ExecContext(context.Background(), "BEGIN IMMEDIATE")
+				try(err)
+				_, err = conn2.ExecContext(context.Background(), "BEGIN IMMEDIATE")
+				So(err, ShouldNotBeNil)
+				So(sqlstore.SQLite.Retryable(err), ShouldBeTrue)
+				So(sqlstore.SQLite.Retryable(errTransient), ShouldBeFalse)
+			})
+		})
+
+		Convey("Test transaction options", func() {
+			Convey("Should commit with an isolation level", func() {
+				p := &models.Post{Title: "implement repository pattern in go"}
+				opts := models.TxOptions{Isolation: models.IsolationSerializable}
+				try(postRepo.InTransactionWithOptions(context.Background(), opts, func(ctx context.Context) error {
+					return postRepo.Save(ctx, p)
+				}))
+				_, err := postRepo.FindByID(context.Background(), p.ID)
+				So(err, ShouldBeNil)
+			})
+
+			Convey("Should roll back once the timeout elapsed", func() {
+				// a cancelled transaction can cost its connection, which an in memory database does not survive
+				file, err := sqlstore.ConnectSqlite(t.TempDir() + "/timeout.db")
+				try(err)
+				defer file.Close()
+				try(sqlstore.Migrate(context.Background(), file))
+				filePostRepo := repositories.NewSqlitePostRepository(file)
+
+				opts := models.TxOptions{Timeout: 20 * time.Millisecond}
+				err = filePostRepo.InTransactionWithOptions(context.Background(), opts, func(ctx context.Context) error {
+					if err := filePostRepo.Save(ctx, &models.Post{Title: "implement repository pattern in go"}); err != nil {
+						return err
+					}
+					<-ctx.Done()
+					return nil
+				})
+				So(err, ShouldNotBeNil)
+				n, err := filePostRepo.Count(context.Background(), models.All())
+				try(err)
+				So(n, ShouldEqual, 0)
+			})
+		})
+
+		Convey("Test error translation", func() {
+			_, findErr := postRepo.FindByID(context.Background(), 42)
+			saveErr := commentRepo.Save(context.Background(), &models.Comment{PostID: 42, Review: "orphan"})
+
+			Convey("Should return domain errors", func() {
+				So(errors.Is(findErr, models.ErrNotFound), ShouldBeTrue)
+				So(errors.Is(saveErr, models.ErrInvalidReference), ShouldBeTrue)
+			})
+		})
+	})
+}
@@ -0,0 +1,145 @@
+package sqlstore
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// DefaultBatchSize is the most rows InsertAll sends in a single statement unless told otherwise, see WithBatchSize.
+const DefaultBatchSize = 1000
+
+// maxParams is the lowest limit of bound parameters per statement among the supported engines (sqlite).
+const maxParams = 32766
+
+// SaveAll saves every m like Save, the ones with a zero id are inserted by InsertAll. It should run in a transaction
+// so a failure does not leave part of ms saved.
+func (t *Table[T, ID]) SaveAll(ctx context.Context, db SqlxDatabase, ms []*T) error {
+	var inserts []*T
+	for _, m := range ms {
+		if t.id(m).IsZero() {
+			inserts = append(inserts, m)
+			continue
+		}
+		if err := t.Save(ctx, db, m); err != nil {
+			return err
+		}
+	}
+	return t.InsertAll(ctx, db, inserts)
+}
+
+// WithBatchSize returns a copy of t whose InsertAll sends at most size rows per statement, DefaultBatchSize when size
+// is not positive.
+func (t *Table[T, ID]) WithBatchSize(size int) *Table[T, ID] {
+	c := *t
+	c.batchSize = size
+	return &c
+}
+
+// InsertAll inserts ms, whose ids must all be zero, with multi-row INSERTs of at most WithBatchSize rows and sets the
+// generated ids back onto them. On engines without RETURNING the rows go one at a time through a prepared statement,
+// the ids a multi-row insert generates there are not always consecutive. On a versioned table every m starts at
+// version 1.
+func (t *Table[T, ID]) InsertAll(ctx context.Context, db SqlxDatabase, ms []*T) error {
+	if len(t.columns) == 0 {
+		return fmt.Errorf("sqlstore: InsertAll needs a column besides %s in %s", idColumn, t.Name)
+	}
+	size := t.batchSize
+	if size <= 0 {
+		size = DefaultBatchSize
+	}
+	if n := maxParams / len(t.columns); size > n {
+		size = n
+	}
+	for start := 0; start < len(ms); start += size {
+		end := start + size
+		if end > len(ms) {
+			end = len(ms)
+		}
+		if err := t.insertBatch(ctx, db, ms[start:end]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (t *Table[T, ID]) insertBatch(ctx context.Context, db SqlxDatabase, ms []*T) error {
+	now := t.clock()
+	for _, m := range ms {
+		if !t.id(m).IsZero() || !t.id(m).CanInt() {
+			return fmt.Errorf("sqlstore: InsertAll needs generated int ids, %s has id %v", t.Name, t.id(m).Interface())
+		}
+		t.stamp(m, now)
+	}
+	if t.version >= 0 {
+		olds := make([]int64, len(ms))
+		for i, m := range ms {
+			v := reflect.ValueOf(m).Elem().Field(t.fields[t.version])
+			olds[i] = v.Int()
+			v.SetInt(1)
+		}
+		if err := t.insertRows(ctx, db, ms); err != nil {
+			for i, m := range ms {
+				reflect.ValueOf(m).Elem().Field(t.fields[t.version]).SetInt(olds[i])
+			}
+			return err
+		}
+		return nil
+	}
+	return t.insertRows(ctx, db, ms)
+}
+
+func (t *Table[T, ID]) insertRows(ctx context.Context, db SqlxDatabase, ms []*T) error {
+	d := DialectOf(db)
+	returning := d.Returning(idColumn)
+	if returning == "" {
+		return t.insertEach(ctx, db, ms)
+	}
+
+	rows := make([]string, len(ms))
+	var args []interface{}
+	for i, m := range ms {
+		rows[i] = `(` + placeholders(d, len(args)+1, len(t.columns)) + `)`
+		args = append(args, t.values(m)...)
+	}
+	sql := `INSERT INTO ` + t.Name + `(` + strings.Join(t.columns, ", ") + `) VALUES ` + strings.Join(rows, ", ")
+
+	// a single statement allocates its ids in the order of its rows, whatever the order they are returned in
+	var ids []int64
+	if err := db.SelectContext(ctx, &ids, sql+` `+returning, args...); err != nil {
+		return translateError(db, err)
+	}
+	if len(ids) != len(ms) {
+		return fmt.Errorf("sqlstore: inserted %d rows into %s but got %d ids", len(ms), t.Name, len(ids))
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	for i, m := range ms {
+		t.id(m).SetInt(ids[i])
+	}
+	return nil
+}
+
+// insertEach inserts ms one row at a time and reads every id from LastInsertId, for engines without RETURNING.
+func (t *Table[T, ID]) insertEach(ctx context.Context, db SqlxDatabase, ms []*T) error {
+	d := DialectOf(db)
+	sql := `INSERT INTO ` + t.Name + `(` + strings.Join(t.columns, ", ") + `) VALUES (` + placeholders(d, 1, len(t.columns)) + `)`
+	stmt, err := db.PreparexContext(ctx, sql)
+	if err != nil {
+		return translateError(db, err)
+	}
+	defer stmt.Close()
+	for _, m := range ms {
+		res, err := stmt.ExecContext(ctx, t.values(m)...)
+		if err != nil {
+			return translateError(db, err)
+		}
+		id, err := res.LastInsertId()
+		if err != nil {
+			return err
+		}
+		t.id(m).SetInt(id)
+	}
+	return nil
+}
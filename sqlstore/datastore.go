@@ -12,26 +12,19 @@ const (
 	CommentTable = "comments"
 )
 
+// Deprecated: use Migrator.Down, DropTables ignores every error. The tables are dropped even when no migration
+// recorded them.
 func DropTables(db *sqlx.DB) {
-	db.Exec(`DROP TABLE ` + CommentTable)
-	db.Exec(`DROP TABLE ` + PostTable)
-
-	//_, err := db.Exec(`DROP TABLE ` + sqlstore.CommentTable)
-	//try(err)
-	//_, err = db.Exec(`DROP TABLE ` + sqlstore.PostTable)
-	//try(err)
+	if m, err := NewMigrator(db); err == nil {
+		m.Down(context.Background(), 0)
+	}
+	db.Exec(`DROP TABLE IF EXISTS ` + CommentTable)
+	db.Exec(`DROP TABLE IF EXISTS ` + PostTable)
 }
 
+// Deprecated: use Migrate, CreateTables ignores every error.
 func CreateTables(db *sqlx.DB) {
-	db.Exec(`CREATE TABLE ` + PostTable + `(
-		id serial not null primary key,
-    	title varchar(250) not null
-	)`)
-	db.Exec(`CREATE TABLE ` + CommentTable + `(
-		id serial not null primary key,
-		post_id integer not null references posts(id),
-		review varchar(250) not null
-	)`)
+	Migrate(context.Background(), db)
 }
 
 type SqlxDatabase interface {
@@ -39,45 +32,54 @@ type SqlxDatabase interface {
 	PreparexContext(ctx context.Context, query string) (*sqlx.Stmt, error)
 	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
 	SelectContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error
+	DriverName() string
 }
 
-func FindPostByID(ctx context.Context, db SqlxDatabase, id int) (*models.Post, error) {
-	p := new(models.Post)
-	sql := `SELECT * FROM ` + PostTable + ` WHERE id=$1`
-	err := db.GetContext(ctx, p, sql, id)
+var (
+	Posts    = NewTable[models.Post, int](PostTable)
+	Comments = NewTable[models.Comment, int](CommentTable)
+)
 
-	return p, err
+func FindPostByID(ctx context.Context, db SqlxDatabase, id int) (*models.Post, error) {
+	return Posts.FindByID(ctx, db, id)
 }
 
 func SavePost(ctx context.Context, db SqlxDatabase, p *models.Post) error {
-	sql := `INSERT INTO ` + PostTable + `(title) VALUES ($1) ON CONFLICT(id) DO UPDATE SET title=EXCLUDED.title RETURNING id`
-	var lastId int
-	stmt, err := db.PreparexContext(ctx, sql)
+	return Posts.Save(ctx, db, p)
+}
+
+// DeletePost fails with models.ErrInvalidReference while the post still has comments, enforced by the foreign key.
+func DeletePost(ctx context.Context, db SqlxDatabase, id int) error {
+	return Posts.Delete(ctx, db, id)
+}
+
+// DeletePostCascade deletes the comments of the post then the post itself, returning how many comments were deleted.
+// It must run in a transaction to be atomic.
+func DeletePostCascade(ctx context.Context, db SqlxDatabase, id int) (int64, error) {
+	return DeletePostCascadeFrom(ctx, db, Posts, Comments, id)
+}
+
+// DeletePostCascadeFrom is DeletePostCascade on posts and comments, which soft delete and stamp the time as they are
+// configured, see SoftDelete and WithClock.
+func DeletePostCascadeFrom(ctx context.Context, db SqlxDatabase, posts *Table[models.Post, int], comments *Table[models.Comment, int], id int) (int64, error) {
+	n, err := comments.DeleteBy(ctx, db, models.Where(models.Eq("PostID", id)))
 	if err != nil {
-		return err
+		return 0, err
+	}
+	if err := posts.Delete(ctx, db, id); err != nil {
+		return 0, err
 	}
-	stmt.GetContext(ctx, &lastId, p.Title)
-	p.ID = lastId
-	return err
+	return n, nil
 }
 
 func FindCommentsByPostID(ctx context.Context, db SqlxDatabase, postID int) ([]*models.Comment, error) {
-	var comments []*models.Comment
-	sql := `SELECT * FROM ` + CommentTable + ` WHERE post_id=$1`
-	err := db.SelectContext(ctx, &comments, sql, postID)
-	return comments, err
+	return Comments.FindBy(ctx, db, "post_id", postID)
+}
+
+func FindCommentPageByPostID(ctx context.Context, db SqlxDatabase, postID int, req models.PageRequest) (*models.Page[models.Comment], error) {
+	return Comments.FindPageBy(ctx, db, models.Where(models.Eq("PostID", postID)), req)
 }
 
 func SaveComment(ctx context.Context, db SqlxDatabase, c *models.Comment) error {
-	sql := `INSERT INTO ` + CommentTable + `(review, post_id) VALUES($1, $2) ON CONFLICT(id)
-			DO UPDATE SET review=EXCLUDED.review, post_id=EXCLUDED.post_id
-			RETURNING id`
-	var lastId int
-	stmt, err := db.PreparexContext(ctx, sql)
-	if err != nil {
-		return err
-	}
-	stmt.GetContext(ctx, &lastId, c.Review, c.PostID)
-	c.ID = lastId
-	return err
+	return Comments.Save(ctx, db, c)
 }
@@ -0,0 +1,240 @@
+package sqlstore
+
+import (
+	"errors"
+	"github.com/hendratommy/repository-pattern/models"
+	"github.com/lib/pq"
+	"hash/fnv"
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Dialect hides the syntax differences between sql engines, every query built by sqlstore goes through the dialect
+// of the driver the database was opened with.
+type Dialect interface {
+	Name() string
+	// Placeholder returns the bind variable of the n-th (1 based) argument of a query.
+	Placeholder(n int) string
+	// Upsert returns the clause appended to an INSERT so a row with an existing id is updated with columns instead.
+	Upsert(idColumn string, columns []string) string
+	// Returning returns the clause making an INSERT return the generated id, empty when the engine has none, in which
+	// case the id is read from sql.Result.LastInsertId.
+	Returning(idColumn string) string
+	// AutoIncrement returns the column definition of an auto generated integer primary key.
+	AutoIncrement() string
+	// Timestamp returns the column type of a point in time.
+	Timestamp() string
+	// SyncSequence returns the statement moving the generator of an auto increment key past the ids inserted
+	// explicitly, never backwards, empty when the engine already does it.
+	SyncSequence(table, idColumn string) string
+	// AdvisoryLock returns the statements taking and releasing the session lock named name, empty when the engine
+	// has none. Taking the lock waits until it is free.
+	AdvisoryLock(name string) (lock, unlock string)
+	// TranslateError maps constraint violations of the engine onto models.ErrConflict, models.ErrInvalidReference or
+	// models.ErrInvalidEntity, any other error is returned as is.
+	TranslateError(err error) error
+	// Retryable reports whether err is a transient failure of a transaction, like a serialization failure or a
+	// deadlock, which running the transaction again may not hit.
+	Retryable(err error) bool
+}
+
+type postgresDialect struct{}
+
+func (postgresDialect) Name() string { return "postgres" }
+
+func (postgresDialect) Placeholder(n int) string { return "$" + strconv.Itoa(n) }
+
+func (postgresDialect) Upsert(idColumn string, columns []string) string {
+	return `ON CONFLICT(` + idColumn + `) DO UPDATE SET ` + assignments(columns, "EXCLUDED.%s")
+}
+
+func (postgresDialect) Returning(idColumn string) string { return `RETURNING ` + idColumn }
+
+func (postgresDialect) AutoIncrement() string { return `serial not null primary key` }
+
+func (postgresDialect) Timestamp() string { return `timestamptz` }
+
+// SyncSequence only ever moves the sequence forward, past the highest id the transaction sees. Ids handed out to
+// transactions still running, or freed by deletes, stay behind it.
+func (postgresDialect) SyncSequence(table, idColumn string) string {
+	return `SELECT setval(s.seq, s.max_id) FROM (
+			SELECT pg_get_serial_sequence('` + table + `', '` + idColumn + `')::regclass AS seq, MAX(` + idColumn + `) AS max_id FROM ` + table + `
+		) s WHERE s.max_id > COALESCE(pg_sequence_last_value(s.seq), 0)`
+}
+
+func (postgresDialect) AdvisoryLock(name string) (string, string) {
+	key := strconv.FormatInt(lockKey(name), 10)
+	return `SELECT pg_advisory_lock(` + key + `)`, `SELECT pg_advisory_unlock(` + key + `)`
+}
+
+func (postgresDialect) TranslateError(err error) error {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		switch pqErr.Code {
+		case "23505": // unique_violation
+			return wrapError(models.ErrConflict, err)
+		case "23503": // foreign_key_violation
+			return wrapError(models.ErrInvalidReference, err)
+		case "23502", "23514", "22001": // not_null_violation, check_violation, string_data_right_truncation
+			return wrapError(models.ErrInvalidEntity, err)
+		}
+	}
+	return err
+}
+
+func (postgresDialect) Retryable(err error) bool {
+	var pqErr *pq.Error
+	// serialization_failure, deadlock_detected
+	return errors.As(err, &pqErr) && (pqErr.Code == "40001" || pqErr.Code == "40P01")
+}
+
+type sqliteDialect struct{}
+
+func (sqliteDialect) Name() string { return "sqlite" }
+
+func (sqliteDialect) Placeholder(int) string { return "?" }
+
+func (sqliteDialect) Upsert(idColumn string, columns []string) string {
+	return `ON CONFLICT(` + idColumn + `) DO UPDATE SET ` + assignments(columns, "excluded.%s")
+}
+
+func (sqliteDialect) Returning(idColumn string) string { return `RETURNING ` + idColumn }
+
+func (sqliteDialect) AutoIncrement() string { return `integer not null primary key autoincrement` }
+
+func (sqliteDialect) Timestamp() string { return `timestamp` }
+
+func (sqliteDialect) SyncSequence(string, string) string { return "" }
+
+// AdvisoryLock has nothing to return, a sqlite database has a single writer at a time anyway.
+func (sqliteDialect) AdvisoryLock(string) (string, string) { return "", "" }
+
+func (sqliteDialect) TranslateError(err error) error {
+	var sqliteErr *sqlite.Error
+	if errors.As(err, &sqliteErr) {
+		switch sqliteErr.Code() {
+		case sqlite3.SQLITE_CONSTRAINT_PRIMARYKEY, sqlite3.SQLITE_CONSTRAINT_UNIQUE:
+			return wrapError(models.ErrConflict, err)
+		case sqlite3.SQLITE_CONSTRAINT_FOREIGNKEY:
+			return wrapError(models.ErrInvalidReference, err)
+		case sqlite3.SQLITE_CONSTRAINT_NOTNULL, sqlite3.SQLITE_CONSTRAINT_CHECK:
+			return wrapError(models.ErrInvalidEntity, err)
+		}
+	}
+	return err
+}
+
+// Retryable matches a database busy with, or locked by, another connection past the busy timeout.
+func (sqliteDialect) Retryable(err error) bool {
+	var sqliteErr *sqlite.Error
+	if !errors.As(err, &sqliteErr) {
+		return false
+	}
+	code := sqliteErr.Code() & 0xff // primary result code of an extended one
+	return code == sqlite3.SQLITE_BUSY || code == sqlite3.SQLITE_LOCKED
+}
+
+type mysqlDialect struct{}
+
+func (mysqlDialect) Name() string { return "mysql" }
+
+func (mysqlDialect) Placeholder(int) string { return "?" }
+
+// Upsert re-assigns the id through LAST_INSERT_ID so LastInsertId reports the updated row instead of 0.
+func (mysqlDialect) Upsert(idColumn string, columns []string) string {
+	return `ON DUPLICATE KEY UPDATE ` + idColumn + `=LAST_INSERT_ID(` + idColumn + `), ` +
+		assignments(columns, "VALUES(%s)")
+}
+
+func (mysqlDialect) Returning(string) string { return "" }
+
+func (mysqlDialect) AutoIncrement() string { return `integer not null auto_increment primary key` }
+
+func (mysqlDialect) Timestamp() string { return `datetime(6)` }
+
+func (mysqlDialect) SyncSequence(string, string) string { return "" }
+
+func (mysqlDialect) AdvisoryLock(name string) (string, string) {
+	return `SELECT GET_LOCK('` + name + `', -1)`, `SELECT RELEASE_LOCK('` + name + `')`
+}
+
+// TranslateError reads the error number from the message, so the mysql driver does not have to be a dependency.
+func (mysqlDialect) TranslateError(err error) error {
+	msg := err.Error()
+	switch {
+	case strings.HasPrefix(msg, "Error 1062"): // ER_DUP_ENTRY
+		return wrapError(models.ErrConflict, err)
+	case strings.HasPrefix(msg, "Error 1451"), strings.HasPrefix(msg, "Error 1452"): // ER_ROW_IS_REFERENCED_2, ER_NO_REFERENCED_ROW_2
+		return wrapError(models.ErrInvalidReference, err)
+	case strings.HasPrefix(msg, "Error 1048"), strings.HasPrefix(msg, "Error 1406"): // ER_BAD_NULL_ERROR, ER_DATA_TOO_LONG
+		return wrapError(models.ErrInvalidEntity, err)
+	}
+	return err
+}
+
+func (mysqlDialect) Retryable(err error) bool {
+	msg := err.Error()
+	return strings.HasPrefix(msg, "Error 1213") || strings.HasPrefix(msg, "Error 1205") // ER_LOCK_DEADLOCK, ER_LOCK_WAIT_TIMEOUT
+}
+
+var (
+	Postgres Dialect = postgresDialect{}
+	SQLite   Dialect = sqliteDialect{}
+	MySQL    Dialect = mysqlDialect{}
+)
+
+var (
+	dialectsMu sync.RWMutex
+	dialects   = map[string]Dialect{
+		"postgres":   Postgres,
+		"pgx":        Postgres,
+		SqliteDriver: SQLite,
+		"sqlite3":    SQLite,
+		"mysql":      MySQL,
+	}
+)
+
+// RegisterDialect makes d the dialect of every database opened with driverName.
+func RegisterDialect(driverName string, d Dialect) {
+	dialectsMu.Lock()
+	defer dialectsMu.Unlock()
+	dialects[driverName] = d
+}
+
+// DialectOf returns the dialect of the driver db was opened with, Postgres when the driver is unknown.
+func DialectOf(db SqlxDatabase) Dialect {
+	dialectsMu.RLock()
+	defer dialectsMu.RUnlock()
+	if d, ok := dialects[db.DriverName()]; ok {
+		return d
+	}
+	return Postgres
+}
+
+// lockKey hashes name into the integer key of a postgres advisory lock.
+func lockKey(name string) int64 {
+	h := fnv.New64a()
+	h.Write([]byte(name))
+	return int64(h.Sum64())
+}
+
+// placeholders returns n comma separated bind variables numbered from first.
+func placeholders(d Dialect, first, n int) string {
+	s := make([]string, n)
+	for i := range s {
+		s[i] = d.Placeholder(first + i)
+	}
+	return strings.Join(s, ", ")
+}
+
+// assignments returns "col=value" pairs of columns, value being a format with a single %s replaced by the column.
+func assignments(columns []string, value string) string {
+	s := make([]string, len(columns))
+	for i, col := range columns {
+		s[i] = col + `=` + strings.ReplaceAll(value, "%s", col)
+	}
+	return strings.Join(s, ", ")
+}
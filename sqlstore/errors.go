@@ -0,0 +1,23 @@
+package sqlstore
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/hendratommy/repository-pattern/models"
+)
+
+// wrapError makes err match the domain error with errors.Is while keeping the driver error reachable.
+func wrapError(domain error, err error) error {
+	return fmt.Errorf("%w: %w", domain, err)
+}
+
+func translateError(db SqlxDatabase, err error) error {
+	if err == nil {
+		return nil
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		return wrapError(models.ErrNotFound, err)
+	}
+	return DialectOf(db).TranslateError(err)
+}
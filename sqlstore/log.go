@@ -0,0 +1,79 @@
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/hendratommy/repository-pattern/querylog"
+	"github.com/jmoiron/sqlx"
+	"reflect"
+	"time"
+)
+
+// Logged returns db logging every statement to l, with its arguments, duration, rows and the transaction id carried
+// by the ctx of the call, see querylog.WithTxID.
+func Logged(db SqlxDatabase, l *querylog.Logger) SqlxDatabase {
+	return loggedDatabase{SqlxDatabase: db, log: l}
+}
+
+type loggedDatabase struct {
+	SqlxDatabase
+	log *querylog.Logger
+}
+
+func (db loggedDatabase) logQuery(ctx context.Context, start time.Time, query string, args []interface{}, rows int64, err error) {
+	db.log.Log(ctx, querylog.Query{
+		System:    DialectOf(db.SqlxDatabase).Name(),
+		Statement: query,
+		Args:      args,
+		Duration:  time.Since(start),
+		Rows:      rows,
+		Err:       err,
+	})
+}
+
+func (db loggedDatabase) GetContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error {
+	start := time.Now()
+	err := db.SqlxDatabase.GetContext(ctx, dest, query, args...)
+	switch {
+	case err == nil:
+		db.logQuery(ctx, start, query, args, 1, nil)
+	case errors.Is(err, sql.ErrNoRows): // a miss, not a failure of the query
+		db.logQuery(ctx, start, query, args, 0, nil)
+	default:
+		db.logQuery(ctx, start, query, args, -1, err)
+	}
+	return err
+}
+
+func (db loggedDatabase) SelectContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error {
+	start := time.Now()
+	err := db.SqlxDatabase.SelectContext(ctx, dest, query, args...)
+	rows := int64(-1)
+	if err == nil {
+		rows = int64(reflect.Indirect(reflect.ValueOf(dest)).Len())
+	}
+	db.logQuery(ctx, start, query, args, rows, err)
+	return err
+}
+
+func (db loggedDatabase) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	start := time.Now()
+	res, err := db.SqlxDatabase.ExecContext(ctx, query, args...)
+	rows := int64(-1)
+	if err == nil {
+		if n, err := res.RowsAffected(); err == nil {
+			rows = n
+		}
+	}
+	db.logQuery(ctx, start, query, args, rows, err)
+	return res, err
+}
+
+// PreparexContext only logs the preparation, not the executions of the statement.
+func (db loggedDatabase) PreparexContext(ctx context.Context, query string) (*sqlx.Stmt, error) {
+	start := time.Now()
+	stmt, err := db.SqlxDatabase.PreparexContext(ctx, query)
+	db.logQuery(ctx, start, query, nil, -1, err)
+	return stmt, err
+}
@@ -0,0 +1,342 @@
+package sqlstore
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"embed"
+	"encoding/hex"
+	"fmt"
+	"github.com/hendratommy/repository-pattern/models"
+	"github.com/jmoiron/sqlx"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MigrationTable records the version, name and checksum of every migration applied to a database.
+const MigrationTable = "schema_migrations"
+
+// migrationLock names the advisory lock serialising migrators of the same database.
+const migrationLock = "sqlstore_migrations"
+
+//go:embed migrations
+var migrationFiles embed.FS
+
+var migrationFile = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+// Migration moves the schema from the previous version to Version with Up, and back with Down. The statements of a
+// script are separated by a semicolon ending a line.
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// Checksum identifies the Up script of m, an applied migration whose script changed since no longer matches it.
+func (m Migration) Checksum() string {
+	sum := sha256.Sum256([]byte(m.Up))
+	return hex.EncodeToString(sum[:])
+}
+
+func (m Migration) String() string {
+	return fmt.Sprintf("%d_%s", m.Version, m.Name)
+}
+
+// LoadMigrations reads the migrations of dir in fsys ordered by version, each made of a <version>_<name>.up.sql file
+// and an optional <version>_<name>.down.sql one. Other files are ignored.
+func LoadMigrations(fsys fs.FS, dir string) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+	byVersion := map[int]*Migration{}
+	for _, e := range entries {
+		match := migrationFile.FindStringSubmatch(e.Name())
+		if e.IsDir() || match == nil {
+			continue
+		}
+		b, err := fs.ReadFile(fsys, path.Join(dir, e.Name()))
+		if err != nil {
+			return nil, err
+		}
+		version, _ := strconv.Atoi(match[1])
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = m
+		}
+		if m.Name != match[2] {
+			return nil, fmt.Errorf("sqlstore: migration %d is named both %s and %s", version, m.Name, match[2])
+		}
+		if match[3] == "up" {
+			m.Up = string(b)
+		} else {
+			m.Down = string(b)
+		}
+	}
+
+	ms := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" {
+			return nil, fmt.Errorf("sqlstore: migration %s has no up script", m)
+		}
+		ms = append(ms, *m)
+	}
+	sort.Slice(ms, func(i, j int) bool { return ms[i].Version < ms[j].Version })
+	return ms, nil
+}
+
+// Migrations returns the migrations of the Posts and Comments schema written for d, there is a set for each of
+// Postgres, SQLite and MySQL.
+func Migrations(d Dialect) ([]Migration, error) {
+	return LoadMigrations(migrationFiles, "migrations/"+d.Name())
+}
+
+// Migrator applies Migrations to DB and records them in MigrationTable. Migrators of the same database wait for each
+// other on an advisory lock. Every migration runs in its own transaction, which only makes it atomic on engines with
+// transactional DDL, mysql commits each DDL statement.
+type Migrator struct {
+	DB         *sqlx.DB
+	Migrations []Migration
+	// DryRun makes Up and Down return the migrations they would run without running them, MigrationTable is still
+	// created when missing.
+	DryRun bool
+}
+
+// NewMigrator creates a Migrator of the Posts and Comments schema for the dialect of db.
+func NewMigrator(db *sqlx.DB) (*Migrator, error) {
+	ms, err := Migrations(DialectOf(db))
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{DB: db, Migrations: ms}, nil
+}
+
+// Migrate brings db up to the latest version of the Posts and Comments schema. A database whose posts table was
+// created before migrations, by CreateTables, has the schema of migration 1 and is marked as such with Baseline first.
+func Migrate(ctx context.Context, db *sqlx.DB) error {
+	m, err := NewMigrator(db)
+	if err != nil {
+		return err
+	}
+	version, err := m.Version(ctx)
+	if err != nil {
+		return err
+	}
+	if version == 0 && tableExists(ctx, db, PostTable) {
+		if _, err := m.Baseline(ctx, 1); err != nil {
+			return err
+		}
+	}
+	_, err = m.Up(ctx)
+	return err
+}
+
+func tableExists(ctx context.Context, db *sqlx.DB, table string) bool {
+	_, err := db.ExecContext(ctx, `SELECT 1 FROM `+table+` WHERE 1 = 0`)
+	return err == nil
+}
+
+// Version returns the highest version applied to the database, 0 when there is none.
+func (m *Migrator) Version(ctx context.Context) (int, error) {
+	var version int
+	err := m.run(ctx, func(_ *sql.Conn, applied map[int]string) error {
+		for v := range applied {
+			if v > version {
+				version = v
+			}
+		}
+		return nil
+	})
+	return version, err
+}
+
+// Up applies the migrations not applied yet in version order and returns them. It fails with
+// models.ErrChecksumMismatch, before running anything, when an applied migration was changed since.
+func (m *Migrator) Up(ctx context.Context) ([]Migration, error) {
+	var done []Migration
+	err := m.run(ctx, func(conn *sql.Conn, applied map[int]string) error {
+		for _, mg := range m.Migrations {
+			if _, ok := applied[mg.Version]; ok {
+				continue
+			}
+			if !m.DryRun {
+				if err := m.apply(ctx, conn, mg, true, true); err != nil {
+					return err
+				}
+			}
+			done = append(done, mg)
+		}
+		return nil
+	})
+	return done, err
+}
+
+// Baseline records the migrations up to version as applied without running them and returns them, for a database
+// whose schema was created by other means. Up then only runs the migrations above version.
+func (m *Migrator) Baseline(ctx context.Context, version int) ([]Migration, error) {
+	var done []Migration
+	err := m.run(ctx, func(conn *sql.Conn, applied map[int]string) error {
+		for _, mg := range m.Migrations {
+			if _, ok := applied[mg.Version]; ok || mg.Version > version {
+				continue
+			}
+			if !m.DryRun {
+				if err := m.apply(ctx, conn, mg, true, false); err != nil {
+					return err
+				}
+			}
+			done = append(done, mg)
+		}
+		return nil
+	})
+	return done, err
+}
+
+// Down reverts the applied migrations above version to, latest first, and returns them. Down to 0 reverts them all.
+func (m *Migrator) Down(ctx context.Context, to int) ([]Migration, error) {
+	var done []Migration
+	err := m.run(ctx, func(conn *sql.Conn, applied map[int]string) error {
+		var versions []int
+		for v := range applied {
+			if v > to {
+				versions = append(versions, v)
+			}
+		}
+		sort.Sort(sort.Reverse(sort.IntSlice(versions)))
+		for _, v := range versions {
+			mg, ok := m.migration(v)
+			if !ok {
+				return fmt.Errorf("sqlstore: applied migration %d is unknown", v)
+			}
+			if mg.Down == "" {
+				return fmt.Errorf("sqlstore: migration %s has no down script", mg)
+			}
+			if !m.DryRun {
+				if err := m.apply(ctx, conn, mg, false, true); err != nil {
+					return err
+				}
+			}
+			done = append(done, mg)
+		}
+		return nil
+	})
+	return done, err
+}
+
+func (m *Migrator) migration(version int) (Migration, bool) {
+	for _, mg := range m.Migrations {
+		if mg.Version == version {
+			return mg, true
+		}
+	}
+	return Migration{}, false
+}
+
+// run calls fn holding the migration lock with the checksums of the applied migrations by version, after checking
+// them against Migrations.
+func (m *Migrator) run(ctx context.Context, fn func(conn *sql.Conn, applied map[int]string) error) (err error) {
+	d := DialectOf(m.DB)
+	// the lock belongs to a session, so everything runs on the connection holding it
+	conn, err := m.DB.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if lock, unlock := d.AdvisoryLock(migrationLock); lock != "" {
+		if _, err := conn.ExecContext(ctx, lock); err != nil {
+			return err
+		}
+		defer func() {
+			if _, unlockErr := conn.ExecContext(context.Background(), unlock); err == nil {
+				err = unlockErr
+			}
+		}()
+	}
+
+	_, err = conn.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS `+MigrationTable+`(
+		version integer not null primary key,
+		name varchar(250) not null,
+		checksum varchar(64) not null,
+		applied_at `+d.Timestamp()+` not null
+	)`)
+	if err != nil {
+		return err
+	}
+	rows, err := conn.QueryContext(ctx, `SELECT version, checksum FROM `+MigrationTable)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	applied := map[int]string{}
+	for rows.Next() {
+		var version int
+		var checksum string
+		if err := rows.Scan(&version, &checksum); err != nil {
+			return err
+		}
+		applied[version] = checksum
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	rows.Close()
+
+	for version, checksum := range applied {
+		if mg, ok := m.migration(version); ok && mg.Checksum() != checksum {
+			return fmt.Errorf("%w: %s", models.ErrChecksumMismatch, mg)
+		}
+	}
+	return fn(conn, applied)
+}
+
+// apply runs the up or down script of mg in a transaction along with its bookkeeping in MigrationTable, only the
+// bookkeeping when script is false. The bookkeeping goes first, so a concurrent migrator without lock fails with
+// models.ErrConflict before any script runs.
+func (m *Migrator) apply(ctx context.Context, conn *sql.Conn, mg Migration, up, script bool) error {
+	d := DialectOf(m.DB)
+	stmts := mg.Down
+	record := `DELETE FROM ` + MigrationTable + ` WHERE version = ` + d.Placeholder(1)
+	args := []interface{}{mg.Version}
+	if up {
+		stmts = mg.Up
+		record = `INSERT INTO ` + MigrationTable + `(version, name, checksum, applied_at) VALUES (` + placeholders(d, 1, 4) + `)`
+		args = []interface{}{mg.Version, mg.Name, mg.Checksum(), time.Now().UTC()}
+	}
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, record, args...); err != nil {
+		tx.Rollback()
+		return fmt.Errorf("sqlstore: migration %s: %w", mg, d.TranslateError(err))
+	}
+	if !script {
+		stmts = ""
+	}
+	for _, stmt := range statements(stmts) {
+		if _, err := tx.ExecContext(ctx, stmt); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("sqlstore: migration %s: %w", mg, err)
+		}
+	}
+	return tx.Commit()
+}
+
+// statements splits script on the semicolons ending a line.
+func statements(script string) []string {
+	var stmts []string
+	for _, s := range strings.Split(strings.ReplaceAll(script, "\r\n", "\n"), ";\n") {
+		if s = strings.TrimSuffix(strings.TrimSpace(s), ";"); s != "" {
+			stmts = append(stmts, s)
+		}
+	}
+	return stmts
+}
@@ -0,0 +1,3 @@
+ALTER TABLE posts ADD COLUMN version integer not null default 1;
+
+ALTER TABLE comments ADD COLUMN version integer not null default 1;
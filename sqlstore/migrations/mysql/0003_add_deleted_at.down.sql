@@ -0,0 +1,3 @@
+ALTER TABLE comments DROP COLUMN deleted_at;
+
+ALTER TABLE posts DROP COLUMN deleted_at;
@@ -0,0 +1,3 @@
+ALTER TABLE posts ADD COLUMN deleted_at datetime(6);
+
+ALTER TABLE comments ADD COLUMN deleted_at datetime(6);
@@ -0,0 +1,8 @@
+-- the rows already there are stamped with the time of the migration
+ALTER TABLE posts ADD COLUMN created_at datetime(6) not null default current_timestamp(6), ADD COLUMN updated_at datetime(6) not null default current_timestamp(6);
+
+ALTER TABLE posts ALTER COLUMN created_at DROP DEFAULT, ALTER COLUMN updated_at DROP DEFAULT;
+
+ALTER TABLE comments ADD COLUMN created_at datetime(6) not null default current_timestamp(6), ADD COLUMN updated_at datetime(6) not null default current_timestamp(6);
+
+ALTER TABLE comments ALTER COLUMN created_at DROP DEFAULT, ALTER COLUMN updated_at DROP DEFAULT;
@@ -0,0 +1,11 @@
+CREATE TABLE posts (
+	id serial not null primary key,
+	title varchar(250) not null
+);
+
+CREATE TABLE comments (
+	id serial not null primary key,
+	post_id integer not null,
+	review varchar(250) not null,
+	foreign key (post_id) references posts(id)
+);
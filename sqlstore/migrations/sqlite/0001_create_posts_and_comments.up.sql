@@ -0,0 +1,11 @@
+CREATE TABLE posts (
+	id integer not null primary key autoincrement,
+	title varchar(250) not null
+);
+
+CREATE TABLE comments (
+	id integer not null primary key autoincrement,
+	post_id integer not null,
+	review varchar(250) not null,
+	foreign key (post_id) references posts(id)
+);
@@ -0,0 +1,7 @@
+ALTER TABLE comments DROP COLUMN updated_at;
+
+ALTER TABLE comments DROP COLUMN created_at;
+
+ALTER TABLE posts DROP COLUMN updated_at;
+
+ALTER TABLE posts DROP COLUMN created_at;
@@ -0,0 +1,13 @@
+-- sqlite only adds columns with a constant default, the rows already there are stamped with the time of the
+-- migration afterwards
+ALTER TABLE posts ADD COLUMN created_at timestamp not null default '1970-01-01 00:00:00';
+
+ALTER TABLE posts ADD COLUMN updated_at timestamp not null default '1970-01-01 00:00:00';
+
+UPDATE posts SET created_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP;
+
+ALTER TABLE comments ADD COLUMN created_at timestamp not null default '1970-01-01 00:00:00';
+
+ALTER TABLE comments ADD COLUMN updated_at timestamp not null default '1970-01-01 00:00:00';
+
+UPDATE comments SET created_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP;
@@ -0,0 +1,184 @@
+package sqlstore
+
+import (
+	"context"
+	"fmt"
+	"github.com/hendratommy/repository-pattern/models"
+	"strings"
+)
+
+// Find returns every row matching spec.
+func (t *Table[T, ID]) Find(ctx context.Context, db SqlxDatabase, spec models.Spec) ([]*T, error) {
+	return t.find(ctx, db, spec, false)
+}
+
+// FindIncludingDeleted returns every row matching spec, soft deleted or not.
+func (t *Table[T, ID]) FindIncludingDeleted(ctx context.Context, db SqlxDatabase, spec models.Spec) ([]*T, error) {
+	return t.find(ctx, db, spec, true)
+}
+
+func (t *Table[T, ID]) find(ctx context.Context, db SqlxDatabase, spec models.Spec, withDeleted bool) ([]*T, error) {
+	var args []interface{}
+	conds, err := t.conditions(DialectOf(db), spec, withDeleted, &args)
+	if err != nil {
+		return nil, err
+	}
+	orderBy, err := t.orderBy(spec.Orders)
+	if err != nil {
+		return nil, err
+	}
+	sql := `SELECT * FROM ` + t.Name + whereClause(conds) + ` ORDER BY ` + orderBy
+
+	var ms []*T
+	err = db.SelectContext(ctx, &ms, sql, args...)
+	return ms, translateError(db, err)
+}
+
+// Count returns how many rows match spec, its order is ignored.
+func (t *Table[T, ID]) Count(ctx context.Context, db SqlxDatabase, spec models.Spec) (int64, error) {
+	var args []interface{}
+	conds, err := t.conditions(DialectOf(db), spec, false, &args)
+	if err != nil {
+		return 0, err
+	}
+	var n int64
+	err = db.GetContext(ctx, &n, `SELECT COUNT(*) FROM `+t.Name+whereClause(conds), args...)
+	return n, translateError(db, err)
+}
+
+// DeleteBy removes the rows matching spec, or sets their deleted_at on a SoftDelete table, and returns how many
+// there were.
+func (t *Table[T, ID]) DeleteBy(ctx context.Context, db SqlxDatabase, spec models.Spec) (int64, error) {
+	d := DialectOf(db)
+	var args []interface{}
+	sql := `DELETE FROM ` + t.Name
+	if t.softDelete {
+		args = append(args, t.clock())
+		sql = `UPDATE ` + t.Name + ` SET ` + deletedAtColumn + `=` + d.Placeholder(1)
+	}
+	conds, err := t.conditions(d, spec, false, &args)
+	if err != nil {
+		return 0, err
+	}
+	res, err := db.ExecContext(ctx, sql+whereClause(conds), args...)
+	if err != nil {
+		return 0, translateError(db, err)
+	}
+	return res.RowsAffected()
+}
+
+// conditions renders the conditions selecting the rows of spec, leaving out the soft deleted rows unless withDeleted.
+func (t *Table[T, ID]) conditions(d Dialect, spec models.Spec, withDeleted bool, args *[]interface{}) ([]string, error) {
+	var conds []string
+	if spec.Where != nil {
+		where, err := t.where(d, *spec.Where, args)
+		if err != nil {
+			return nil, err
+		}
+		conds = append(conds, `(`+where+`)`)
+	}
+	if t.softDelete && !withDeleted {
+		conds = append(conds, deletedAtColumn+` IS NULL`)
+	}
+	return conds, nil
+}
+
+// whereClause joins conds into a WHERE clause, it is empty when there are none.
+func whereClause(conds []string) string {
+	if len(conds) == 0 {
+		return ""
+	}
+	return ` WHERE ` + strings.Join(conds, ` AND `)
+}
+
+func (t *Table[T, ID]) column(field string) (string, error) {
+	col, ok := t.byField[field]
+	if !ok {
+		return "", fmt.Errorf("%w: %s has no field %q", models.ErrInvalidSpec, t.Name, field)
+	}
+	return col, nil
+}
+
+// where renders c as a sql condition, appending its values to args so they are only ever sent as parameters.
+func (t *Table[T, ID]) where(d Dialect, c models.Criterion, args *[]interface{}) (string, error) {
+	param := func(v interface{}) string {
+		*args = append(*args, v)
+		return d.Placeholder(len(*args))
+	}
+
+	switch c.Op {
+	case models.OpAnd, models.OpOr:
+		if len(c.Children) == 0 {
+			if c.Op == models.OpAnd {
+				return `1=1`, nil
+			}
+			return `1=0`, nil
+		}
+		sep := ` AND `
+		if c.Op == models.OpOr {
+			sep = ` OR `
+		}
+		conds := make([]string, len(c.Children))
+		for i, child := range c.Children {
+			cond, err := t.where(d, child, args)
+			if err != nil {
+				return "", err
+			}
+			conds[i] = `(` + cond + `)`
+		}
+		return strings.Join(conds, sep), nil
+	}
+
+	col, err := t.column(c.Field)
+	if err != nil {
+		return "", err
+	}
+	switch c.Op {
+	case models.OpEq:
+		return col + `=` + param(c.Values[0]), nil
+	case models.OpIn:
+		if len(c.Values) == 0 {
+			return `1=0`, nil
+		}
+		ps := make([]string, len(c.Values))
+		for i, v := range c.Values {
+			ps[i] = param(v)
+		}
+		return col + ` IN (` + strings.Join(ps, ", ") + `)`, nil
+	case models.OpLike:
+		return col + ` LIKE ` + param(c.Values[0]), nil
+	case models.OpRange:
+		var conds []string
+		if from := c.Values[0]; from != nil {
+			conds = append(conds, col+` >= `+param(from))
+		}
+		if to := c.Values[1]; to != nil {
+			conds = append(conds, col+` < `+param(to))
+		}
+		if len(conds) == 0 {
+			return `1=1`, nil
+		}
+		return strings.Join(conds, ` AND `), nil
+	}
+	return "", fmt.Errorf("%w: unknown operator %d", models.ErrInvalidSpec, c.Op)
+}
+
+func (t *Table[T, ID]) orderBy(orders []models.Order) (string, error) {
+	var cols []string
+	byID := false
+	for _, o := range orders {
+		col, err := t.column(o.Field)
+		if err != nil {
+			return "", err
+		}
+		byID = byID || col == idColumn
+		if o.Desc {
+			col += ` DESC`
+		}
+		cols = append(cols, col)
+	}
+	if !byID {
+		cols = append(cols, idColumn)
+	}
+	return strings.Join(cols, ", "), nil
+}
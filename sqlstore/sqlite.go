@@ -0,0 +1,38 @@
+package sqlstore
+
+import (
+	"github.com/jmoiron/sqlx"
+	_ "modernc.org/sqlite"
+	"strings"
+)
+
+// SqliteDriver is the name of the pure go sqlite driver (modernc.org/sqlite), no cgo needed.
+const SqliteDriver = "sqlite"
+
+// ConnectSqlite opens a sqlite database with foreign keys enforced, dsn is a file path or ":memory:".
+// An in memory database only lives as long as its connection, so the pool is limited to a single connection, which
+// means an independent transaction cannot be started while another one is still open.
+func ConnectSqlite(dsn string) (*sqlx.DB, error) {
+	sep := "?"
+	if strings.Contains(dsn, "?") {
+		sep = "&"
+	}
+	db, err := sqlx.Connect(SqliteDriver, dsn+sep+"_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)&_time_format=sqlite")
+	if err != nil {
+		return nil, err
+	}
+	if strings.Contains(dsn, ":memory:") {
+		db.SetMaxOpenConns(1)
+	}
+	return db, nil
+}
+
+// Deprecated: use DropTables, it works on every dialect.
+func DropSqliteTables(db *sqlx.DB) {
+	DropTables(db)
+}
+
+// Deprecated: use CreateTables, it works on every dialect.
+func CreateSqliteTables(db *sqlx.DB) {
+	CreateTables(db)
+}
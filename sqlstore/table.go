@@ -0,0 +1,474 @@
+package sqlstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/hendratommy/repository-pattern/models"
+	"reflect"
+	"strings"
+	"time"
+)
+
+const (
+	idColumn        = "id"
+	versionColumn   = "version"
+	deletedAtColumn = "deleted_at"
+	createdAtColumn = "created_at"
+	updatedAtColumn = "updated_at"
+)
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// Table maps model T onto a sql table using the `db` struct tags of T, the field tagged `db:"id"` is the primary key.
+// An int field tagged `db:"version"` turns on optimistic locking, see models.ErrStaleVersion. A *time.Time field
+// tagged `db:"deleted_at"` is only written by Delete, Restore and Purge, see SoftDelete. time.Time fields tagged
+// `db:"created_at"` and `db:"updated_at"` are set on insert, and updated_at again on every update.
+type Table[T any, ID comparable] struct {
+	Name       string
+	idField    int
+	fields     []int
+	columns    []string
+	version    int // index of the version column in columns, -1 when T has none
+	deletedAt  int // index of the deleted_at column in columns, -1 when T has none
+	createdAt  int // index of the created_at column in columns, -1 when T has none
+	updatedAt  int // index of the updated_at column in columns, -1 when T has none
+	softDelete bool
+	now        func() time.Time
+	byField    map[string]string
+	batchSize  int
+}
+
+// NewTable creates Table for model T, it panics when T is not a struct or has no field tagged `db:"id"`.
+func NewTable[T any, ID comparable](name string) *Table[T, ID] {
+	t := &Table[T, ID]{
+		Name: name, idField: -1, version: -1, deletedAt: -1, createdAt: -1, updatedAt: -1,
+		now: time.Now, byField: map[string]string{},
+	}
+	rt := reflect.TypeOf((*T)(nil)).Elem()
+	if rt.Kind() != reflect.Struct {
+		panic(fmt.Sprintf("sqlstore: %s is not a struct", rt))
+	}
+	for i := 0; i < rt.NumField(); i++ {
+		col := strings.Split(rt.Field(i).Tag.Get("db"), ",")[0]
+		if col == "" || col == "-" {
+			continue
+		}
+		t.byField[rt.Field(i).Name] = col
+		if col == idColumn {
+			t.idField = i
+			continue
+		}
+		if col == versionColumn && rt.Field(i).Type.Kind() == reflect.Int {
+			t.version = len(t.columns)
+		}
+		if col == deletedAtColumn && rt.Field(i).Type == reflect.TypeOf((*time.Time)(nil)) {
+			t.deletedAt = len(t.columns)
+		}
+		if col == createdAtColumn && rt.Field(i).Type == timeType {
+			t.createdAt = len(t.columns)
+		}
+		if col == updatedAtColumn && rt.Field(i).Type == timeType {
+			t.updatedAt = len(t.columns)
+		}
+		t.fields = append(t.fields, i)
+		t.columns = append(t.columns, col)
+	}
+	if t.idField < 0 {
+		panic(fmt.Sprintf("sqlstore: %s has no field tagged `db:\"%s\"`", rt, idColumn))
+	}
+	return t
+}
+
+// SoftDelete returns a copy of t whose Delete sets deleted_at instead of removing the row, every finder of the copy
+// then leaves out the rows with a deleted_at. It panics when T has no *time.Time field tagged `db:"deleted_at"`.
+func (t *Table[T, ID]) SoftDelete() *Table[T, ID] {
+	if t.deletedAt < 0 {
+		panic(fmt.Sprintf("sqlstore: %s has no %s column", t.Name, deletedAtColumn))
+	}
+	soft := *t
+	soft.softDelete = true
+	return &soft
+}
+
+// WithClock returns a copy of t taking the time of its timestamps from now.
+func (t *Table[T, ID]) WithClock(now func() time.Time) *Table[T, ID] {
+	c := *t
+	c.now = now
+	return &c
+}
+
+// clock returns the current time in UTC, rounded to the microsecond every supported engine keeps.
+func (t *Table[T, ID]) clock() time.Time {
+	return t.now().UTC().Truncate(time.Microsecond)
+}
+
+// field returns the field of column i of m.
+func (t *Table[T, ID]) field(m *T, i int) reflect.Value {
+	return reflect.ValueOf(m).Elem().Field(t.fields[i])
+}
+
+// stamp sets the created_at of m and its updated_at when they are zero.
+func (t *Table[T, ID]) stamp(m *T, now time.Time) {
+	if t.createdAt >= 0 && t.field(m, t.createdAt).Interface().(time.Time).IsZero() {
+		t.field(m, t.createdAt).Set(reflect.ValueOf(now))
+	}
+	if t.updatedAt >= 0 && t.field(m, t.updatedAt).Interface().(time.Time).IsZero() {
+		t.field(m, t.updatedAt).Set(reflect.ValueOf(now))
+	}
+}
+
+// alive restricts cond to the rows not soft deleted.
+func (t *Table[T, ID]) alive(cond string) string {
+	if !t.softDelete {
+		return cond
+	}
+	return cond + ` AND ` + deletedAtColumn + ` IS NULL`
+}
+
+// updatable reports whether Update writes column i, deleted_at being left to Delete, Restore and Purge, and
+// created_at to insert.
+func (t *Table[T, ID]) updatable(i int) bool {
+	return i != t.deletedAt && i != t.createdAt
+}
+
+func (t *Table[T, ID]) values(m *T) []interface{} {
+	v := reflect.ValueOf(m).Elem()
+	values := make([]interface{}, len(t.fields))
+	for i, f := range t.fields {
+		values[i] = v.Field(f).Interface()
+	}
+	return values
+}
+
+func (t *Table[T, ID]) idOf(m *T) interface{} {
+	return t.id(m).Addr().Interface()
+}
+
+func (t *Table[T, ID]) FindByID(ctx context.Context, db SqlxDatabase, id ID) (*T, error) {
+	m := new(T)
+	sql := `SELECT * FROM ` + t.Name + ` WHERE ` + t.alive(idColumn+`=`+DialectOf(db).Placeholder(1))
+	if err := db.GetContext(ctx, m, sql, id); err != nil {
+		return nil, translateError(db, err)
+	}
+	return m, nil
+}
+
+func (t *Table[T, ID]) Exists(ctx context.Context, db SqlxDatabase, id ID) (bool, error) {
+	var exists bool
+	sql := `SELECT EXISTS(SELECT 1 FROM ` + t.Name + ` WHERE ` + t.alive(idColumn+`=`+DialectOf(db).Placeholder(1)) + `)`
+	err := db.GetContext(ctx, &exists, sql, id)
+	return exists, translateError(db, err)
+}
+
+func (t *Table[T, ID]) FindAll(ctx context.Context, db SqlxDatabase) ([]*T, error) {
+	return t.Find(ctx, db, models.All())
+}
+
+// FindBy returns every row whose column equals value, column must come from code, never from user input.
+func (t *Table[T, ID]) FindBy(ctx context.Context, db SqlxDatabase, column string, value interface{}) ([]*T, error) {
+	var ms []*T
+	sql := `SELECT * FROM ` + t.Name + ` WHERE ` + t.alive(column+`=`+DialectOf(db).Placeholder(1)) + ` ORDER BY ` + idColumn
+	err := db.SelectContext(ctx, &ms, sql, value)
+	return ms, translateError(db, err)
+}
+
+// FindPage returns a page of rows ordered by id.
+func (t *Table[T, ID]) FindPage(ctx context.Context, db SqlxDatabase, req models.PageRequest) (*models.Page[T], error) {
+	return t.FindPageBy(ctx, db, models.All(), req)
+}
+
+// FindPageBy returns a page of the rows matching spec in the order of req, the order of spec is ignored.
+func (t *Table[T, ID]) FindPageBy(ctx context.Context, db SqlxDatabase, spec models.Spec, req models.PageRequest) (*models.Page[T], error) {
+	d := DialectOf(db)
+	key, err := t.pageKey(req.OrderBy)
+	if err != nil {
+		return nil, err
+	}
+	var args []interface{}
+	conds, err := t.conditions(d, spec, false, &args)
+	if err != nil {
+		return nil, err
+	}
+	op, dir := ` > `, ``
+	if req.OrderBy.Desc {
+		op, dir = ` < `, ` DESC`
+	}
+	if req.Cursor != "" {
+		after, value, err := t.decodeCursor(req.Cursor, key)
+		if err != nil {
+			return nil, err
+		}
+		if key == nil {
+			args = append(args, after)
+			conds = append(conds, idColumn+op+d.Placeholder(len(args)))
+		} else {
+			args = append(args, value, value, after)
+			n := len(args)
+			conds = append(conds, `(`+key.column+op+d.Placeholder(n-2)+` OR (`+key.column+`=`+d.Placeholder(n-1)+
+				` AND `+idColumn+op+d.Placeholder(n)+`))`)
+		}
+	}
+	orderBy := idColumn + dir
+	if key != nil {
+		orderBy = key.column + dir + `, ` + orderBy
+	}
+	// one row more than asked tells whether there is a next page
+	sql := `SELECT * FROM ` + t.Name + whereClause(conds) + fmt.Sprintf(` ORDER BY %s LIMIT %d`, orderBy, req.Size()+1)
+	if req.Offset > 0 {
+		sql += fmt.Sprintf(` OFFSET %d`, req.Offset)
+	}
+
+	var ms []*T
+	if err := db.SelectContext(ctx, &ms, sql, args...); err != nil {
+		return nil, translateError(db, err)
+	}
+	return models.NewPage(req, ms, func(m *T) string {
+		if key == nil {
+			return models.EncodeCursor(t.id(m).Interface().(ID), nil)
+		}
+		return models.EncodeCursor(t.id(m).Interface().(ID), reflect.ValueOf(m).Elem().Field(key.field).Interface())
+	}), nil
+}
+
+type pageKey struct {
+	column string
+	field  int
+}
+
+// pageKey resolves the field a page is ordered by before the id, it is nil when the page is only ordered by id.
+func (t *Table[T, ID]) pageKey(o models.Order) (*pageKey, error) {
+	if o.Field == "" {
+		return nil, nil
+	}
+	col, err := t.column(o.Field)
+	if err != nil {
+		return nil, err
+	}
+	if col == idColumn {
+		return nil, nil
+	}
+	f, _ := reflect.TypeOf((*T)(nil)).Elem().FieldByName(o.Field)
+	return &pageKey{column: col, field: f.Index[0]}, nil
+}
+
+func (t *Table[T, ID]) decodeCursor(cursor string, key *pageKey) (ID, interface{}, error) {
+	if key == nil {
+		after, err := models.DecodeCursor[ID](cursor, nil)
+		return after, nil, err
+	}
+	value := reflect.New(reflect.TypeOf((*T)(nil)).Elem().Field(key.field).Type)
+	after, err := models.DecodeCursor[ID](cursor, value.Interface())
+	if tm, ok := value.Interface().(*time.Time); ok {
+		return after, tm.UTC(), err
+	}
+	return after, value.Elem().Interface(), err
+}
+
+func (t *Table[T, ID]) id(m *T) reflect.Value {
+	return reflect.ValueOf(m).Elem().Field(t.idField)
+}
+
+// Save inserts m when its id is zero, otherwise it inserts or updates the row with that id. On a versioned table an
+// update fails with models.ErrStaleVersion when the row was changed since m was read.
+func (t *Table[T, ID]) Save(ctx context.Context, db SqlxDatabase, m *T) error {
+	if t.id(m).IsZero() {
+		return t.Insert(ctx, db, m)
+	}
+	if t.version >= 0 {
+		if err := t.Update(ctx, db, m); !errors.Is(err, models.ErrNotFound) {
+			return err
+		}
+		return t.Insert(ctx, db, m)
+	}
+	now := t.clock()
+	t.stamp(m, now)
+	if t.updatedAt >= 0 {
+		t.field(m, t.updatedAt).Set(reflect.ValueOf(now))
+	}
+	var updates []string
+	for i, col := range t.columns {
+		if t.updatable(i) {
+			updates = append(updates, col)
+		}
+	}
+	d := DialectOf(db)
+	columns := append([]string{idColumn}, t.columns...)
+	sql := `INSERT INTO ` + t.Name + `(` + strings.Join(columns, ", ") + `) VALUES (` + placeholders(d, 1, len(columns)) + `)
+			` + d.Upsert(idColumn, updates)
+	if _, err := db.ExecContext(ctx, sql, append([]interface{}{t.id(m).Interface()}, t.values(m)...)...); err != nil {
+		return translateError(db, err)
+	}
+	return t.syncSequence(ctx, db)
+}
+
+// Insert inserts m, letting the database generate the id when it is zero. It returns models.ErrConflict when a row
+// with the same id already exists. On a versioned table m starts at version 1.
+func (t *Table[T, ID]) Insert(ctx context.Context, db SqlxDatabase, m *T) error {
+	t.stamp(m, t.clock())
+	if t.version >= 0 {
+		v := reflect.ValueOf(m).Elem().Field(t.fields[t.version])
+		old := v.Int()
+		v.SetInt(1)
+		if err := t.insert(ctx, db, m); err != nil {
+			v.SetInt(old)
+			return err
+		}
+		return nil
+	}
+	return t.insert(ctx, db, m)
+}
+
+func (t *Table[T, ID]) insert(ctx context.Context, db SqlxDatabase, m *T) error {
+	d := DialectOf(db)
+	if !t.id(m).IsZero() {
+		columns := append([]string{idColumn}, t.columns...)
+		sql := `INSERT INTO ` + t.Name + `(` + strings.Join(columns, ", ") + `) VALUES (` + placeholders(d, 1, len(columns)) + `)`
+		if _, err := db.ExecContext(ctx, sql, append([]interface{}{t.id(m).Interface()}, t.values(m)...)...); err != nil {
+			return translateError(db, err)
+		}
+		return t.syncSequence(ctx, db)
+	}
+
+	sql := `INSERT INTO ` + t.Name + `(` + strings.Join(t.columns, ", ") + `) VALUES (` + placeholders(d, 1, len(t.columns)) + `)`
+	if returning := d.Returning(idColumn); returning != "" {
+		return translateError(db, db.GetContext(ctx, t.idOf(m), sql+` `+returning, t.values(m)...))
+	}
+	res, err := db.ExecContext(ctx, sql, t.values(m)...)
+	if err != nil {
+		return translateError(db, err)
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return err
+	}
+	if f := t.id(m); f.CanInt() {
+		f.SetInt(id)
+	}
+	return nil
+}
+
+// Update updates the row with the id of m, it returns models.ErrNotFound when there is none. On a versioned table
+// only the row still at the version of m is updated, the version is incremented in the row and in m, otherwise it
+// returns models.ErrStaleVersion.
+func (t *Table[T, ID]) Update(ctx context.Context, db SqlxDatabase, m *T) error {
+	d := DialectOf(db)
+	now := t.clock()
+	values := t.values(m)
+	if t.updatedAt >= 0 {
+		values[t.updatedAt] = now
+	}
+	var set []string
+	var args []interface{}
+	for i, col := range t.columns {
+		if !t.updatable(i) {
+			continue
+		}
+		if i == t.version {
+			set = append(set, col+`=`+col+` + 1`)
+			continue
+		}
+		args = append(args, values[i])
+		set = append(set, col+`=`+d.Placeholder(len(args)))
+	}
+	args = append(args, t.id(m).Interface())
+	where := t.alive(idColumn + `=` + d.Placeholder(len(args)))
+	if t.version >= 0 {
+		args = append(args, values[t.version])
+		where += ` AND ` + versionColumn + `=` + d.Placeholder(len(args))
+	}
+	sql := `UPDATE ` + t.Name + ` SET ` + strings.Join(set, ", ") + ` WHERE ` + where
+	res, err := db.ExecContext(ctx, sql, args...)
+	if err != nil {
+		return translateError(db, err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		// some engines only count the rows actually changed, so tell apart a missing row from an identical one
+		var exists int
+		sql = `SELECT COUNT(*) FROM ` + t.Name + ` WHERE ` + t.alive(idColumn+`=`+d.Placeholder(1))
+		if err := db.GetContext(ctx, &exists, sql, t.id(m).Interface()); err != nil {
+			return translateError(db, err)
+		}
+		if exists == 0 {
+			return fmt.Errorf("%w: %s %v", models.ErrNotFound, t.Name, t.id(m).Interface())
+		}
+		if t.version >= 0 {
+			return fmt.Errorf("%w: %s %v at version %v", models.ErrStaleVersion, t.Name, t.id(m).Interface(), values[t.version])
+		}
+		return nil
+	}
+	if t.version >= 0 {
+		v := reflect.ValueOf(m).Elem().Field(t.fields[t.version])
+		v.SetInt(v.Int() + 1)
+	}
+	if t.updatedAt >= 0 {
+		t.field(m, t.updatedAt).Set(reflect.ValueOf(now))
+	}
+	return nil
+}
+
+// syncSequence moves the id generator past the ids inserted explicitly, on engines that do not do it themselves.
+func (t *Table[T, ID]) syncSequence(ctx context.Context, db SqlxDatabase) error {
+	sql := DialectOf(db).SyncSequence(t.Name, idColumn)
+	if sql == "" {
+		return nil
+	}
+	_, err := db.ExecContext(ctx, sql)
+	return translateError(db, err)
+}
+
+// Delete removes the row with id, or sets its deleted_at on a SoftDelete table. It returns models.ErrNotFound when
+// there is none.
+func (t *Table[T, ID]) Delete(ctx context.Context, db SqlxDatabase, id ID) error {
+	d := DialectOf(db)
+	sql := `DELETE FROM ` + t.Name + ` WHERE ` + idColumn + `=` + d.Placeholder(1)
+	args := []interface{}{id}
+	if t.softDelete {
+		sql = `UPDATE ` + t.Name + ` SET ` + deletedAtColumn + `=` + d.Placeholder(1) + ` WHERE ` + t.alive(idColumn+`=`+d.Placeholder(2))
+		args = []interface{}{t.clock(), id}
+	}
+	return t.exec(ctx, db, id, sql, args...)
+}
+
+// Restore clears the deleted_at of the row with id, it returns models.ErrNotFound when there is no such deleted row.
+func (t *Table[T, ID]) Restore(ctx context.Context, db SqlxDatabase, id ID) error {
+	if t.deletedAt < 0 {
+		return fmt.Errorf("sqlstore: %s has no %s column", t.Name, deletedAtColumn)
+	}
+	sql := `UPDATE ` + t.Name + ` SET ` + deletedAtColumn + `=NULL WHERE ` + idColumn + `=` + DialectOf(db).Placeholder(1) +
+		` AND ` + deletedAtColumn + ` IS NOT NULL`
+	return t.exec(ctx, db, id, sql, id)
+}
+
+// Purge removes the rows deleted more than olderThan ago and returns how many there were.
+func (t *Table[T, ID]) Purge(ctx context.Context, db SqlxDatabase, olderThan time.Duration) (int64, error) {
+	if t.deletedAt < 0 {
+		return 0, fmt.Errorf("sqlstore: %s has no %s column", t.Name, deletedAtColumn)
+	}
+	sql := `DELETE FROM ` + t.Name + ` WHERE ` + deletedAtColumn + ` < ` + DialectOf(db).Placeholder(1)
+	res, err := db.ExecContext(ctx, sql, t.clock().Add(-olderThan))
+	if err != nil {
+		return 0, translateError(db, err)
+	}
+	return res.RowsAffected()
+}
+
+// exec runs a statement writing the row with id, it returns models.ErrNotFound when no row was written.
+func (t *Table[T, ID]) exec(ctx context.Context, db SqlxDatabase, id ID, sql string, args ...interface{}) error {
+	res, err := db.ExecContext(ctx, sql, args...)
+	if err != nil {
+		return translateError(db, err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return fmt.Errorf("%w: %s %v", models.ErrNotFound, t.Name, id)
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+	"github.com/hendratommy/repository-pattern/tracing"
+	"github.com/jmoiron/sqlx"
+	"reflect"
+	"strings"
+)
+
+// Traced returns db recording a span per statement, a child of the span carried by the ctx of the call. The spans
+// hold the dialect, the statement and how many rows it returned or changed. Calls with a ctx carrying no span are not
+// traced.
+func Traced(db SqlxDatabase) SqlxDatabase {
+	return tracedDatabase{db}
+}
+
+type tracedDatabase struct {
+	SqlxDatabase
+}
+
+func (db tracedDatabase) start(ctx context.Context, query string) (context.Context, *tracing.Span) {
+	verb := strings.ToUpper(strings.SplitN(strings.TrimSpace(query), " ", 2)[0])
+	ctx, span := tracing.Start(ctx, "sql "+verb)
+	span.SetAttribute("db.system", DialectOf(db.SqlxDatabase).Name())
+	span.SetAttribute("db.statement", query)
+	return ctx, span
+}
+
+func (db tracedDatabase) GetContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error {
+	ctx, span := db.start(ctx, query)
+	defer span.End()
+	err := db.SqlxDatabase.GetContext(ctx, dest, query, args...)
+	if err == nil {
+		span.SetAttribute("db.rows", 1)
+	}
+	span.RecordError(err)
+	return err
+}
+
+func (db tracedDatabase) SelectContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error {
+	ctx, span := db.start(ctx, query)
+	defer span.End()
+	err := db.SqlxDatabase.SelectContext(ctx, dest, query, args...)
+	if err == nil {
+		span.SetAttribute("db.rows", reflect.Indirect(reflect.ValueOf(dest)).Len())
+	}
+	span.RecordError(err)
+	return err
+}
+
+func (db tracedDatabase) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	ctx, span := db.start(ctx, query)
+	defer span.End()
+	res, err := db.SqlxDatabase.ExecContext(ctx, query, args...)
+	if err == nil {
+		if n, err := res.RowsAffected(); err == nil {
+			span.SetAttribute("db.rows", n)
+		}
+	}
+	span.RecordError(err)
+	return res, err
+}
+
+// PreparexContext only traces the preparation, not the executions of the statement.
+func (db tracedDatabase) PreparexContext(ctx context.Context, query string) (*sqlx.Stmt, error) {
+	ctx, span := db.start(ctx, query)
+	defer span.End()
+	stmt, err := db.SqlxDatabase.PreparexContext(ctx, query)
+	span.RecordError(err)
+	return stmt, err
+}
@@ -0,0 +1,156 @@
+// Package tracing records spans, timed and annotated units of work forming a tree per trace, in the style of
+// OpenTelemetry. A span travels in the context, so work started with that context becomes its child.
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+	"time"
+)
+
+// Attributes annotate a span, the keys follow the OpenTelemetry conventions where there is one, like db.statement.
+type Attributes map[string]interface{}
+
+// SpanData is what an Exporter receives of a span once it ended.
+type SpanData struct {
+	TraceID    string
+	SpanID     string
+	ParentID   string // empty for the root span of a trace
+	Name       string
+	Start      time.Time
+	End        time.Time
+	Attributes Attributes
+	Err        error
+}
+
+// Duration returns how long the span lasted.
+func (d SpanData) Duration() time.Duration {
+	return d.End.Sub(d.Start)
+}
+
+// Exporter receives every span when it ends, it must be safe for concurrent use.
+type Exporter interface {
+	Export(span SpanData)
+}
+
+// Tracer starts spans and hands them to its exporter when they end.
+type Tracer struct {
+	exporter Exporter
+	now      func() time.Time
+}
+
+func NewTracer(exporter Exporter) *Tracer {
+	return &Tracer{exporter: exporter, now: time.Now}
+}
+
+// Start starts the span name, child of the span carried by ctx if any, and returns it with a ctx carrying it.
+func (t *Tracer) Start(ctx context.Context, name string) (context.Context, *Span) {
+	s := &Span{tracer: t, data: SpanData{SpanID: newID(8), Name: name, Start: t.now(), Attributes: Attributes{}}}
+	if parent := SpanFromContext(ctx); parent != nil {
+		s.data.TraceID = parent.data.TraceID
+		s.data.ParentID = parent.data.SpanID
+	} else {
+		s.data.TraceID = newID(16)
+	}
+	return context.WithValue(ctx, ctxSpanKey{}, s), s
+}
+
+// Start starts the span name as a child of the span carried by ctx, with the same tracer. When ctx carries no span
+// there is nothing to trace, it returns ctx and a nil span, whose methods do nothing.
+func Start(ctx context.Context, name string) (context.Context, *Span) {
+	parent := SpanFromContext(ctx)
+	if parent == nil {
+		return ctx, nil
+	}
+	return parent.tracer.Start(ctx, name)
+}
+
+type ctxSpanKey struct{}
+
+// SpanFromContext returns the span carried by ctx, nil when there is none.
+func SpanFromContext(ctx context.Context) *Span {
+	s, _ := ctx.Value(ctxSpanKey{}).(*Span)
+	return s
+}
+
+// Span is a unit of work in progress, it is safe for concurrent use and a nil Span does nothing.
+type Span struct {
+	mu     sync.Mutex
+	tracer *Tracer
+	data   SpanData
+	ended  bool
+}
+
+func (s *Span) SetAttribute(key string, value interface{}) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data.Attributes[key] = value
+}
+
+// RecordError marks the span failed with err, a nil err is ignored.
+func (s *Span) RecordError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data.Err = err
+}
+
+// End ends the span and exports it, later calls do nothing.
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.data.End = s.tracer.now()
+	data := s.data
+	data.Attributes = make(Attributes, len(s.data.Attributes))
+	for k, v := range s.data.Attributes {
+		data.Attributes[k] = v
+	}
+	s.mu.Unlock()
+	s.tracer.exporter.Export(data)
+}
+
+func newID(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// InMemoryExporter keeps the spans it receives, for tests.
+type InMemoryExporter struct {
+	mu    sync.Mutex
+	spans []SpanData
+}
+
+func (e *InMemoryExporter) Export(span SpanData) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.spans = append(e.spans, span)
+}
+
+// Spans returns the spans received so far, in the order they ended.
+func (e *InMemoryExporter) Spans() []SpanData {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return append([]SpanData(nil), e.spans...)
+}
+
+// Reset forgets the spans received so far.
+func (e *InMemoryExporter) Reset() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.spans = nil
+}